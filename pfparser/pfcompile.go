@@ -0,0 +1,265 @@
+/*
+  pfcompile.go
+  Description: Compilation of propositional formulae into reusable evaluators
+*/
+
+package pfparser
+
+import (
+	"fmt"     // Sprintf
+	"strings" // lines and carets
+)
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// A syntax error describes a failure while compiling a propositional
+// formula. Besides its description, it stores the formula and the line and
+// column (both starting at 1) of the token where it was found. Type errors that
+// can be detected before evaluating the formula are reported as syntax errors
+// as well
+type SyntaxError struct {
+	Formula string
+	Line    int
+	Column  int
+	Msg     string
+	rest    string // text of the formula starting at the offending token
+}
+
+// A formula is the result of compiling a propositional formula. It can be
+// evaluated any number of times and it is never modified
+type Formula struct {
+	text       string
+	evaluator  LogicalEvaluator
+	references []reference
+}
+
+// Every variable and function used in a formula is recorded along with the
+// offset where it appears so that it can be reported if it does not exist.
+// Variables given to exists and missing are optional since they might not
+// exist. Functions record the number of arguments given to them as well
+type reference struct {
+	name     string
+	function bool
+	optional bool
+	offset   int
+	args     int
+}
+
+// While recording the functions of a formula, the following struct stores the
+// index of the reference of a function whose arguments are being processed and
+// the depth of its parenthesis
+type call struct {
+	index int
+	depth int
+}
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// newSyntaxError is a helper function that returns a new syntax error with a
+// formatted description found at the beginning of the given text, which is the
+// chunk of the formula still to be processed. Its location is computed once the
+// whole formula is known
+func newSyntaxError(rest string, format string, a ...interface{}) *SyntaxError {
+	return &SyntaxError{Msg: fmt.Sprintf(format, a...), rest: rest}
+}
+
+// Return a formula that results from compiling the given text and nil, or nil
+// and a *SyntaxError if the text is not a correct formula or if any builtin
+// function is given a wrong number of arguments. The text is not modified
+func Compile(text string) (*Formula, error) {
+
+	pformula := text
+	evaluator, err := Parse(&pformula, 0)
+	if err != nil {
+		if syntaxErr, ok := err.(*SyntaxError); ok {
+			return nil, syntaxErr.locate(text)
+		}
+		return nil, err
+	}
+
+	// record all variables and functions by processing the tokens of the
+	// formula once again, which is known to be correct. The arguments of
+	// every function are counted as the number of commas found at the depth
+	// of its parenthesis plus one, unless it is immediately closed
+	formula := &Formula{text: text, evaluator: evaluator}
+	var calls []call
+	depth := 0
+	for pformula, previous := text, eof; ; {
+		offset := len(text) - len(strings.TrimLeft(pformula, " \t\r\n"))
+		token, err := nextToken(&pformula, true)
+		if err != nil || token.tokenType == eof {
+			break
+		}
+		if previous == function && token.tokenType != closeParen {
+			formula.references[calls[len(calls)-1].index].args = 1
+		}
+		switch token.tokenType {
+		case variable, function:
+			formula.references = append(formula.references,
+				reference{string(token.tokenValue.(Variable)), token.tokenType == function,
+					previous == exists || previous == missing, offset, 0})
+			if token.tokenType == function {
+				depth++
+				calls = append(calls, call{len(formula.references) - 1, depth})
+			}
+		case openParen:
+			depth++
+		case closeParen:
+			if len(calls) > 0 && calls[len(calls)-1].depth == depth {
+				calls = calls[:len(calls)-1]
+			}
+			depth--
+		case comma:
+			if len(calls) > 0 && calls[len(calls)-1].depth == depth {
+				formula.references[calls[len(calls)-1].index].args++
+			}
+		}
+		previous = token.tokenType
+	}
+
+	// builtin functions expect exactly one argument
+	for _, reference := range formula.references {
+		if _, ok := builtins[reference.name]; ok && reference.function && reference.args != 1 {
+			err := &SyntaxError{Msg: fmt.Sprintf("The function '%v' expects 1 arguments but %v were given",
+				reference.name, reference.args), rest: text[reference.offset:]}
+			return nil, err.locate(text)
+		}
+	}
+
+	return formula, nil
+}
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// locate is a helper function that updates this error with the given formula
+// and the line and column where the offending token starts
+func (err *SyntaxError) locate(formula string) *SyntaxError {
+
+	offset := len(formula) - len(strings.TrimLeft(err.rest, " \t\r\n"))
+	if offset < 0 || offset > len(formula) {
+		offset = len(formula)
+	}
+	err.Formula = formula
+	err.Line = 1 + strings.Count(formula[:offset], "\n")
+	err.Column = 1 + offset - (1 + strings.LastIndex(formula[:offset], "\n"))
+	return err
+}
+
+// Return a string with a description of this error. If its location is known,
+// the offending line of the formula is shown with a caret under the token where
+// the error was found
+func (err *SyntaxError) Error() string {
+
+	// in case the location is unknown, show the text that follows the
+	// error, if any
+	if err.Column == 0 {
+		if err.rest == "" {
+			return err.Msg
+		}
+		return fmt.Sprintf("%v just before %q", err.Msg, err.rest)
+	}
+
+	lines := strings.Split(err.Formula, "\n")
+	line := lines[err.Line-1]
+	location := fmt.Sprintf("column %v", err.Column)
+	if len(lines) > 1 {
+		location = fmt.Sprintf("line %v, column %v", err.Line, err.Column)
+	}
+
+	// the caret is preceded by blanks, but tabs are preserved to keep it
+	// aligned with the offending token
+	padding := strings.Map(func(char rune) rune {
+		if char == '\t' {
+			return char
+		}
+		return ' '
+	}, line[:err.Column-1])
+	return fmt.Sprintf("%v at %v\n\t%v\n\t%v^", err.Msg, location, line, padding)
+}
+
+// Return the result of evaluating this formula with the given symbol table
+func (formula *Formula) Evaluate(symtable map[string]RelationalInterface) LogicalInterface {
+	return formula.evaluator.Evaluate(symtable)
+}
+
+// Return the text of this formula
+func (formula *Formula) String() string {
+	return formula.text
+}
+
+// Return the names of all variables and functions used in this formula in the
+// same order they appear, including those given to exists and missing. Names
+// used several times are returned only once
+func (formula *Formula) Variables() (names []string) {
+
+	seen := make(map[string]bool)
+	for _, reference := range formula.references {
+		if !seen[reference.name] {
+			seen[reference.name] = true
+			names = append(names, reference.name)
+		}
+	}
+	return
+}
+
+// Return nil if all variables and functions used in this formula exist in the
+// given symbol table (or are builtin functions), except those given to exists
+// and missing. Otherwise, a *SyntaxError is returned which points to the first
+// one that does not exist
+func (formula *Formula) Check(symtable map[string]RelationalInterface) error {
+
+	for _, reference := range formula.references {
+		if _, ok := symtable[reference.name]; ok || reference.optional {
+			continue
+		}
+		if _, ok := builtins[reference.name]; ok && reference.function {
+			continue
+		}
+		kind := "variable"
+		if reference.function {
+			kind = "function"
+		}
+		err := &SyntaxError{Msg: fmt.Sprintf("Unknown %v '%v'", kind, reference.name),
+			rest: formula.text[reference.offset:]}
+		return err.locate(formula.text)
+	}
+	return nil
+}
+
+// Return nil if all variables and functions used in this formula whose names
+// are given in the specified map are used with the number of arguments given
+// there, where variables take no arguments. Otherwise, a *SyntaxError is
+// returned which points to the first one used with a different number of
+// arguments. Variables given to exists and missing are not verified
+func (formula *Formula) CheckArity(arities map[string]int) error {
+
+	for _, reference := range formula.references {
+		arity, ok := arities[reference.name]
+		if !ok || reference.optional {
+			continue
+		}
+		var msg string
+		switch {
+		case arity == 0 && reference.function:
+			msg = fmt.Sprintf("'%v' is not a function", reference.name)
+		case arity > 0 && !reference.function:
+			msg = fmt.Sprintf("The function '%v' expects %v arguments", reference.name, arity)
+		case arity > 0 && reference.args != arity:
+			msg = fmt.Sprintf("The function '%v' expects %v arguments but %v were given",
+				reference.name, arity, reference.args)
+		default:
+			continue
+		}
+		err := &SyntaxError{Msg: msg, rest: formula.text[reference.offset:]}
+		return err.locate(formula.text)
+	}
+	return nil
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
@@ -0,0 +1,171 @@
+package pfparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+
+	symtable := map[string]RelationalInterface{
+		"White":    ConstString("alice"),
+		"WhiteElo": ConstInteger(2100),
+	}
+
+	// formulas can be evaluated any number of times
+	text := "%White = 'alice' and %WhiteElo > 2000"
+	formula, err := Compile(text)
+	if err != nil {
+		t.Fatalf(" Unexpected error in pformula %v: %v", text, err)
+	}
+	for idx := 0; idx < 2; idx++ {
+		if formula.Evaluate(symtable) != TypeBool(true) {
+			t.Fatalf(" The pformula %v should be true", text)
+		}
+	}
+	if formula.String() != text {
+		t.Fatalf(" The text of the pformula is %q instead of %q", formula.String(), text)
+	}
+	if got := strings.Join(formula.Variables(), " "); got != "White WhiteElo" {
+		t.Fatalf(" The variables of the pformula are %q", got)
+	}
+
+	// variables given to exists and missing are used as well
+	formula, err = Compile("missing(%Black) or exists(%White)")
+	if err != nil {
+		t.Fatalf(" Unexpected error: %v", err)
+	}
+	if got := strings.Join(formula.Variables(), " "); got != "Black White" {
+		t.Fatalf(" The variables of the pformula are %q", got)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+
+	var errorTable = []struct {
+		pformula string
+		line     int
+		column   int
+	}{
+		{"%White 'alice'", 1, 8},
+		{"%White = 'alice' %Black = 'bob'", 1, 18},
+		{"%White = 'alice' and", 1, 21},
+		{"(%White = 'alice'", 1, 18},
+		{"%White = 'alice')", 1, 17},
+		{"%WhiteElo + 'a' > 3", 1, 11},
+		{"%WhiteElo * (2 + 3 > 3", 1, 20},
+		{"%White ~ '(alice'", 1, 10},
+		{"%White in_set ('alice', 3)", 1, 15},
+		{"%White in_set ('alice' 'bob')", 1, 24},
+		{"%Material(1 2) > 3", 1, 13},
+		{"3 = 'alice'", 1, 3},
+		{"3 in '2013'", 1, 3},
+		{"%White = 'alice' and\n\t%Black = $", 2, 11},
+		{"%Year(%Date, 1) = 2016", 1, 1},
+		{"%White = 'alice' or %Hour() < 12", 1, 21},
+		{"%Month(%Year(%Date, %Date)) = 1", 1, 8},
+	}
+
+	for _, tt := range errorTable {
+		t.Run(tt.pformula, func(t *testing.T) {
+			_, err := Compile(tt.pformula)
+			syntaxErr, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf(" A syntax error was expected but %v was found", err)
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column {
+				t.Fatalf(" The error was found in line %v, column %v instead of line %v, column %v: %v",
+					syntaxErr.Line, syntaxErr.Column, tt.line, tt.column, err)
+			}
+		})
+	}
+
+	// the caret is shown under the offending token
+	_, err := Compile("%White = 'alice' %Black = 'bob'")
+	if want := "\n\t%White = 'alice' %Black = 'bob'\n\t                 ^"; !strings.HasSuffix(err.Error(), want) {
+		t.Fatalf(" Wrong caret in %q", err.Error())
+	}
+}
+
+func TestCompileCheck(t *testing.T) {
+
+	symtable := map[string]RelationalInterface{
+		"White":         ConstString("alice"),
+		"Date":          ConstDate{2016, 5, 7},
+		"WhiteMaterial": Function(func(args []RelationalInterface) RelationalInterface { return ConstInteger(39) }),
+	}
+
+	var checkTable = []struct {
+		pformula string
+		column   int
+	}{
+		{"%White = 'alice'", 0},
+		{"%White = 'alice' or %Black = 'alice'", 21},
+		{"%Year(%Date) = 2016 and %WhiteMaterial(0) = 39", 0},
+		{"%WhiteMaterial(0) = %BlackMaterial(0)", 21},
+		{"%White = '%Black'", 0},
+		{"moves contains 'e4'", 1},
+		{"missing(%Black) or %White = 'alice'", 0},
+	}
+
+	for _, tt := range checkTable {
+		t.Run(tt.pformula, func(t *testing.T) {
+			formula, err := Compile(tt.pformula)
+			if err != nil {
+				t.Fatalf(" Unexpected error: %v", err)
+			}
+			err = formula.Check(symtable)
+			if tt.column == 0 {
+				if err != nil {
+					t.Fatalf(" Unexpected error: %v", err)
+				}
+				return
+			}
+			if syntaxErr, ok := err.(*SyntaxError); !ok || syntaxErr.Column != tt.column {
+				t.Fatalf(" An unknown variable was expected in column %v but %v was found", tt.column, err)
+			}
+		})
+	}
+}
+
+// Test that functions used with a wrong number of arguments are detected
+func TestCompileArity(t *testing.T) {
+
+	arities := map[string]int{"Moves": 0, "PlayerColor": 1, "Between": 2}
+
+	var arityTable = []struct {
+		pformula string
+		column   int
+	}{
+		{"%PlayerColor('alice') = 'White' and %Moves > 20", 0},
+		{"%PlayerColor('Carlsen, Magnus') = 'White'", 0},
+		{"%Between(%Year(%Date), (1 + 2) * 3) > 0", 0},
+		{"%Between(%Sum(1, 2, 3), %Moves) > 0", 0},
+		{"%Moves > 20 and %PlayerColor() = 'White'", 17},
+		{"%PlayerColor('alice', 'bob') = 'White'", 1},
+		{"%PlayerColor = 'White'", 1},
+		{"%Moves() > 20", 1},
+		{"%Between(%PlayerColor(), 1) > 0", 10},
+		{"%Year(%Date) = 2016 and %Between(1) > 0", 25},
+		{"exists(%PlayerColor) or %Moves > 20", 0},
+	}
+
+	for _, tt := range arityTable {
+		t.Run(tt.pformula, func(t *testing.T) {
+			formula, err := Compile(tt.pformula)
+			if err != nil {
+				t.Fatalf(" Unexpected error: %v", err)
+			}
+			err = formula.CheckArity(arities)
+			if tt.column == 0 {
+				if err != nil {
+					t.Fatalf(" Unexpected error: %v", err)
+				}
+				return
+			}
+			if syntaxErr, ok := err.(*SyntaxError); !ok || syntaxErr.Column != tt.column {
+				t.Fatalf(" A wrong number of arguments was expected in column %v but %v was found", tt.column, err)
+			}
+		})
+	}
+}
@@ -20,11 +20,10 @@
 package pfparser
 
 import (
-	"errors"  // for signaling errors
-	"fmt"     // Sprintf
 	"log"     // logging services
 	"regexp"  // pgn files are parsed with a regexp
 	"strconv" // Atoi
+	"strings" // blanks are trimmed
 )
 
 // global variables
@@ -33,29 +32,49 @@ import (
 // the following regexps are used just to recognize different tokens that can
 // appear in a propositional formula
 
-// -- EOF: end of formula
-var reEOF = regexp.MustCompile(`^\s*$`)
-
 // -- opening parenthesis
 var reOpenParen = regexp.MustCompile(`^\s*\(`)
 
 // -- closing parenthesis
 var reCloseParen = regexp.MustCompile(`^\s*\)`)
 
+// -- durations, i.e., a number of days (d) or weeks (w)
+var reDuration = regexp.MustCompile(`^\s*(?P<value>[0-9]+)(?P<unit>[dw])\b`)
+
+// -- the current date
+var reToday = regexp.MustCompile(`^\s*today\b`)
+
+// -- predicates over variables, which are immediately followed by an opening
+// parenthesis
+var rePredicate = regexp.MustCompile(`^\s*(?P<predicate>exists|missing)\(`)
+
 // -- integers
 var reInteger = regexp.MustCompile(`^\s*(?P<value>[0-9]+)`)
 
 // -- strings
 var reString = regexp.MustCompile(`^\s*(?P<value>'[^']+')`)
 
+// -- functions, i.e., variables immediately followed by an opening parenthesis
+var reFunction = regexp.MustCompile(`^\s*%(?P<varname>[a-zA-Z0-9_]+)\(`)
+
+// -- separator of the arguments of functions
+var reComma = regexp.MustCompile(`^\s*,`)
+
+// -- the sequence of moves, which is a reserved variable not preceded by '%'
+var reMoves = regexp.MustCompile(`^\s*moves\b`)
+
 // -- variables
 var reVariable = regexp.MustCompile(`^\s*%(?P<varname>[a-zA-Z0-9_]+)`)
 
+// -- arithmetic operators. Note that the remainder can only be recognized once
+// variables have been discarded
+var reArithmeticOperator = regexp.MustCompile(`^\s*(?P<operator>[-+*/%])`)
+
 // -- relational operators
-var reRelationalOperator = regexp.MustCompile(`^\s+(?P<operator>(<=|<|=|!=|>=|>|in|not_in))\s+`)
+var reRelationalOperator = regexp.MustCompile(`^\s+(?P<operator>(<=|<|=|!=|>=|>|in_set|in_file|in|not_in|starts_with|contains|~\*|~|!~\*|!~))\s+`)
 
 // -- logical operators
-var reLogicalOperator = regexp.MustCompile(`^\s*(?P<operator>(and|or|AND|OR))`)
+var reLogicalOperator = regexp.MustCompile(`^\s*(?P<operator>(and|xor|or|not|AND|XOR|OR|NOT))\b`)
 
 // typedefs
 // ----------------------------------------------------------------------------
@@ -85,6 +104,8 @@ const (
 	variable                           // variables
 	and                                // -- logical operators
 	or
+	xor
+	not
 	leq // -- relational operators
 	lt
 	eq
@@ -96,6 +117,24 @@ const (
 	eof       // end of formula
 	openParen // parenthesis
 	closeParen
+	function // functions and the separator of their arguments
+	comma
+	startsWith // relational operators over sequences
+	contains
+	plus // arithmetic operators
+	minus
+	times
+	div
+	mod
+	match // relational operators with regular expressions
+	notMatch
+	matchFold
+	notMatchFold
+	constDate // the current date
+	inSet     // membership in lists of constants
+	inFile
+	exists // predicates over variables
+	missing
 )
 
 // functions
@@ -107,11 +146,15 @@ const (
 // point to the chunk to process in the next invocation
 func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 
-	// just apply regular expressions successively until one matches
+	// just apply regular expressions successively until one matches. Since
+	// matching a regular expression takes time proportional to the length
+	// of the whole formula, they are applied only if the first character
+	// which is not blank might start the token they recognize
+	first := firstChar(*pformula)
 
 	// -- EOF - End of Formula
 	// --------------------------------------------------------------------
-	if reEOF.MatchString(*pformula) {
+	if first == 0 {
 
 		if consume {
 			*pformula = ""
@@ -119,7 +162,7 @@ func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 
 		return tokenItem{eof, nil}, nil
 
-	} else if reOpenParen.MatchString(*pformula) {
+	} else if first == '(' && reOpenParen.MatchString(*pformula) {
 
 		// -- Opening parenthesis
 		// ------------------------------------------------------------
@@ -133,7 +176,7 @@ func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 
 		return tokenItem{openParen, nil}, nil
 
-	} else if reCloseParen.MatchString(*pformula) {
+	} else if first == ')' && reCloseParen.MatchString(*pformula) {
 
 		// -- Closing parenthesis
 		// ------------------------------------------------------------
@@ -147,7 +190,32 @@ func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 
 		return tokenItem{closeParen, nil}, nil
 
-	} else if reInteger.MatchString(*pformula) {
+	} else if isDigit(first) && reDuration.MatchString(*pformula) {
+
+		// -- Durations
+		// ------------------------------------------------------------
+
+		// process the string and extract the relevant groups
+		tag := reDuration.FindStringSubmatchIndex(*pformula)
+
+		// durations are integer constants with the number of days
+		value, err := strconv.Atoi((*pformula)[tag[2]:tag[3]])
+		if err != nil {
+			return tokenItem{eof, nil}, newSyntaxError(*pformula, "It was not possible to process a duration")
+		}
+		if (*pformula)[tag[4]:tag[5]] == "w" {
+			value *= 7
+		}
+
+		// move forward in the propositional formula if required
+		if consume {
+			*pformula = (*pformula)[tag[1]:]
+		}
+
+		// and return a valid token
+		return tokenItem{constInteger, ConstInteger(value)}, nil
+
+	} else if isDigit(first) && reInteger.MatchString(*pformula) {
 
 		// -- Integer constants
 		// ------------------------------------------------------------
@@ -158,7 +226,7 @@ func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 		// convert this group to an integer value
 		value, err := strconv.Atoi((*pformula)[tag[2]:tag[3]])
 		if err != nil {
-			return tokenItem{eof, nil}, errors.New("It was not possible to process an integer")
+			return tokenItem{eof, nil}, newSyntaxError(*pformula, "It was not possible to process an integer")
 		}
 
 		// move forward in the propositional formula if required
@@ -169,7 +237,7 @@ func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 		// and return a valid token
 		return tokenItem{constInteger, ConstInteger(value)}, nil
 
-	} else if reString.MatchString(*pformula) {
+	} else if first == '\'' && reString.MatchString(*pformula) {
 
 		// -- String constants
 		// ------------------------------------------------------------
@@ -189,7 +257,82 @@ func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 		// and return a valid token
 		return tokenItem{constString, ConstString(value)}, nil
 
-	} else if reVariable.MatchString(*pformula) {
+	} else if first == '%' && reFunction.MatchString(*pformula) {
+
+		// -- Functions
+		// ------------------------------------------------------------
+
+		// process the string and extract the name of the function. The
+		// opening parenthesis is consumed as well
+		tag := reFunction.FindStringSubmatchIndex(*pformula)
+		value := (*pformula)[tag[2]:tag[3]]
+
+		// move forward in the propositional formula if required
+		if consume {
+			*pformula = (*pformula)[tag[1]:]
+		}
+
+		// and return a valid token which stores the name of the
+		// function
+		return tokenItem{function, Variable(value)}, nil
+
+	} else if first == ',' && reComma.MatchString(*pformula) {
+
+		// -- Separator of arguments
+		// ------------------------------------------------------------
+		if consume {
+			tag := reComma.FindStringSubmatchIndex(*pformula)
+			*pformula = (*pformula)[tag[1]:]
+		}
+
+		return tokenItem{comma, nil}, nil
+
+	} else if first == 't' && reToday.MatchString(*pformula) {
+
+		// -- Current date
+		// ------------------------------------------------------------
+		if consume {
+			tag := reToday.FindStringSubmatchIndex(*pformula)
+			*pformula = (*pformula)[tag[1]:]
+		}
+
+		// the date is computed when the formula is parsed
+		return tokenItem{constDate, today()}, nil
+
+	} else if (first == 'e' || first == 'm') && rePredicate.MatchString(*pformula) {
+
+		// -- Predicates over variables
+		// ------------------------------------------------------------
+
+		// process the string and extract the name of the predicate. The
+		// opening parenthesis is consumed as well
+		tag := rePredicate.FindStringSubmatchIndex(*pformula)
+		predicate := exists
+		if (*pformula)[tag[2]:tag[3]] == "missing" {
+			predicate = missing
+		}
+
+		// move forward in the propositional formula if required
+		if consume {
+			*pformula = (*pformula)[tag[1]:]
+		}
+
+		return tokenItem{predicate, nil}, nil
+
+	} else if first == 'm' && reMoves.MatchString(*pformula) {
+
+		// -- Sequence of moves
+		// ------------------------------------------------------------
+		if consume {
+			tag := reMoves.FindStringSubmatchIndex(*pformula)
+			*pformula = (*pformula)[tag[1]:]
+		}
+
+		// and return a valid token which is a variable named after the
+		// keyword
+		return tokenItem{variable, Variable("moves")}, nil
+
+	} else if first == '%' && reVariable.MatchString(*pformula) {
 
 		// -- Variables
 		// ------------------------------------------------------------
@@ -209,7 +352,39 @@ func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 		// and return a valid token
 		return tokenItem{variable, Variable(value)}, nil
 
-	} else if reRelationalOperator.MatchString(*pformula) {
+	} else if isArithmetic(first) && reArithmeticOperator.MatchString(*pformula) {
+
+		// -- Arithmetic operators
+		// ------------------------------------------------------------
+
+		// process the string and extract the relevant group
+		tag := reArithmeticOperator.FindStringSubmatchIndex(*pformula)
+
+		// derive the type of the arithmetic operator
+		var arithOp tokenType
+		switch (*pformula)[tag[2]:tag[3]] {
+
+		case "+":
+			arithOp = plus
+		case "-":
+			arithOp = minus
+		case "*":
+			arithOp = times
+		case "/":
+			arithOp = div
+		case "%":
+			arithOp = mod
+		}
+
+		// move forward in the propositional formula if required
+		if consume {
+			*pformula = (*pformula)[tag[1]:]
+		}
+
+		// and return a valid token
+		return tokenItem{arithOp, nil}, nil
+
+	} else if isBlank((*pformula)[0]) && reRelationalOperator.MatchString(*pformula) {
 
 		// -- Relational operators
 		// ------------------------------------------------------------
@@ -235,8 +410,24 @@ func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 			relOp = geq
 		case "in":
 			relOp = in
+		case "in_set":
+			relOp = inSet
+		case "in_file":
+			relOp = inFile
 		case "not_in":
 			relOp = notin
+		case "starts_with":
+			relOp = startsWith
+		case "contains":
+			relOp = contains
+		case "~":
+			relOp = match
+		case "!~":
+			relOp = notMatch
+		case "~*":
+			relOp = matchFold
+		case "!~*":
+			relOp = notMatchFold
 		default:
 			log.Fatalf("Unknown relational operator '%s'", (*pformula)[tag[2]:tag[3]])
 		}
@@ -249,7 +440,7 @@ func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 		// and return a valid token
 		return tokenItem{relOp, nil}, nil
 
-	} else if reLogicalOperator.MatchString(*pformula) {
+	} else if isLetter(first) && reLogicalOperator.MatchString(*pformula) {
 
 		// -- Logical operators
 		// ------------------------------------------------------------
@@ -261,10 +452,14 @@ func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 		var logop tokenType
 		switch (*pformula)[tag[2]:tag[3]] {
 
-		case "and":
+		case "and", "AND":
 			logop = and
-		case "or":
+		case "or", "OR":
 			logop = or
+		case "xor", "XOR":
+			logop = xor
+		case "not", "NOT":
+			logop = not
 		default:
 			log.Fatalf("Unknown logical operator '%s'", (*pformula)[tag[2]:tag[3]])
 		}
@@ -282,7 +477,43 @@ func nextToken(pformula *string, consume bool) (token tokenItem, err error) {
 	// arbitrary token is returned in conjunction with an error
 	// that points to the position in the string where the error
 	// was found
-	return tokenItem{and, nil}, errors.New(fmt.Sprintf("Syntax error in '%v'", *pformula))
+	return tokenItem{and, nil}, newSyntaxError(*pformula, "Syntax error")
+}
+
+// firstChar is a helper function that returns the first character of the
+// given formula which is not blank, or 0 if there is none
+func firstChar(pformula string) byte {
+
+	for idx := 0; idx < len(pformula); idx++ {
+		if !isBlank(pformula[idx]) {
+			return pformula[idx]
+		}
+	}
+	return 0
+}
+
+// isBlank is a helper function that returns true if the given character is
+// blank
+func isBlank(char byte) bool {
+	return strings.IndexByte(" \t\n\f\r", char) >= 0
+}
+
+// isDigit is a helper function that returns true if the given character is a
+// digit
+func isDigit(char byte) bool {
+	return '0' <= char && char <= '9'
+}
+
+// isLetter is a helper function that returns true if the given character is a
+// letter
+func isLetter(char byte) bool {
+	return ('a' <= char && char <= 'z') || ('A' <= char && char <= 'Z')
+}
+
+// isArithmetic is a helper function that returns true if the given character is
+// an arithmetic operator
+func isArithmetic(char byte) bool {
+	return strings.IndexByte("+-*/%", char) >= 0
 }
 
 /* Local Variables: */
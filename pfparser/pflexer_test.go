@@ -0,0 +1,89 @@
+package pfparser
+
+import (
+	"testing"
+)
+
+func TestNextToken(t *testing.T) {
+
+	var tokenTable = []struct {
+		pformula string
+		tokens   []tokenType
+	}{
+		{"", []tokenType{}},
+		{" \t\n", []tokenType{}},
+		{"( )", []tokenType{openParen, closeParen}},
+		{"2016 'alice'", []tokenType{constInteger, constString}},
+		{"3d 2w 10", []tokenType{constInteger, constInteger, constInteger}},
+		{"today", []tokenType{constDate}},
+		{"%Year(%Date, 1)", []tokenType{function, variable, comma, constInteger, closeParen}},
+		{"exists(%White) missing(%Black)", []tokenType{exists, variable, closeParen, missing, variable, closeParen}},
+		{"moves %Moves %movesLeft", []tokenType{variable, variable, variable}},
+		{"1 + 2 - 3 * 4 / 5 % 6", []tokenType{constInteger, plus, constInteger, minus, constInteger, times,
+			constInteger, div, constInteger, mod, constInteger}},
+		{"%WhiteElo %BlackElo", []tokenType{variable, variable}},
+		{"1 <= 2 < 3 = 4 != 5 >= 6 > 7", []tokenType{constInteger, leq, constInteger, lt, constInteger, eq,
+			constInteger, neq, constInteger, geq, constInteger, gt, constInteger}},
+		{"%A in %B not_in %C in_set %D in_file %E", []tokenType{variable, in, variable, notin, variable,
+			inSet, variable, inFile, variable}},
+		{"moves starts_with 'e4' contains 'e5'", []tokenType{variable, startsWith, constString, contains,
+			constString}},
+		{"%A ~ %B !~ %C ~* %D !~* %E", []tokenType{variable, match, variable, notMatch, variable,
+			matchFold, variable, notMatchFold, variable}},
+		{"not %A and %B or %C xor %D", []tokenType{not, variable, and, variable, or, variable, xor, variable}},
+		{"NOT %A AND %B OR %C XOR %D", []tokenType{not, variable, and, variable, or, variable, xor, variable}},
+		{"(not(%A = 1))", []tokenType{openParen, not, openParen, variable, eq, constInteger, closeParen,
+			closeParen}},
+	}
+
+	for _, test := range tokenTable {
+		pformula := test.pformula
+		for idx := 0; ; idx++ {
+			token, err := nextToken(&pformula, true)
+			if err != nil {
+				t.Fatalf(" Unexpected error in pformula %q: %v", test.pformula, err)
+			}
+			if token.tokenType == eof {
+				if idx != len(test.tokens) {
+					t.Fatalf(" Only %v tokens were found in pformula %q instead of %v", idx, test.pformula, len(test.tokens))
+				}
+				break
+			}
+			if idx >= len(test.tokens) || token.tokenType != test.tokens[idx] {
+				t.Fatalf(" Unexpected token #%v in pformula %q", idx, test.pformula)
+			}
+		}
+	}
+
+	// values of the constants, variables and functions are computed as well
+	var valueTable = []struct {
+		pformula string
+		value    RelationalEvaluator
+	}{
+		{" 2016", ConstInteger(2016)},
+		{"3d", ConstInteger(3)},
+		{"2w", ConstInteger(14)},
+		{"'alice'", ConstString("alice")},
+		{"%Material(1)", Variable("Material")},
+		{"\t%WhiteElo", Variable("WhiteElo")},
+		{"moves", Variable("moves")},
+	}
+
+	for _, test := range valueTable {
+		pformula := test.pformula
+		token, err := nextToken(&pformula, true)
+		if err != nil {
+			t.Fatalf(" Unexpected error in pformula %q: %v", test.pformula, err)
+		}
+		if token.tokenValue != test.value {
+			t.Fatalf(" The value of pformula %q is %v instead of %v", test.pformula, token.tokenValue, test.value)
+		}
+	}
+
+	// unknown characters are reported as syntax errors
+	for _, pformula := range []string{"@", "'alice", "! 3", "in_set"} {
+		if _, err := nextToken(&pformula, true); err == nil {
+			t.Fatalf(" No error was found in pformula %q", pformula)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+/*
+  pfnull.go
+  Description: Null values and three-valued logic in propositional formulae
+*/
+
+package pfparser
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// ConstNull represents the value of variables which are not defined in the
+// symbol table. Every term that depends on a null value is null as well, and
+// relational groups over null values are unknown
+type ConstNull struct{}
+
+// TypeUnknown represents the third truth value of relational groups over null
+// values. Logical operators follow the rules of three-valued logic so that the
+// result is unknown only if it depends on the unknown value, e.g., false and
+// unknown is false but true and unknown is unknown
+type TypeUnknown struct{}
+
+// An exists expression consists of the name of a variable. If negated is true,
+// it is satisfied only if the variable is missing
+type ExistsExpression struct {
+	name    string
+	negated bool
+}
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// isNull is a helper function that returns true if any of the given values is
+// null
+func isNull(values ...RelationalInterface) bool {
+
+	for _, value := range values {
+		if _, ok := value.(ConstNull); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isComparable is a helper function that returns true if the given relational
+// operator can be applied to the given values, whose types are known only when
+// formulae are evaluated, e.g., a tag might be an integer in some games and a
+// string in others. Functions can not be compared, and integers can be compared
+// only with integers and time controls. Besides, in, not_in, starts_with and
+// contains can not be applied to integers. Relational groups over values that
+// can not be compared are unknown
+func isComparable(operator RelationalOperator, left, right RelationalInterface) bool {
+
+	_, lfunction := left.(Function)
+	_, rfunction := right.(Function)
+	if lfunction || rfunction {
+		return false
+	}
+	_, linteger := left.(ConstInteger)
+	_, rinteger := right.(ConstInteger)
+	if operator&(IN|NOT_IN|STARTS_WITH|CONTAINS) != 0 {
+		return !linteger && !rinteger
+	}
+	_, lcontrol := left.(ConstTimeControl)
+	_, rcontrol := right.(ConstTimeControl)
+	return linteger == rinteger || (linteger && rcontrol) || (rinteger && lcontrol)
+}
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// Null values can not be compared. Less, Equal, In, StartsWith and Contains are
+// included here just to satisfy the relational interface since relational
+// groups over null values are unknown without comparing them
+func (constant ConstNull) Less(right RelationalInterface) TypeBool {
+	return false
+}
+
+// Null values can not be compared, see Less
+func (constant ConstNull) Equal(right RelationalInterface) TypeBool {
+	return false
+}
+
+// Null values can not be compared, see Less
+func (constant ConstNull) In(right RelationalInterface) TypeBool {
+	return false
+}
+
+// Null values can not be compared, see Less
+func (constant ConstNull) StartsWith(right RelationalInterface) TypeBool {
+	return false
+}
+
+// Null values can not be compared, see Less
+func (constant ConstNull) Contains(right RelationalInterface) TypeBool {
+	return false
+}
+
+// Return a string with the textual representation of null values
+func (constant ConstNull) String() string {
+	return "null"
+}
+
+// The evaluation of a null value returns the same null value
+func (constant ConstNull) Evaluate(symtable map[string]RelationalInterface) RelationalInterface {
+	return constant
+}
+
+// Perform the logical AND of this instance with the one in right, which is
+// false if right is false and unknown otherwise
+func (operand TypeUnknown) And(right LogicalInterface) LogicalInterface {
+
+	if right == TypeBool(false) {
+		return right
+	}
+	return operand
+}
+
+// Perform the logical OR of this instance with the one in right, which is true
+// if right is true and unknown otherwise
+func (operand TypeUnknown) Or(right LogicalInterface) LogicalInterface {
+
+	if right == TypeBool(true) {
+		return right
+	}
+	return operand
+}
+
+// Perform the logical XOR of this instance with the one in right, which is
+// always unknown
+func (operand TypeUnknown) Xor(right LogicalInterface) LogicalInterface {
+	return operand
+}
+
+// Return the negation of this instance, which is unknown as well
+func (operand TypeUnknown) Not() LogicalInterface {
+	return operand
+}
+
+// Return a string with the textual representation of the unknown value
+func (operand TypeUnknown) String() string {
+	return "unknown"
+}
+
+// The evaluation of the unknown value returns the same value
+func (operand TypeUnknown) Evaluate(symtable map[string]RelationalInterface) LogicalInterface {
+	return operand
+}
+
+// The evaluation of an exists expression returns whether its variable is
+// defined in the given symbol table with a value other than null (or the
+// opposite if it is negated). It is never unknown
+func (expression ExistsExpression) Evaluate(symtable map[string]RelationalInterface) LogicalInterface {
+
+	value, ok := symtable[expression.name]
+	return TypeBool((ok && !isNull(value)) != expression.negated)
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
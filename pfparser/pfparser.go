@@ -35,23 +35,74 @@
 // As shown in the example above, parenthesis are allowed as well to modify the
 // precedence rules which are applied by default as follows:
 //
-// 1. AND has precedence over OR
+// 1. NOT has precedence over AND, which has precedence over XOR, which has
+// precedence over OR. NOT applies only to the relational group or parenthesized
+// formula that immediately follows it, e.g., NOT %age > 2 AND %age < 5 is
+// (NOT %age > 2) AND %age < 5
 //
 // 2. Operators with the same precedence are evaluated from left to right
 //
 // 3. These precedence rules can be modified using parenthesized formulæ: The
 // most nested expressions are evaluated before others
 //
-// Note that NOT is not implemented since all binary operators can be reversed
-// as desired. The binary operations recognized by this parser are: <= < = != >
-// >= which apply both to integer and string constants and also: in, not_in
-// which are specific to string constants
+// Logical operators can be written either in lowercase or uppercase letters.
+//
+// Terms can also be functions which are preceded with the character '%' and
+// followed by a parenthesized list of arguments separated by commas, e.g.,
+// %Material(20). Their values are computed with the functions stored in the
+// symbol table with the same name.
+//
+// Finally, terms can be arithmetic expressions over integers with the binary
+// operators + - * / % and unary minus, e.g., %WhiteElo - %BlackElo > 200. As
+// usual, * / and % have precedence over + and -, operators with the same
+// precedence are evaluated from left to right and parenthesis can be used to
+// modify these rules. Note that the operator % has to be followed by a blank
+// space to distinguish it from variables.
+//
+// The binary operations recognized by this parser are: <= < = != > >= which
+// apply both to integer and string constants and also: in, not_in,
+// starts_with and contains which are specific to string constants. The last
+// two are also used with the reserved variable 'moves' (which is not preceded
+// by '%'), whose value is expected to be a sequence, e.g., moves starts_with
+// '1. e4 c5'
+//
+// Strings can be also matched against regular expressions with the relational
+// operators ~ and !~ (or ~* and !~* to ignore case) whose right term has to be
+// a string constant with a regular expression in the syntax of Go, e.g., %Event
+// ~ '^Titled Arena'. Regular expressions are compiled only once when parsing
+// the formula
+//
+// The relational operator in_set tests whether the value of a term is equal to
+// any of the integer or string constants given in a parenthesized list
+// separated by commas, e.g., %White in_set ('alice', 'bob', 'carol'), and
+// in_file does the same with the lines of the file given in a string constant,
+// e.g., %White in_file 'roster.txt'. Empty lines and lines starting with '#'
+// are ignored and lines are taken as integers only if all of them are
+// integers. All constants of a list have to be of the same type and files are
+// read only once when parsing the formula
+//
+// Variables which do not exist in the symbol table are null, and so are
+// arithmetic expressions and function calls over them. Relational groups over
+// null values are unknown and logical operators follow the rules of
+// three-valued logic, e.g., unknown and false is false whereas unknown or false
+// is unknown. The predicates exists(%Tag) and missing(%Tag) are never unknown
+// and return whether the given variable is defined or not
+//
+// Formulae are parsed with Parse, which consumes the given string, or compiled
+// with Compile, which returns a Formula that can be evaluated any number of
+// times. Errors found by Compile are reported with the column of the offending
+// token
 //
 package pfparser
 
 import (
+	"bufio"   // reading lists of constants from files
 	"errors"  // for raising errors
+	"fmt"     // Sprintf
 	"log"     // logging services
+	"os"      // opening files
+	"regexp"  // regular expressions in relational groups
+	"strconv" // Itoa
 	"strings" // substrings
 )
 
@@ -65,13 +116,17 @@ type RelationalInterface interface {
 	Less(right RelationalInterface) TypeBool
 	Equal(right RelationalInterface) TypeBool
 	In(right RelationalInterface) TypeBool
+	StartsWith(right RelationalInterface) TypeBool
+	Contains(right RelationalInterface) TypeBool
 }
 
 // The evaluation of logical expressions requires the ability to apply
-// logical operations over them, specifically AND and OR.
+// logical operations over them, specifically AND, OR, XOR and NOT.
 type LogicalInterface interface {
-	And(right LogicalInterface) TypeBool
-	Or(right LogicalInterface) TypeBool
+	And(right LogicalInterface) LogicalInterface
+	Or(right LogicalInterface) LogicalInterface
+	Xor(right LogicalInterface) LogicalInterface
+	Not() LogicalInterface
 }
 
 // ConstInteger represents a constant integer value
@@ -83,12 +138,27 @@ type ConstString string
 // Variables are represented as a string with the variable's name
 type Variable string
 
+// Functions compute a value from the values of their arguments. They are
+// stored in the symbol table as any other variable
+type Function func(args []RelationalInterface) RelationalInterface
+
+// A function call consists of the name of a function and the terms given as
+// arguments
+type FunctionCall struct {
+	name string
+	args []RelationalEvaluator
+}
+
 // Relational operators are represented with integers which are
 // matched against the constants: LEQ, LT, EQ, NEQ, GT, GEQ
 type RelationalOperator int
 
+// Arithmetic operators are represented with integers which are matched against
+// the constants: PLUS, MINUS, TIMES, DIV, MOD
+type ArithmeticOperator int
+
 // Logical operators are represented with integers which are matched
-// against the constants: AND, OR
+// against the constants: AND, OR, XOR
 type LogicalOperator int
 
 // The result of a relational expression is an instance of a boolean
@@ -124,28 +194,89 @@ type LogicalExpression struct {
 	children [2]LogicalEvaluator
 }
 
+// A match expression consists of a term whose value is matched against a
+// compiled regular expression. If negated is true, it is satisfied only if the
+// term does not match the regular expression
+type MatchExpression struct {
+	child   RelationalEvaluator
+	pattern *regexp.Regexp
+	negated bool
+}
+
+// A set expression consists of a term whose value is compared with every
+// constant in a list. It is satisfied if the term is equal to any of them
+type SetExpression struct {
+	child    RelationalEvaluator
+	elements []RelationalInterface
+}
+
+// A negated expression consists of the logical evaluator whose value is negated
+type NegatedExpression struct {
+	child LogicalEvaluator
+}
+
+// An arithmetic expression consists of an arithmetic operator that is applied
+// over items that evaluate to integers. Unary minus is represented as the
+// subtraction of its operand from zero
+type ArithmeticExpression struct {
+	root     ArithmeticOperator
+	children [2]RelationalEvaluator
+}
+
 // constants
 // ----------------------------------------------------------------------------
 
 // A relational operator consists of any of the following: <= < = != > >= in
-// not_in
+// not_in starts_with contains
 const (
-	LEQ    RelationalOperator = 1 << iota // less or equal than
-	LT                                    // less than
-	EQ                                    // equal
-	NEQ                                   // not equal
-	GT                                    // greater than
-	GEQ                                   // greater or equal than
-	IN                                    // substring
-	NOT_IN                                // not substring
+	LEQ         RelationalOperator = 1 << iota // less or equal than
+	LT                                         // less than
+	EQ                                         // equal
+	NEQ                                        // not equal
+	GT                                         // greater than
+	GEQ                                        // greater or equal than
+	IN                                         // substring
+	NOT_IN                                     // not substring
+	STARTS_WITH                                // prefix
+	CONTAINS                                   // superstring
 )
 
-// A logical operator consists of any of the following: AND, OR
+// A logical operator consists of any of the following: AND, OR, XOR
 const (
 	AND LogicalOperator = 1 << iota // AND
 	OR                              // OR
+	XOR                             // XOR
+)
+
+// An arithmetic operator consists of any of the following: + - * / %
+const (
+	PLUS  ArithmeticOperator = 1 << iota // addition
+	MINUS                                // subtraction
+	TIMES                                // multiplication
+	DIV                                  // integer division
+	MOD                                  // remainder
 )
 
+// globals
+// ----------------------------------------------------------------------------
+
+// the following map stores the symbol of every arithmetic operator
+var arithmeticSymbols = map[ArithmeticOperator]string{
+	PLUS:  "+",
+	MINUS: "-",
+	TIMES: "*",
+	DIV:   "/",
+	MOD:   "%",
+}
+
+// the following map stores the precedence of every logical operator: the
+// greater the value, the sooner it is evaluated
+var precedence = map[LogicalOperator]int{
+	OR:  1,
+	XOR: 2,
+	AND: 3,
+}
+
 // Methods
 // ----------------------------------------------------------------------------
 
@@ -156,6 +287,11 @@ func (constant ConstInteger) Less(right RelationalInterface) TypeBool {
 	var value ConstInteger
 	var ok bool
 
+	// integers are compared with the estimated duration of time controls
+	if control, ok := right.(ConstTimeControl); ok {
+		return TypeBool(control.base >= 0 && int(constant) < control.getDuration())
+	}
+
 	// verify that both types are compatible
 	value, ok = right.(ConstInteger)
 	if !ok {
@@ -172,6 +308,11 @@ func (constant ConstInteger) Equal(right RelationalInterface) TypeBool {
 	var value ConstInteger
 	var ok bool
 
+	// integers are compared with the estimated duration of time controls
+	if control, ok := right.(ConstTimeControl); ok {
+		return control.Equal(constant)
+	}
+
 	// verify that both types are compatible
 	value, ok = right.(ConstInteger)
 	if !ok {
@@ -189,6 +330,59 @@ func (constant ConstInteger) In(right RelationalInterface) TypeBool {
 	return false
 }
 
+// StartsWith is entirely forbidden for integer constants. It is included here
+// just to satisfy the relational interface
+func (constant ConstInteger) StartsWith(right RelationalInterface) TypeBool {
+
+	log.Fatal("The relational operator starts_with can not be used with integer constants")
+	return false
+}
+
+// Contains is entirely forbidden for integer constants. It is included here
+// just to satisfy the relational interface
+func (constant ConstInteger) Contains(right RelationalInterface) TypeBool {
+
+	log.Fatal("The relational operator contains can not be used with integer constants")
+	return false
+}
+
+// Functions can not be compared. Less, Equal and In are included here just to
+// satisfy the relational interface so that functions can be stored in symbol
+// tables
+func (function Function) Less(right RelationalInterface) TypeBool {
+
+	log.Fatal("Functions can not be used without arguments")
+	return false
+}
+
+// Functions can not be compared, see Less
+func (function Function) Equal(right RelationalInterface) TypeBool {
+
+	log.Fatal("Functions can not be used without arguments")
+	return false
+}
+
+// Functions can not be compared, see Less
+func (function Function) In(right RelationalInterface) TypeBool {
+
+	log.Fatal("Functions can not be used without arguments")
+	return false
+}
+
+// Functions can not be compared, see Less
+func (function Function) StartsWith(right RelationalInterface) TypeBool {
+
+	log.Fatal("Functions can not be used without arguments")
+	return false
+}
+
+// Functions can not be compared, see Less
+func (function Function) Contains(right RelationalInterface) TypeBool {
+
+	log.Fatal("Functions can not be used without arguments")
+	return false
+}
+
 // Compare this string with the one specified in right and return whether the
 // first is less than the second
 func (constant ConstString) Less(right RelationalInterface) TypeBool {
@@ -196,6 +390,15 @@ func (constant ConstString) Less(right RelationalInterface) TypeBool {
 	var value ConstString
 	var ok bool
 
+	// strings are compared with typed values once they are parsed, or
+	// with their textual representation otherwise
+	if typed, ok := right.(typedInterface); ok {
+		if value, err := typed.parse(string(constant)); err == nil {
+			return value.Less(right)
+		}
+		right = ConstString(typed.String())
+	}
+
 	// verify that both types are compatible
 	value, ok = right.(ConstString)
 	if !ok {
@@ -212,6 +415,15 @@ func (constant ConstString) Equal(right RelationalInterface) TypeBool {
 	var value ConstString
 	var ok bool
 
+	// strings are compared with typed values once they are parsed, or
+	// with their textual representation otherwise
+	if typed, ok := right.(typedInterface); ok {
+		if value, err := typed.parse(string(constant)); err == nil {
+			return value.Equal(right)
+		}
+		right = ConstString(typed.String())
+	}
+
 	// verify that both types are compatible
 	value, ok = right.(ConstString)
 	if !ok {
@@ -228,6 +440,11 @@ func (constant ConstString) In(right RelationalInterface) TypeBool {
 	var value ConstString
 	var ok bool
 
+	// typed values are used as strings
+	if typed, ok := right.(fmt.Stringer); ok {
+		right = ConstString(typed.String())
+	}
+
 	// verify that both types are compatible
 	value, ok = right.(ConstString)
 	if !ok {
@@ -237,13 +454,60 @@ func (constant ConstString) In(right RelationalInterface) TypeBool {
 	return TypeBool(strings.Contains(string(value), string(constant)))
 }
 
+// Compare this string with the one specified in right and return whether the
+// second is a prefix of the first
+func (constant ConstString) StartsWith(right RelationalInterface) TypeBool {
+
+	var value ConstString
+	var ok bool
+
+	// typed values are used as strings
+	if typed, ok := right.(fmt.Stringer); ok {
+		right = ConstString(typed.String())
+	}
+
+	// verify that both types are compatible
+	value, ok = right.(ConstString)
+	if !ok {
+		log.Fatal("Type mismatch in pfparser.go::StartsWith (ConstString)")
+	}
+
+	return TypeBool(strings.HasPrefix(string(constant), string(value)))
+}
+
+// Compare this string with the one specified in right and return whether the
+// second is a substring of the first
+func (constant ConstString) Contains(right RelationalInterface) TypeBool {
+
+	var value ConstString
+	var ok bool
+
+	// typed values are used as strings
+	if typed, ok := right.(fmt.Stringer); ok {
+		right = ConstString(typed.String())
+	}
+
+	// verify that both types are compatible
+	value, ok = right.(ConstString)
+	if !ok {
+		log.Fatal("Type mismatch in pfparser.go::Contains (ConstString)")
+	}
+
+	return TypeBool(strings.Contains(string(constant), string(value)))
+}
+
 // Perform the logical AND of this instance with the one in right and return the
 // result
-func (operand TypeBool) And(right LogicalInterface) TypeBool {
+func (operand TypeBool) And(right LogicalInterface) LogicalInterface {
 
 	var value TypeBool
 	var ok bool
 
+	// the unknown value is commutative
+	if unknown, ok := right.(TypeUnknown); ok {
+		return unknown.And(operand)
+	}
+
 	// verify that both types are compatible
 	value, ok = right.(TypeBool)
 	if !ok {
@@ -255,11 +519,16 @@ func (operand TypeBool) And(right LogicalInterface) TypeBool {
 
 // Perform the logical OR of this instance with the one in right and return the
 // result
-func (operand TypeBool) Or(right LogicalInterface) TypeBool {
+func (operand TypeBool) Or(right LogicalInterface) LogicalInterface {
 
 	var value TypeBool
 	var ok bool
 
+	// the unknown value is commutative
+	if unknown, ok := right.(TypeUnknown); ok {
+		return unknown.Or(operand)
+	}
+
 	// verify that both types are compatible
 	value, ok = right.(TypeBool)
 	if !ok {
@@ -269,6 +538,32 @@ func (operand TypeBool) Or(right LogicalInterface) TypeBool {
 	return TypeBool(bool(operand) || bool(value))
 }
 
+// Perform the logical XOR of this instance with the one in right and return the
+// result
+func (operand TypeBool) Xor(right LogicalInterface) LogicalInterface {
+
+	var value TypeBool
+	var ok bool
+
+	// the unknown value is commutative
+	if unknown, ok := right.(TypeUnknown); ok {
+		return unknown.Xor(operand)
+	}
+
+	// verify that both types are compatible
+	value, ok = right.(TypeBool)
+	if !ok {
+		log.Fatal("Type mismatch in pfparser.go::Xor (TypeBool)")
+	}
+
+	return TypeBool(bool(operand) != bool(value))
+}
+
+// Return the negation of this instance
+func (operand TypeBool) Not() LogicalInterface {
+	return !operand
+}
+
 // The following methods implement the evaluation procedure over different types
 
 // The evaluation of a constant integer returns the same constant integer
@@ -282,26 +577,126 @@ func (constant ConstString) Evaluate(symtable map[string]RelationalInterface) Re
 }
 
 // The evaluation of a variable returns its value which is taken from the given
-// symbol table.
+// symbol table. Variables which do not exist are null
 func (variable Variable) Evaluate(symtable map[string]RelationalInterface) RelationalInterface {
 
 	// retrieve the value stored in the symbol table for this variable
 	content, ok := symtable[string(variable)]
 	if !ok {
-		log.Fatalf("Variable '%v' does not exist!", string(variable))
+		return ConstNull{}
 	}
 
 	// since this variable exists in the symbol table, return it
 	return content
 }
 
+// The evaluation of a function call returns the value computed by the function
+// stored in the symbol table with the values of all its arguments. It is null
+// if the function does not exist or any argument is null
+func (call FunctionCall) Evaluate(symtable map[string]RelationalInterface) RelationalInterface {
+
+	// retrieve the function stored in the symbol table with this name, or
+	// the builtin function if there is none
+	content, ok := symtable[call.name]
+	if !ok {
+		if content, ok = builtins[call.name]; !ok {
+			return ConstNull{}
+		}
+	}
+	function, ok := content.(Function)
+	if !ok {
+		log.Fatalf("'%v' is not a function!", call.name)
+	}
+
+	// evaluate all arguments and apply the function over them
+	var args []RelationalInterface
+	for _, arg := range call.args {
+		value := arg.Evaluate(symtable)
+		if isNull(value) {
+			return value
+		}
+		args = append(args, value)
+	}
+	return function(args)
+}
+
+// The evaluation of an arithmetic expression is done in two steps: first, both
+// children are evaluated and then the arithmetic operator is applied. Both
+// children have to be integers, with the exception of dates which can be
+// shifted any number of days with + and -. If any is null, if they have any
+// other type (e.g., tags with strings such as '?' instead of ratings) or in
+// case of a division by zero, the result is null
+func (expression ArithmeticExpression) Evaluate(symtable map[string]RelationalInterface) RelationalInterface {
+
+	var result ConstInteger
+
+	// first, evaluate both children
+	lvalue := expression.children[0].Evaluate(symtable)
+	rvalue := expression.children[1].Evaluate(symtable)
+	if isNull(lvalue, rvalue) {
+		return ConstNull{}
+	}
+
+	// dates are shifted by a number of days
+	ldate, ldok := lvalue.(ConstDate)
+	rdate, rdok := rvalue.(ConstDate)
+	days, iok := rvalue.(ConstInteger)
+	switch {
+	case ldok && iok && expression.root == PLUS:
+		return ldate.shift(days)
+	case ldok && iok && expression.root == MINUS:
+		return ldate.shift(-days)
+	case rdok && expression.root == PLUS:
+		if days, ok := lvalue.(ConstInteger); ok {
+			return rdate.shift(days)
+		}
+	}
+
+	// otherwise, verify they are integers
+	lchild, lok := lvalue.(ConstInteger)
+	rchild, rok := rvalue.(ConstInteger)
+	if !lok || !rok {
+		return ConstNull{}
+	}
+
+	// and now apply the arithmetic operator
+	switch expression.root {
+
+	case PLUS:
+		result = lchild + rchild
+
+	case MINUS:
+		result = lchild - rchild
+
+	case TIMES:
+		result = lchild * rchild
+
+	case DIV, MOD:
+		if rchild == 0 {
+			return ConstNull{}
+		}
+		if expression.root == DIV {
+			result = lchild / rchild
+		} else {
+			result = lchild % rchild
+		}
+
+	default:
+		log.Fatal("Unknown arithmetic operator!")
+	}
+
+	// and return the result computed so far
+	return result
+}
+
 // The evaluation of a boolean type (TypeBool) returns the same constant
 func (constant TypeBool) Evaluate(symtable map[string]RelationalInterface) LogicalInterface {
 	return constant
 }
 
 // The evaluation of a relational expression is done in two steps: first, both
-// children are evaluated and then the relational operator is applied.
+// children are evaluated and then the relational operator is applied. If any is
+// null or they can not be compared, the result is unknown
 func (expression RelationalExpression) Evaluate(symtable map[string]RelationalInterface) LogicalInterface {
 
 	var result TypeBool = false
@@ -309,6 +704,9 @@ func (expression RelationalExpression) Evaluate(symtable map[string]RelationalIn
 	// first, evaluate both children
 	lchild := expression.children[0].Evaluate(symtable)
 	rchild := expression.children[1].Evaluate(symtable)
+	if isNull(lchild, rchild) || !isComparable(expression.root, lchild, rchild) {
+		return TypeUnknown{}
+	}
 
 	// and now, depending upon the type of relational operator, apply the
 	// right combination of Equal and Less
@@ -338,6 +736,12 @@ func (expression RelationalExpression) Evaluate(symtable map[string]RelationalIn
 	case NOT_IN:
 		result = !lchild.In(rchild)
 
+	case STARTS_WITH:
+		result = lchild.StartsWith(rchild)
+
+	case CONTAINS:
+		result = lchild.Contains(rchild)
+
 	default:
 		log.Fatal("Unknown relational operator!")
 	}
@@ -350,7 +754,7 @@ func (expression RelationalExpression) Evaluate(symtable map[string]RelationalIn
 // children are evaluated and then the logical operator is applied.
 func (expression LogicalExpression) Evaluate(symtable map[string]RelationalInterface) LogicalInterface {
 
-	var result TypeBool = false
+	var result LogicalInterface = TypeBool(false)
 
 	// first, evaluate both children
 	lchild := expression.children[0].Evaluate(symtable)
@@ -366,6 +770,9 @@ func (expression LogicalExpression) Evaluate(symtable map[string]RelationalInter
 	case OR:
 		result = lchild.Or(rchild)
 
+	case XOR:
+		result = lchild.Xor(rchild)
+
 	default:
 		log.Fatal("Unknown logical operator")
 	}
@@ -374,6 +781,55 @@ func (expression LogicalExpression) Evaluate(symtable map[string]RelationalInter
 	return result
 }
 
+// The evaluation of a match expression returns whether the value of its term
+// matches the regular expression (or not, if it is negated). Integers are
+// matched with their decimal representation and typed values with their textual
+// representation. Null values and functions are unknown
+func (expression MatchExpression) Evaluate(symtable map[string]RelationalInterface) LogicalInterface {
+
+	var text string
+	switch value := expression.child.Evaluate(symtable).(type) {
+	case ConstNull:
+		return TypeUnknown{}
+	case ConstString:
+		text = string(value)
+	case ConstInteger:
+		text = strconv.Itoa(int(value))
+	case fmt.Stringer:
+		text = value.String()
+	default:
+		return TypeUnknown{}
+	}
+
+	return TypeBool(expression.pattern.MatchString(text) != expression.negated)
+}
+
+// The evaluation of a set expression returns whether the value of its term is
+// equal to any of the constants in its list. It is unknown if the value is null
+// or if it is not equal to any constant but it can not be compared with some
+func (expression SetExpression) Evaluate(symtable map[string]RelationalInterface) LogicalInterface {
+
+	value := expression.child.Evaluate(symtable)
+	if isNull(value) {
+		return TypeUnknown{}
+	}
+	var result LogicalInterface = TypeBool(false)
+	for _, element := range expression.elements {
+		if !isComparable(EQ, value, element) {
+			result = TypeUnknown{}
+		} else if value.Equal(element) {
+			return TypeBool(true)
+		}
+	}
+	return result
+}
+
+// The evaluation of a negated expression returns the negation of the value of
+// its child
+func (expression NegatedExpression) Evaluate(symtable map[string]RelationalInterface) LogicalInterface {
+	return expression.child.Evaluate(symtable).Not()
+}
+
 // Functions
 // ----------------------------------------------------------------------------
 
@@ -381,29 +837,23 @@ func (expression LogicalExpression) Evaluate(symtable map[string]RelationalInter
 // it returns a logical evaluator and nil; otherwise, an error is raised
 func relationalGroup(pformula *string) (result LogicalEvaluator, err error) {
 
-	var firstToken, secondToken, thirdToken tokenItem
+	var firstTerm, thirdTerm RelationalEvaluator
+	var secondToken tokenItem
 	var relOperator RelationalOperator
 
 	// every relational group consists of two terms related by a relational
-	// operator where a term is defined as either a variable or a
-	// constant. Constants and Variables can be either integers or strings
+	// operator where a term is defined as an arithmetic expression over
+	// variables and constants. Constants and Variables can be either
+	// integers or strings
 
-	// get the next token ...
-	firstToken, err = nextToken(pformula, true)
+	// get the first term ...
+	firstTerm, err = nextExpression(pformula)
 	if err != nil {
 		return nil, err
 	}
 
-	// ... and check it is a constant or variable
-	if firstToken.tokenType != constInteger &&
-		firstToken.tokenType != constString &&
-		firstToken.tokenType != variable {
-
-		// if not, raise a parsing error
-		log.Fatalf("[1] A constant or variable was expected just before %q", *pformula)
-	}
-
 	// now, get the next token ...
+	operator := *pformula
 	secondToken, err = nextToken(pformula, true)
 	if err != nil {
 		return nil, err
@@ -428,36 +878,390 @@ func relationalGroup(pformula *string) (result LogicalEvaluator, err error) {
 		relOperator = IN
 	case notin:
 		relOperator = NOT_IN
+	case startsWith:
+		relOperator = STARTS_WITH
+	case contains:
+		relOperator = CONTAINS
+	case match, notMatch, matchFold, notMatchFold:
+		return matchGroup(firstTerm, secondToken.tokenType, pformula)
+	case inSet:
+		return setGroup(firstTerm, pformula)
+	case inFile:
+		return fileGroup(firstTerm, pformula)
 	default:
-		log.Fatalf("A relational operator was expected just before %q", *pformula)
+		return nil, newSyntaxError(operator, "A relational operator was expected")
 	}
 
-	// get the third token ...
-	thirdToken, err = nextToken(pformula, true)
+	// get the third term
+	thirdTerm, err = nextExpression(pformula)
 	if err != nil {
 		return nil, err
 	}
 
-	// ... and check it is either a constant or variable
-	if thirdToken.tokenType != constInteger &&
-		thirdToken.tokenType != constString &&
-		thirdToken.tokenType != variable {
-
-		// if not, raise a parsing error
-		log.Fatalf("[2] A constant or variable was expected just before %q", *pformula)
+	// and verify that constants can be related with this operator
+	if err = checkTypes(relOperator, firstTerm, thirdTerm); err != nil {
+		return nil, newSyntaxError(operator, "%v", err)
 	}
 
 	// at this point, everything went fine - return a relational expression
 	// (which is known tu fulfill the LogicalEvaluator interface and nil)
 	return RelationalExpression{relOperator,
-		[2]RelationalEvaluator{firstToken.tokenValue,
-			thirdToken.tokenValue}}, nil
+		[2]RelationalEvaluator{firstTerm, thirdTerm}}, nil
+}
+
+// Return a match expression of the given term with the regular expression given
+// in the string constant at the beginning of the given formula, which is
+// compiled here. The operator is any of the relational operators ~ !~ ~* and
+// !~* and an error is returned if the regular expression is not correct
+func matchGroup(term RelationalEvaluator, operator tokenType, pformula *string) (result LogicalEvaluator, err error) {
+
+	rest := *pformula
+	token, err := nextToken(pformula, true)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := token.tokenValue.(ConstString)
+	if !ok {
+		return nil, newSyntaxError(rest, "A regular expression was expected")
+	}
+
+	// ~* and !~* ignore case
+	expression := string(value)
+	if operator == matchFold || operator == notMatchFold {
+		expression = "(?i)" + expression
+	}
+	pattern, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, newSyntaxError(rest, "Wrong regular expression '%v': %v", string(value), err)
+	}
+
+	return MatchExpression{term, pattern, operator == notMatch || operator == notMatchFold}, nil
+}
+
+// Return a set expression of the given term with the parenthesized list of
+// constants at the beginning of the given formula. Constants are separated by
+// commas and an error is returned if they are not all integers or strings
+func setGroup(term RelationalEvaluator, pformula *string) (result LogicalEvaluator, err error) {
+
+	list := *pformula
+	if token, err := nextToken(pformula, true); err != nil || token.tokenType != openParen {
+		return nil, newSyntaxError(list, "A parenthesized list of constants was expected")
+	}
+
+	// process all constants until the closing parenthesis is found. Every
+	// constant, possibly preceded by unary minus in case of integers, is
+	// followed by either a comma or the closing parenthesis
+	var elements []RelationalInterface
+	for {
+		if next, _ := nextToken(pformula, false); next.tokenType == closeParen && len(elements) == 0 {
+			nextToken(pformula, true)
+			break
+		}
+		rest := *pformula
+		_, negative := nextArithmeticOperator(pformula, minus)
+		token, err := nextToken(pformula, true)
+		if err != nil {
+			return nil, err
+		}
+		switch value := token.tokenValue.(type) {
+		case ConstInteger:
+			if negative {
+				value = -value
+			}
+			elements = append(elements, value)
+		case ConstString:
+			if negative {
+				return nil, newSyntaxError(rest, "Unary minus can not be applied to the string '%v'", string(value))
+			}
+			elements = append(elements, value)
+		default:
+			return nil, newSyntaxError(rest, "A constant was expected in the list")
+		}
+
+		rest = *pformula
+		separator, err := nextToken(pformula, true)
+		if err != nil {
+			return nil, err
+		}
+		if separator.tokenType == closeParen {
+			break
+		}
+		if separator.tokenType != comma {
+			return nil, newSyntaxError(rest, "A comma or a closing parenthesis was expected in the list")
+		}
+	}
+
+	if err = checkElements(elements); err != nil {
+		return nil, newSyntaxError(list, "%v", err)
+	}
+	return SetExpression{term, elements}, nil
+}
+
+// Return a set expression of the given term with the constants read from the
+// file whose name is given in the string constant at the beginning of the given
+// formula. Every line contains a constant, empty lines and those starting with
+// '#' are ignored, and constants are integers only if all of them are integers
+func fileGroup(term RelationalEvaluator, pformula *string) (result LogicalEvaluator, err error) {
+
+	rest := *pformula
+	token, err := nextToken(pformula, true)
+	if err != nil {
+		return nil, err
+	}
+	filename, ok := token.tokenValue.(ConstString)
+	if !ok {
+		return nil, newSyntaxError(rest, "The name of a file was expected")
+	}
+
+	file, err := os.Open(string(filename))
+	if err != nil {
+		return nil, newSyntaxError(rest, "It was not possible to read the list of constants: %v", err)
+	}
+	defer file.Close()
+
+	// read all lines and record whether they are all integers
+	var lines []string
+	integers := true
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := strconv.Atoi(line); err != nil {
+			integers = false
+		}
+		lines = append(lines, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, newSyntaxError(rest, "It was not possible to read the list of constants: %v", err)
+	}
+
+	elements := make([]RelationalInterface, 0, len(lines))
+	for _, line := range lines {
+		if integers {
+			value, _ := strconv.Atoi(line)
+			elements = append(elements, ConstInteger(value))
+		} else {
+			elements = append(elements, ConstString(line))
+		}
+	}
+	return SetExpression{term, elements}, nil
+}
+
+// Return an error if the given terms are constants whose types can not be
+// related with the given relational operator, i.e., integers and strings can
+// not be compared and in, not_in, starts_with and contains can not be used with
+// integers
+func checkTypes(operator RelationalOperator, left, right RelationalEvaluator) error {
+
+	_, lint := left.(ConstInteger)
+	_, lstr := left.(ConstString)
+	_, rint := right.(ConstInteger)
+	_, rstr := right.(ConstString)
+
+	switch operator {
+	case IN, NOT_IN, STARTS_WITH, CONTAINS:
+		if lint || rint {
+			return errors.New("Type mismatch: the relational operators in, not_in, starts_with and contains can not be used with integer constants")
+		}
+	default:
+		if (lint && rstr) || (lstr && rint) {
+			return errors.New("Type mismatch: integer and string constants can not be compared")
+		}
+	}
+	return nil
+}
+
+// Return an error if the given constants are not all of the same type
+func checkElements(elements []RelationalInterface) error {
+
+	for _, element := range elements {
+		_, first := elements[0].(ConstInteger)
+		if _, ok := element.(ConstInteger); ok != first {
+			return errors.New(fmt.Sprintf("Type mismatch: all constants in a list should be either integers or strings but %v and %v were found",
+				elements[0], element))
+		}
+	}
+	return nil
+}
+
+// Return the arithmetic expression at the beginning of the given formula, i.e.,
+// a sequence of products separated by the operators + and -
+func nextExpression(pformula *string) (result RelationalEvaluator, err error) {
+
+	if result, err = nextProduct(pformula); err != nil {
+		return nil, err
+	}
+	for {
+		rest := *pformula
+		token, ok := nextArithmeticOperator(pformula, plus|minus)
+		if !ok {
+			return result, nil
+		}
+		right, err := nextProduct(pformula)
+		if err != nil {
+			return nil, err
+		}
+		operator := PLUS
+		if token == minus {
+			operator = MINUS
+		}
+		if result, err = newArithmeticExpression(operator, result, right, rest); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Return the product at the beginning of the given formula, i.e., a sequence of
+// factors separated by the operators * / and %
+func nextProduct(pformula *string) (result RelationalEvaluator, err error) {
+
+	if result, err = nextFactor(pformula); err != nil {
+		return nil, err
+	}
+	for {
+		rest := *pformula
+		token, ok := nextArithmeticOperator(pformula, times|div|mod)
+		if !ok {
+			return result, nil
+		}
+		right, err := nextFactor(pformula)
+		if err != nil {
+			return nil, err
+		}
+		operator := TIMES
+		if token == div {
+			operator = DIV
+		} else if token == mod {
+			operator = MOD
+		}
+		if result, err = newArithmeticExpression(operator, result, right, rest); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Return the type of the arithmetic operator at the beginning of the given
+// formula and true if it is any of the given operators. In this case, it is
+// consumed. Otherwise, the formula is not modified and false is returned
+func nextArithmeticOperator(pformula *string, operators tokenType) (tokenType, bool) {
+
+	// note that the remainder has to be distinguished from variables
+	if !isArithmetic(firstChar(*pformula)) || reVariable.MatchString(*pformula) {
+		return eof, false
+	}
+	token, _ := nextToken(pformula, false)
+	if token.tokenType&operators == 0 {
+		return eof, false
+	}
+	nextToken(pformula, true)
+	return token.tokenType, true
+}
+
+// Return the factor at the beginning of the given formula, i.e., either a term
+// (a constant, variable or function call), a factor preceded by unary minus or
+// a parenthesized arithmetic expression
+func nextFactor(pformula *string) (result RelationalEvaluator, err error) {
+
+	// unary minus
+	rest := *pformula
+	if _, ok := nextArithmeticOperator(pformula, minus); ok {
+		child, err := nextFactor(pformula)
+		if err != nil {
+			return nil, err
+		}
+		return newArithmeticExpression(MINUS, ConstInteger(0), child, rest)
+	}
+
+	// parenthesized arithmetic expressions
+	if firstChar(*pformula) == '(' {
+		nextToken(pformula, true)
+		if result, err = nextExpression(pformula); err != nil {
+			return nil, err
+		}
+		rest = *pformula
+		if token, err := nextToken(pformula, true); err != nil || token.tokenType != closeParen {
+			return nil, newSyntaxError(rest, "A closing parenthesis was expected")
+		}
+		return result, nil
+	}
+
+	// otherwise, a term is expected
+	token, err := nextTerm(pformula)
+	if err != nil {
+		return nil, err
+	}
+	if token.tokenType != constInteger &&
+		token.tokenType != constString &&
+		token.tokenType != constDate &&
+		token.tokenType != variable &&
+		token.tokenType != function {
+		return nil, newSyntaxError(rest, "A constant or variable was expected")
+	}
+	return token.tokenValue, nil
+}
+
+// Return an arithmetic expression that applies the given operator over both
+// operands. String constants are rejected since arithmetic operators can only
+// be applied to integers, and the error points to the operator which is found
+// at the beginning of rest
+func newArithmeticExpression(operator ArithmeticOperator, left, right RelationalEvaluator, rest string) (RelationalEvaluator, error) {
+
+	for _, operand := range []RelationalEvaluator{left, right} {
+		if value, ok := operand.(ConstString); ok {
+			return nil, newSyntaxError(rest, "Type mismatch: the arithmetic operator '%v' can not be applied to the string '%v'",
+				arithmeticSymbols[operator], string(value))
+		}
+	}
+	return ArithmeticExpression{operator, [2]RelationalEvaluator{left, right}}, nil
 }
 
-// A group consists of either a relational group or a parenthesized
-// formula. This function is in charge of returning a logical evaluator which
-// contains the following group and nil if no error was found; otherwise, nil
-// and an error is returned.
+// Return the next token in the given formula. In case it is a function, all its
+// arguments are processed as well and the value of the token is the function
+// call. Otherwise, it behaves like nextToken
+func nextTerm(pformula *string) (token tokenItem, err error) {
+
+	token, err = nextToken(pformula, true)
+	if err != nil || token.tokenType != function {
+		return
+	}
+
+	// process all arguments until the closing parenthesis is found. Every
+	// argument is a term which is followed by either a comma or the closing
+	// parenthesis
+	call := FunctionCall{name: string(token.tokenValue.(Variable))}
+	for {
+		if next, _ := nextToken(pformula, false); next.tokenType == closeParen && len(call.args) == 0 {
+			nextToken(pformula, true)
+			break
+		}
+		arg, err := nextExpression(pformula)
+		if err != nil {
+			return token, err
+		}
+		call.args = append(call.args, arg)
+
+		rest := *pformula
+		separator, err := nextToken(pformula, true)
+		if err != nil {
+			return token, err
+		}
+		if separator.tokenType == closeParen {
+			break
+		}
+		if separator.tokenType != comma {
+			return token, newSyntaxError(rest, "A comma or a closing parenthesis was expected in the arguments of '%v'", call.name)
+		}
+	}
+
+	return tokenItem{function, call}, nil
+}
+
+// A group consists of either a relational group or a parenthesized formula,
+// which can be preceded by NOT. This function is in charge of returning a
+// logical evaluator which contains the following group and nil if no error was
+// found; otherwise, nil and an error is returned.
 //
 // It receives the current depth to increment it in case a parenthesized formula
 // has been found
@@ -469,10 +1273,33 @@ func nextGroup(pformula *string, depth int) (result LogicalEvaluator, err error)
 		return nil, err
 	}
 
+	// in case it is a predicate over a variable, process it
+	if newToken.tokenType == exists || newToken.tokenType == missing {
+		return predicateGroup(pformula)
+	}
+
+	// in case it is a negation, consume it and negate the following group
+	if newToken.tokenType == not {
+
+		nextToken(pformula, true)
+		child, err := nextGroup(pformula, depth)
+		if err != nil {
+			return nil, err
+		}
+		return NegatedExpression{child}, nil
+	}
+
 	// now, in case it is an opening parenthesis ...
 	if newToken.tokenType == openParen {
 
-		// first, consume the parenthesis
+		// it might be either a relational group whose first term is a
+		// parenthesized arithmetic expression or a parenthesized
+		// formula
+		if isParenthesizedTerm(*pformula) {
+			return relationalGroup(pformula)
+		}
+
+		// otherwise, consume the parenthesis
 		nextToken(pformula, true)
 
 		// and invoke the parse function (recursively, this is mutual
@@ -484,6 +1311,71 @@ func nextGroup(pformula *string, depth int) (result LogicalEvaluator, err error)
 	return relationalGroup(pformula)
 }
 
+// Return an exists expression with the predicate exists or missing at the
+// beginning of the given formula, whose only argument has to be a variable
+func predicateGroup(pformula *string) (result LogicalEvaluator, err error) {
+
+	predicate, _ := nextToken(pformula, true)
+
+	rest := *pformula
+	token, err := nextToken(pformula, true)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := token.tokenValue.(Variable)
+	if token.tokenType != variable || !ok {
+		return nil, newSyntaxError(rest, "A variable was expected")
+	}
+
+	rest = *pformula
+	if token, err = nextToken(pformula, true); err != nil || token.tokenType != closeParen {
+		return nil, newSyntaxError(rest, "A closing parenthesis was expected")
+	}
+
+	return ExistsExpression{string(name), predicate.tokenType == missing}, nil
+}
+
+// Return true if the parenthesized expression at the beginning of the given
+// formula is a term, i.e., if it is followed by either an arithmetic or a
+// relational operator, and false otherwise
+func isParenthesizedTerm(pformula string) bool {
+
+	depth, quoted := 0, false
+	for idx, char := range pformula {
+		switch {
+		case char == '\'':
+			quoted = !quoted
+		case quoted:
+		case char == '(':
+			depth += 1
+		case char == ')':
+			if depth -= 1; depth == 0 {
+				rest := pformula[1+idx:]
+				return reRelationalOperator.MatchString(rest) ||
+					(reArithmeticOperator.MatchString(rest) && !reVariable.MatchString(rest))
+			}
+		}
+	}
+	return false
+}
+
+// Return a logical evaluator that applies the given logical operator to the
+// logical evaluator in left and the one in right. Because formulae are parsed
+// from left to right, left contains all the preceding relational groups and
+// right is the last one. Thus, to handle precedence, the operator is applied
+// to the rightmost operand of left (recursively) as long as it is a logical
+// expression at the same depth whose operator has less precedence
+func combine(left LogicalEvaluator, operator LogicalOperator, right LogicalEvaluator, depth int) LogicalEvaluator {
+
+	expression, ok := left.(LogicalExpression)
+	if ok && expression.depth == depth && precedence[expression.root] < precedence[operator] {
+		return LogicalExpression{expression.root, depth,
+			[2]LogicalEvaluator{expression.children[0],
+				combine(expression.children[1], operator, right, depth)}}
+	}
+	return LogicalExpression{operator, depth, [2]LogicalEvaluator{left, right}}
+}
+
 // This function effectively parses the contents of the string given in pformula
 // and returns a valid LogicalEvaluator (ie., an expression that can be properly
 // evaluated) and nil if no errors were found or an invalid LogicalEvaluator and
@@ -517,33 +1409,9 @@ func Parse(pformula *string, depth int) (result LogicalEvaluator, err error) {
 				return nil, err
 			}
 
-			// handle the precedence of AND over OR. In case the
-			// previous logical evaluator was OR and this one is AND
-			// and they are both nested at the same depth, move AND
-			// below OR so that it is computed first
-
-			// therefore, check the previous expression was a
-			// logical expression. In case it was not, then a
-			// relational expression is assumed and, in this case,
-			// the check does not make sense
-			logExpression, ok := logEvaluator.(LogicalExpression)
-			if ok && logExpression.root == OR && logOperator == AND &&
-				logExpression.depth == depth {
-
-				// Yeah, the previous one was a logical
-				// expression with an OR and the last logical
-				// operator retrieved was AND so reorder the
-				// operators in the final logical evaluator
-				logEvaluator = LogicalExpression{logExpression.root, depth,
-					[2]LogicalEvaluator{logExpression.children[0],
-						LogicalExpression{logOperator, depth,
-							[2]LogicalEvaluator{logExpression.children[1],
-								rightEvaluator}}}}
-			} else {
-
-				logEvaluator = LogicalExpression{logOperator, depth,
-					[2]LogicalEvaluator{logEvaluator, rightEvaluator}}
-			}
+			// and combine both with the last logical operator
+			// taking into account its precedence
+			logEvaluator = combine(logEvaluator, logOperator, rightEvaluator, depth)
 		} else {
 
 			// otherwise, initialize the logEvaluator to the first
@@ -555,6 +1423,7 @@ func Parse(pformula *string, depth int) (result LogicalEvaluator, err error) {
 		}
 
 		// now, either we have end of formula or a logical operator
+		rest := *pformula
 		newToken, err := nextToken(pformula, true)
 		if err != nil {
 			return nil, err
@@ -569,7 +1438,7 @@ func Parse(pformula *string, depth int) (result LogicalEvaluator, err error) {
 			if depth == 0 {
 				break
 			} else {
-				return nil, errors.New("Unbalanced parenthesis")
+				return nil, newSyntaxError(rest, "Unbalanced parenthesis")
 			}
 		}
 
@@ -582,7 +1451,7 @@ func Parse(pformula *string, depth int) (result LogicalEvaluator, err error) {
 			if depth > 0 {
 				break
 			} else {
-				return nil, errors.New("Unbalanced parenthesis")
+				return nil, newSyntaxError(rest, "Unbalanced parenthesis")
 			}
 		}
 
@@ -593,8 +1462,10 @@ func Parse(pformula *string, depth int) (result LogicalEvaluator, err error) {
 			logOperator = AND
 		case or:
 			logOperator = OR
+		case xor:
+			logOperator = XOR
 		default:
-			log.Fatalf("A logical operator was expected just before %q", pformula)
+			return nil, newSyntaxError(rest, "A logical operator was expected")
 		}
 	}
 
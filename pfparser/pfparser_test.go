@@ -20,14 +20,17 @@ package pfparser
 
 import (
 	"log"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 // the following function parses the given pformula and evaluates it using the
 // specified symbol table. In case the result differs from the expected one, a
 // Fatal error is raised using the testing framework specified in t
 func assert(t *testing.T, pformula string,
-	symtable map[string]RelationalInterface, expected TypeBool) {
+	symtable map[string]RelationalInterface, expected LogicalInterface) {
 
 	var err error
 	var logicalEvaluator LogicalEvaluator
@@ -1105,6 +1108,427 @@ func TestVarStringParenthesized(t *testing.T) {
 	}
 }
 
+func TestFunctions(t *testing.T) {
+
+	// create a symbol table with a function that adds all its arguments and
+	// another one that returns the length of a string
+	symtable := map[string]RelationalInterface{
+		"ten": ConstInteger(10),
+		"Sum": Function(func(args []RelationalInterface) RelationalInterface {
+			var result ConstInteger
+			for _, arg := range args {
+				result += arg.(ConstInteger)
+			}
+			return result
+		}),
+		"Len": Function(func(args []RelationalInterface) RelationalInterface {
+			return ConstInteger(len(args[0].(ConstString)))
+		}),
+	}
+
+	expected := map[string]bool{
+		"%Sum() = 0":                                 true,
+		"%Sum(1) = 1":                                true,
+		"%Sum(1, 2, 3) = 6":                          true,
+		"%Sum(1,2) > 3":                              false,
+		"%Sum(%ten, 5) = 15":                         true,
+		"%Sum(%Sum(1, 2), %Len('abc')) = 6":          true,
+		"12 < %Sum(%ten, 1)":                         false,
+		"%Len('pgnparser') = 9 and %Sum(%ten) >= 10": true,
+		"(%Sum(1, 1) = 2 or %Len('a') = 2)":          true,
+	}
+
+	for expression, value := range expected {
+		assert(t, expression, symtable, TypeBool(value))
+	}
+
+	// and arguments which are not properly given are rejected
+	for _, expression := range []string{"%Sum(1 2) = 3", "%Sum(1, and) = 3"} {
+		if _, err := Parse(&expression, 0); err == nil {
+			t.Fatalf(" An error was expected in pformula %v", expression)
+		}
+	}
+}
+
+// Test the relational operators starts_with and contains, also with the
+// reserved variable moves
+func TestSequences(t *testing.T) {
+
+	symtable := map[string]RelationalInterface{
+		"name":  ConstString("Roberto"),
+		"moves": ConstString("e4 c5 Nf3"),
+	}
+
+	expected := map[string]bool{
+		"%name starts_with 'Rob'":                        true,
+		"%name starts_with 'rob'":                        false,
+		"%name contains 'bert'":                          true,
+		"%name contains 'Monica'":                        false,
+		"'Roberto' contains %name":                       true,
+		"moves starts_with 'e4 c5'":                      true,
+		"moves contains 'c5 Nf3' and %name != 'Dario'":   true,
+		"(moves contains 'd4' or moves starts_with 'e')": true,
+	}
+
+	for expression, value := range expected {
+		assert(t, expression, symtable, TypeBool(value))
+	}
+}
+
+// Test the logical operators not and xor and the precedence rules among all
+// logical operators, either in lowercase or uppercase letters
+func TestLogicalOperators(t *testing.T) {
+
+	symtable := map[string]RelationalInterface{
+		"var1": ConstInteger(3),
+		"var2": ConstInteger(7),
+	}
+
+	expected := map[string]bool{
+		"not %var1 = 3":                         false,
+		"NOT %var1 = 4":                         true,
+		"not (%var1 = 3 and %var2 = 7)":         false,
+		"not %var1 = 3 and %var2 = 7":           false,
+		"not not %var1 = 3":                     true,
+		"%var1 = 3 xor %var2 = 7":               false,
+		"%var1 = 3 XOR %var2 = 8":               true,
+		"%var1 = 4 xor %var2 = 8":               false,
+		"%var1 = 3 or %var2 = 7 xor %var1 = 3":  true,
+		"%var1 = 3 xor %var2 = 7 or %var1 = 3":  true,
+		"%var1 = 3 xor %var2 = 7 and %var1 = 4": true,
+		"%var1 = 3 and %var2 = 7 xor %var1 = 3": false,
+		"%var1 = 4 or %var1 = 3 and %var2 = 8 or %var2 = 7 and not %var1 = 4": true,
+		"(%var1 = 3 xor %var2 = 7) and %var1 = 3":                             false,
+		"%var1 = 3 xor (%var2 = 7 and %var1 = 4)":                             true,
+		"%var1 = 3 AND %var2 = 7 OR %var1 = 4":                                true,
+		"%var1 = 4 OR %var2 = 8 AND %var1 = 3":                                false,
+		"not (%var1 = 3 xor not %var2 = 8) or %var1 = 4":                      true,
+		"%var1 = 3 xor %var1 = 3 xor %var1 = 3":                               true,
+		"%var1 = 3 and (not %var2 = 7 or not (%var1 = 4 or %var2 = 8))":       true,
+	}
+
+	for expression, value := range expected {
+		assert(t, expression, symtable, TypeBool(value))
+	}
+}
+
+// Test arithmetic expressions over integer terms
+func TestArithmetic(t *testing.T) {
+
+	symtable := map[string]RelationalInterface{
+		"var1": ConstInteger(3),
+		"var2": ConstInteger(7),
+		"Sum": Function(func(args []RelationalInterface) RelationalInterface {
+			var result ConstInteger
+			for _, arg := range args {
+				result += arg.(ConstInteger)
+			}
+			return result
+		}),
+	}
+
+	expected := map[string]bool{
+		"%var2 - %var1 = 4":                          true,
+		"%var2-%var1 > 4":                            false,
+		"%var1 * %var2 + 1 = 22":                     true,
+		"%var1 + %var2 * 2 = 17":                     true,
+		"(%var1 + %var2) * 2 = 20":                   true,
+		"%var2 / 2 = 3":                              true,
+		"%var2 % %var1 = 1":                          true,
+		"%var1 - %var2 - 1 = -5":                     true,
+		"-%var1 = 0 - 3":                             true,
+		"- (%var1 - %var2) = 4":                      true,
+		"--%var1 = %var1":                            true,
+		"100 / %var2 / 2 = 7":                        true,
+		"(%var1 + 1) * 2 > 7 and %var2 = 7":          true,
+		"((%var1 + 1) * 2 > 8) or %var2 - 7 = 0":     true,
+		"(%var1 + 1 = 4)":                            true,
+		"not (%var1 + 1) * 2 = 8":                    false,
+		"%Sum(%var1 * 2, 1) = 7":                     true,
+		"%Sum(%var1, %var2) / 2 = %var2 - %var1 + 1": true,
+	}
+
+	for expression, value := range expected {
+		assert(t, expression, symtable, TypeBool(value))
+	}
+
+	// and wrong arithmetic expressions are rejected
+	for _, expression := range []string{"'abc' + 1 = 2", "%var1 + 'a' = 3",
+		"%var1 + = 3", "(%var1 + 1 = 4", "(%var1 + 1) * 2", "%var1 * (2 = 3)"} {
+		if _, err := Parse(&expression, 0); err == nil {
+			t.Fatalf(" An error was expected in pformula %v", expression)
+		}
+	}
+}
+
+// Test the relational operators with regular expressions
+func TestRegexp(t *testing.T) {
+
+	symtable := map[string]RelationalInterface{
+		"Event":    ConstString("Titled Arena Jan '24"),
+		"White":    ConstString("DrNykterstein"),
+		"WhiteElo": ConstInteger(3150),
+	}
+
+	expected := map[string]bool{
+		"%Event ~ '^Titled Arena'":                        true,
+		"%Event ~ '^Arena'":                               false,
+		"%Event !~ '^Arena'":                              true,
+		"%Event ~ 'titled'":                               false,
+		"%Event ~* 'titled'":                              true,
+		"%Event !~* 'TITLED'":                             false,
+		"%White ~ '^(DrNykterstein|DrDrunkenstein)$'":     true,
+		"%White ~ 'Dr.*stein' and not %White ~ '^Magnus'": true,
+		"%WhiteElo ~ '^3[0-9]{3}$'":                       true,
+		"%WhiteElo + 1 ~ '51$' or %Event ~ 'Blitz'":       true,
+		"(%White ~* 'nykter' xor %WhiteElo > 3000)":       false,
+	}
+
+	for expression, value := range expected {
+		assert(t, expression, symtable, TypeBool(value))
+	}
+
+	// and wrong regular expressions are rejected
+	for _, expression := range []string{"%Event ~ '(Titled'", "%Event ~ %White",
+		"%Event ~* 3"} {
+		if _, err := Parse(&expression, 0); err == nil {
+			t.Fatalf(" An error was expected in pformula %v", expression)
+		}
+	}
+}
+
+// Test comparisons of dates, times and time controls, including unknown
+// components, relative dates and the builtin functions over them
+func TestTypedValues(t *testing.T) {
+
+	// the current date is fixed to Saturday, May 7, 2016
+	now = func() time.Time { return time.Date(2016, 5, 7, 21, 7, 42, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	symtable := make(map[string]RelationalInterface)
+	symtable["Date"], _ = ParseDate("2016.04.20")
+	symtable["EventDate"], _ = ParseDate("2016.??.??")
+	symtable["UTCTime"], _ = ParseTime("21:07:42")
+	symtable["Time"], _ = ParseTime("09:??:??")
+	symtable["TimeControl"], _ = ParseTimeControl("180+2")
+	symtable["Classical"], _ = ParseTimeControl("40/5400+30:1800+30")
+	symtable["Untimed"], _ = ParseTimeControl("-")
+
+	expected := map[string]bool{
+		"%Date = '2016.04.20'":                                       true,
+		"%Date > '2016.04.01' and %Date < '2016.05.01'":              true,
+		"'2016.04.21' <= %Date":                                      false,
+		"%Date != '2016-04-21'":                                      true,
+		"'2016.04' in %Date":                                         true,
+		"%Date >= today-30d":                                         true,
+		"%Date >= today - 2w":                                        false,
+		"%Date + 17 = today":                                         true,
+		"3d + %Date < '2016.04.24'":                                  true,
+		"today - 7 = '2016.04.30'":                                   true,
+		"%EventDate > '2015.12.31'":                                  true,
+		"%EventDate < '2016.12.31'":                                  false,
+		"%EventDate >= '2016.12.31'":                                 false,
+		"%EventDate = '2016.??.??'":                                  false,
+		"%EventDate starts_with '2016.??'":                           true,
+		"%Year(%EventDate) = 2016 and %Month(%EventDate) < 0":        true,
+		"%Weekday(%Date) = 'Wednesday'":                              true,
+		"%Weekday(today) in 'Saturday Sunday'":                       true,
+		"%Weekday(%EventDate) = '?'":                                 true,
+		"%Day('2016.02.29') = 29":                                    true,
+		"%UTCTime > '21:00:00' and %Hour(%UTCTime) = 21":             true,
+		"%Minute(%UTCTime) = 7":                                      true,
+		"%Time < '10:00:00'":                                         true,
+		"%Time < '09:30:00' or %Time >= '09:30:00'":                  false,
+		"%TimeControl = '180+2'":                                     true,
+		"%TimeControl < '300+0'":                                     true,
+		"%TimeControl = 260 and %TimeControl < 480":                  true,
+		"%TimeControl > '260+0'":                                     false,
+		"%Base(%TimeControl) = 180 and %Increment(%TimeControl) = 2": true,
+		"%Classical > %TimeControl and %Base(%Classical) = 5400":     true,
+		"%Untimed < 100000 or %Untimed >= 100000":                    false,
+		"%Untimed = '-' or '+' in %TimeControl":                      true,
+		"%Untimed = '-' and not %Untimed = '?'":                      true,
+	}
+
+	for expression, value := range expected {
+		assert(t, expression, symtable, TypeBool(value))
+	}
+
+	// and values which are not correct are rejected
+	for _, text := range []string{"2016.13.01", "2016.4.20", "16.04.20", "today"} {
+		if _, err := ParseDate(text); err == nil {
+			t.Fatalf(" An error was expected in date %v", text)
+		}
+	}
+	for _, text := range []string{"24:00:00", "9:00:00"} {
+		if _, err := ParseTime(text); err == nil {
+			t.Fatalf(" An error was expected in time %v", text)
+		}
+	}
+	for _, text := range []string{"blitz", "+2", "180+"} {
+		if _, err := ParseTimeControl(text); err == nil {
+			t.Fatalf(" An error was expected in time control %v", text)
+		}
+	}
+}
+
+func TestOrder(t *testing.T) {
+
+	date := func(text string) RelationalInterface { value, _ := ParseDate(text); return value }
+	clock := func(text string) RelationalInterface { value, _ := ParseTime(text); return value }
+	control := func(text string) RelationalInterface { value, _ := ParseTimeControl(text); return value }
+
+	var orderTable = []struct {
+		left, right RelationalInterface
+		order       int
+		ok          bool
+	}{
+		{ConstInteger(3), ConstInteger(12), -1, true},
+		{ConstInteger(3), ConstInteger(3), 0, true},
+		{date("2016.05.07"), date("2015.12.31"), +1, true},
+		{date("2016.??.??"), date("2016.01.01"), -1, true},
+		{date("2016.??.??"), date("2016.??.??"), 0, true},
+		{clock("09:??:??"), clock("09:00:00"), -1, true},
+		{clock("21:07:42"), clock("09:30:00"), +1, true},
+		{control("60+0"), control("180+2"), -1, true},
+		{control("180+0"), control("60+3"), +1, true},
+		{control("-"), control("60+0"), -1, true},
+		{control("?"), control("-"), +1, true},
+		{ConstString("60+0"), ConstString("180+2"), 0, false},
+		{ConstInteger(3), ConstString("3"), 0, false},
+		{date("2016.05.07"), clock("09:00:00"), 0, false},
+	}
+
+	for _, tt := range orderTable {
+		if order, ok := Order(tt.left, tt.right); order != tt.order || ok != tt.ok {
+			t.Fatalf(" The order of %v and %v is (%v, %v) instead of (%v, %v)",
+				tt.left, tt.right, order, ok, tt.order, tt.ok)
+		}
+	}
+}
+
+func TestSets(t *testing.T) {
+
+	// write a roster and a list of ratings to be used with in_file
+	roster := filepath.Join(t.TempDir(), "roster.txt")
+	if err := os.WriteFile(roster, []byte("# squad\nalice\n\n  bob  \ncarol\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ratings := filepath.Join(t.TempDir(), "ratings.txt")
+	if err := os.WriteFile(ratings, []byte("1500\n2100\n-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	symtable := map[string]RelationalInterface{
+		"White":    ConstString("bob"),
+		"Black":    ConstString("dave"),
+		"WhiteElo": ConstInteger(2100),
+		"BlackElo": ConstInteger(-1),
+		"Date":     ConstDate{2016, 5, 7},
+	}
+
+	expected := map[string]bool{
+		"%White in_set ('alice','bob','carol')":                              true,
+		"%Black in_set ('alice', 'bob', 'carol')":                            false,
+		"%Black in_set ('dave')":                                             true,
+		"%White in_set ()":                                                   false,
+		"%WhiteElo in_set (1500, 2100)":                                      true,
+		"%WhiteElo - 100 in_set (1500, 2100)":                                false,
+		"%BlackElo in_set (-1, 0)":                                           true,
+		"not %Black in_set ('alice','bob') and %White in_set ('bob')":        true,
+		"(%White in_set ('bob') or %Black in_set ('bob'))":                   true,
+		"%Date in_set ('2016.05.06', '2016.05.07')":                          true,
+		"%White in_file '" + roster + "'":                                    true,
+		"%Black in_file '" + roster + "' or %White in_file '" + roster + "'": true,
+		"%Black in_file '" + roster + "'":                                    false,
+		"%WhiteElo in_file '" + ratings + "'":                                true,
+		"%BlackElo in_file '" + ratings + "' and %BlackElo < 0":              true,
+	}
+
+	for expression, value := range expected {
+		assert(t, expression, symtable, TypeBool(value))
+	}
+
+	// and wrong lists are rejected
+	for _, expression := range []string{"%White in_set 'alice'", "%White in_set ('alice' 'bob')",
+		"%White in_set ('alice', 3)", "%White in_set (%Black)", "%White in_set (-'alice')",
+		"%White in_set ('alice'", "%White in_file 'missing.txt'", "%White in_file %Black"} {
+		if _, err := Parse(&expression, 0); err == nil {
+			t.Fatalf(" An error was expected in pformula %v", expression)
+		}
+	}
+}
+
+func TestNullValues(t *testing.T) {
+
+	symtable := map[string]RelationalInterface{
+		"White":    ConstString("alice"),
+		"WhiteElo": ConstInteger(2100),
+		"Date":     ConstDate{2016, 5, 7},
+		"Empty":    ConstNull{},
+		"Rating":   ConstString("?"),
+	}
+
+	// relational groups over variables which do not exist are unknown, and
+	// logical operators follow the rules of three-valued logic
+	expected := map[string]LogicalInterface{
+		"%BlackElo > 2000":                                              TypeUnknown{},
+		"%BlackElo = %BlackElo":                                         TypeUnknown{},
+		"not %BlackElo > 2000":                                          TypeUnknown{},
+		"%BlackElo > 2000 and %WhiteElo > 2000":                         TypeUnknown{},
+		"%BlackElo > 2000 and %WhiteElo < 2000":                         TypeBool(false),
+		"%WhiteElo < 2000 and %BlackElo > 2000":                         TypeBool(false),
+		"%BlackElo > 2000 or %WhiteElo > 2000":                          TypeBool(true),
+		"%BlackElo > 2000 or %WhiteElo < 2000":                          TypeUnknown{},
+		"%BlackElo > 2000 xor %WhiteElo > 2000":                         TypeUnknown{},
+		"%WhiteElo - %BlackElo > 200":                                   TypeUnknown{},
+		"%WhiteElo - %Rating > 100":                                     TypeUnknown{},
+		"%Rating * 2 > 100 or %WhiteElo > 2000":                         TypeBool(true),
+		"%WhiteElo / 0 > 1":                                             TypeUnknown{},
+		"%WhiteElo % (%WhiteElo - 2100) = 0":                            TypeUnknown{},
+		"missing(%BlackElo) and %WhiteElo / 0 > 1":                      TypeUnknown{},
+		"%Rating > 2000":                                                TypeUnknown{},
+		"not %Rating > 2000":                                            TypeUnknown{},
+		"%WhiteElo = '?'":                                               TypeUnknown{},
+		"%WhiteElo = %Rating or %White = 'alice'":                       TypeBool(true),
+		"%Rating = '?'":                                                 TypeBool(true),
+		"%WhiteElo in '2100 2200'":                                      TypeUnknown{},
+		"%WhiteElo contains '21'":                                       TypeUnknown{},
+		"%Rating in_set (2000, 2100)":                                   TypeUnknown{},
+		"%Rating in_set ('-', '?')":                                     TypeBool(true),
+		"%Date ~ '^2016'":                                               TypeBool(true),
+		"%Date > 2000":                                                  TypeUnknown{},
+		"%Year(%WhiteElo) = 2016":                                       TypeUnknown{},
+		"%Hour(%Date) < 12 or %Year(%Date) = 2016":                      TypeBool(true),
+		"%Black ~ '^alice$'":                                            TypeUnknown{},
+		"%Black in_set ('alice', 'bob')":                                TypeUnknown{},
+		"%Year(%UTCDate) = 2016":                                        TypeUnknown{},
+		"%Year(%Date) = 2016":                                           TypeBool(true),
+		"%BlackMaterial(10) > 0":                                        TypeUnknown{},
+		"%Empty = 'alice'":                                              TypeUnknown{},
+		"exists(%White)":                                                TypeBool(true),
+		"exists(%Black)":                                                TypeBool(false),
+		"exists(%Empty)":                                                TypeBool(false),
+		"missing(%Black)":                                               TypeBool(true),
+		"not missing(%White)":                                           TypeBool(true),
+		"missing(%Black) or %BlackElo > 2000":                           TypeBool(true),
+		"exists(%BlackElo) and %BlackElo > 2000":                        TypeBool(false),
+		"(missing(%BlackElo) or %BlackElo < 2000) and %White = 'alice'": TypeBool(true),
+	}
+
+	for expression, value := range expected {
+		assert(t, expression, symtable, value)
+	}
+
+	// and predicates can only be applied to variables
+	for _, expression := range []string{"exists('alice')", "exists(%White = 'alice')",
+		"missing(%White", "exists(%Year(%Date))"} {
+		if _, err := Parse(&expression, 0); err == nil {
+			t.Fatalf(" An error was expected in pformula %v", expression)
+		}
+	}
+}
+
 /* Local Variables: */
 /* mode:go */
 /* fill-column:80 */
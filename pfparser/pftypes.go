@@ -0,0 +1,564 @@
+/*
+  pftypes.go
+  Description: Typed values (dates, times and time controls) that can be used
+  in propositional formulae
+*/
+
+package pfparser
+
+import (
+	"errors"  // for signaling errors
+	"fmt"     // Sprintf
+	"regexp"  // typed values are parsed with regexps
+	"strconv" // Atoi
+	"strings" // Compare
+	"time"    // dates and weekdays
+)
+
+// global variables
+// ----------------------------------------------------------------------------
+
+// dates are given as year, month and day separated by dots (or dashes) where
+// any component can be unknown
+var reDate = regexp.MustCompile(`^(?P<year>[0-9]{4}|\?{4})[.-](?P<month>[0-9]{2}|\?{2})[.-](?P<day>[0-9]{2}|\?{2})$`)
+
+// times are given as hours, minutes and seconds separated by colons where any
+// component can be unknown
+var reTime = regexp.MustCompile(`^(?P<hour>[0-9]{2}|\?{2}):(?P<minute>[0-9]{2}|\?{2}):(?P<second>[0-9]{2}|\?{2})$`)
+
+// time controls consist of an optional number of moves, the base time in
+// seconds (which might be preceded by '*' for sandclocks) and an optional
+// increment. Only the first period of time controls with several periods
+// (separated by ':') is considered
+var reTimeControl = regexp.MustCompile(`^(?:(?P<moves>[0-9]+)/)?\*?(?P<base>[0-9]+)(?:\+(?P<increment>[0-9]+))?(?::.*)?$`)
+
+// the current time is taken from the following function so that it can be
+// modified in tests
+var now = time.Now
+
+// the following map stores the functions which are available in all
+// propositional formulae. Functions stored in the symbol table with the same
+// name take precedence over them
+var builtins = map[string]Function{
+	"Year":      dateFunction(func(date ConstDate) RelationalInterface { return ConstInteger(date.year) }),
+	"Month":     dateFunction(func(date ConstDate) RelationalInterface { return ConstInteger(date.month) }),
+	"Day":       dateFunction(func(date ConstDate) RelationalInterface { return ConstInteger(date.day) }),
+	"Weekday":   dateFunction(ConstDate.weekday),
+	"Hour":      timeFunction(func(value ConstTime) RelationalInterface { return ConstInteger(value.hour) }),
+	"Minute":    timeFunction(func(value ConstTime) RelationalInterface { return ConstInteger(value.minute) }),
+	"Base":      timeControlFunction(func(control ConstTimeControl) RelationalInterface { return ConstInteger(control.base) }),
+	"Increment": timeControlFunction(func(control ConstTimeControl) RelationalInterface { return ConstInteger(control.increment) }),
+}
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// Dates consist of a year, month and day. Unknown components are represented
+// with -1
+type ConstDate struct {
+	year, month, day int
+}
+
+// Times consist of hours, minutes and seconds. Unknown components are
+// represented with -1
+type ConstTime struct {
+	hour, minute, second int
+}
+
+// Time controls consist of the number of moves of the first period (0 if the
+// base time is given for the whole game), the base time and the increment in
+// seconds. Unknown time controls (such as '?' or '-') are represented with a
+// negative base. Besides, the original text is kept to use string operators
+type ConstTimeControl struct {
+	moves, base, increment int
+	text                   string
+}
+
+// Typed values can be compared with string constants which are parsed with
+// the following interface. Strings which can not be parsed are compared with
+// the textual representation of typed values
+type typedInterface interface {
+	parse(text string) (RelationalInterface, error)
+	String() string
+}
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// atoi is a helper function that returns the integer in the given string, or
+// -1 if it is unknown, i.e., if it consists of question marks
+func atoi(text string) int {
+
+	value, err := strconv.Atoi(text)
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+// Return the date in the given string which consists of the year, month and
+// day separated by dots, e.g., '2016.05.07'. Unknown components are given with
+// question marks, e.g., '2016.??.??'. It returns an error if the date is not
+// correct
+func ParseDate(text string) (ConstDate, error) {
+
+	tag := reDate.FindStringSubmatch(text)
+	if tag == nil {
+		return ConstDate{}, errors.New(fmt.Sprintf("'%v' is not a correct date", text))
+	}
+	date := ConstDate{atoi(tag[1]), atoi(tag[2]), atoi(tag[3])}
+	if date.month == 0 || date.month > 12 || date.day == 0 || date.day > 31 {
+		return ConstDate{}, errors.New(fmt.Sprintf("'%v' is not a correct date", text))
+	}
+	return date, nil
+}
+
+// Return the time in the given string which consists of hours, minutes and
+// seconds separated by colons, e.g., '21:07:42'. Unknown components are given
+// with question marks. It returns an error if the time is not correct
+func ParseTime(text string) (ConstTime, error) {
+
+	tag := reTime.FindStringSubmatch(text)
+	if tag == nil {
+		return ConstTime{}, errors.New(fmt.Sprintf("'%v' is not a correct time", text))
+	}
+	value := ConstTime{atoi(tag[1]), atoi(tag[2]), atoi(tag[3])}
+	if value.hour > 23 || value.minute > 59 || value.second > 59 {
+		return ConstTime{}, errors.New(fmt.Sprintf("'%v' is not a correct time", text))
+	}
+	return value, nil
+}
+
+// Return the time control in the given string in any of the forms acknowledged
+// by the PGN standard: '?' (unknown), '-' (none), '40/9000' (moves per
+// period), '300+2' (sudden death with increment) or '*180' (sandclock). Time
+// controls with several periods separated by ':' are acknowledged as well,
+// though only the first period is considered. It returns an error if the time
+// control is not correct
+func ParseTimeControl(text string) (ConstTimeControl, error) {
+
+	if text == "?" || text == "-" {
+		return ConstTimeControl{0, -1, 0, text}, nil
+	}
+	tag := reTimeControl.FindStringSubmatch(text)
+	if tag == nil {
+		return ConstTimeControl{}, errors.New(fmt.Sprintf("'%v' is not a correct time control", text))
+	}
+	control := ConstTimeControl{0, atoi(tag[2]), 0, text}
+	if tag[1] != "" {
+		control.moves = atoi(tag[1])
+	}
+	if tag[3] != "" {
+		control.increment = atoi(tag[3])
+	}
+	return control, nil
+}
+
+// Return the current date
+func today() ConstDate {
+
+	year, month, day := now().Date()
+	return ConstDate{year, int(month), day}
+}
+
+// compare is a helper function that compares the components given in left and
+// right in the same order they are given. It returns -1, 0 or +1 if left is
+// less, equal or greater than right and true. If the result depends on any
+// unknown component (-1), the second value returned is false
+func compare(left, right []int) (int, bool) {
+
+	for idx := range left {
+		if left[idx] < 0 || right[idx] < 0 {
+			return 0, false
+		}
+		if left[idx] < right[idx] {
+			return -1, true
+		}
+		if left[idx] > right[idx] {
+			return +1, true
+		}
+	}
+	return 0, true
+}
+
+// Return -1, 0 or +1 if left goes before, along with or after right when
+// sorting values and true, or false if they are not integers, dates, times or
+// time controls of the same type. Unlike Less, all values are ordered: unknown
+// components go before known ones, e.g., '2016.??.??' goes before
+// '2016.01.01', and unknown time controls go before known ones. Time controls
+// are ordered by their estimated duration and then by their base time
+func Order(left, right RelationalInterface) (int, bool) {
+
+	var lcomponents, rcomponents []int
+	switch lvalue := left.(type) {
+	case ConstInteger:
+		rvalue, ok := right.(ConstInteger)
+		if !ok {
+			return 0, false
+		}
+		lcomponents, rcomponents = []int{int(lvalue)}, []int{int(rvalue)}
+	case ConstDate:
+		rvalue, ok := right.(ConstDate)
+		if !ok {
+			return 0, false
+		}
+		lcomponents = []int{lvalue.year, lvalue.month, lvalue.day}
+		rcomponents = []int{rvalue.year, rvalue.month, rvalue.day}
+	case ConstTime:
+		rvalue, ok := right.(ConstTime)
+		if !ok {
+			return 0, false
+		}
+		lcomponents = []int{lvalue.hour, lvalue.minute, lvalue.second}
+		rcomponents = []int{rvalue.hour, rvalue.minute, rvalue.second}
+	case ConstTimeControl:
+		rvalue, ok := right.(ConstTimeControl)
+		if !ok {
+			return 0, false
+		}
+		lcomponents = []int{lvalue.getDuration(), lvalue.base, lvalue.increment, lvalue.moves}
+		rcomponents = []int{rvalue.getDuration(), rvalue.base, rvalue.increment, rvalue.moves}
+		if lvalue.base < 0 && rvalue.base < 0 {
+			return strings.Compare(lvalue.text, rvalue.text), true
+		}
+	default:
+		return 0, false
+	}
+
+	// unknown components are -1 and hence they go before all known values
+	for idx := range lcomponents {
+		if lcomponents[idx] < rcomponents[idx] {
+			return -1, true
+		}
+		if lcomponents[idx] > rcomponents[idx] {
+			return +1, true
+		}
+	}
+	return 0, true
+}
+
+// parseOperand is a helper function that returns the value of the given operand
+// as a value of the same type of the given typed value if it is a string
+// constant that can be parsed. Otherwise, the operand is returned as it is
+func parseOperand(typed typedInterface, right RelationalInterface) RelationalInterface {
+
+	if value, ok := right.(ConstString); ok {
+		if result, err := typed.parse(string(value)); err == nil {
+			return result
+		}
+	}
+	return right
+}
+
+// dateFunction is a helper function that returns a builtin function that
+// applies the given function to its only argument which has to be a date. Its
+// value is null if it is given any other value
+func dateFunction(apply func(date ConstDate) RelationalInterface) Function {
+
+	return func(args []RelationalInterface) RelationalInterface {
+		if len(args) != 1 {
+			return ConstNull{}
+		}
+		// strings which can not be parsed are unknown values
+		operand := parseOperand(ConstDate{}, args[0])
+		if _, ok := operand.(ConstString); ok {
+			return apply(ConstDate{-1, -1, -1})
+		}
+		date, ok := operand.(ConstDate)
+		if !ok {
+			return ConstNull{}
+		}
+		return apply(date)
+	}
+}
+
+// timeFunction is a helper function that returns a builtin function that
+// applies the given function to its only argument which has to be a time. Its
+// value is null if it is given any other value
+func timeFunction(apply func(value ConstTime) RelationalInterface) Function {
+
+	return func(args []RelationalInterface) RelationalInterface {
+		if len(args) != 1 {
+			return ConstNull{}
+		}
+		// strings which can not be parsed are unknown values
+		operand := parseOperand(ConstTime{}, args[0])
+		if _, ok := operand.(ConstString); ok {
+			return apply(ConstTime{-1, -1, -1})
+		}
+		value, ok := operand.(ConstTime)
+		if !ok {
+			return ConstNull{}
+		}
+		return apply(value)
+	}
+}
+
+// timeControlFunction is a helper function that returns a builtin function that
+// applies the given function to its only argument which has to be a time
+// control. Its value is null if it is given any other value
+func timeControlFunction(apply func(control ConstTimeControl) RelationalInterface) Function {
+
+	return func(args []RelationalInterface) RelationalInterface {
+		if len(args) != 1 {
+			return ConstNull{}
+		}
+		// strings which can not be parsed are unknown values
+		operand := parseOperand(ConstTimeControl{}, args[0])
+		if _, ok := operand.(ConstString); ok {
+			return apply(ConstTimeControl{0, -1, 0, "?"})
+		}
+		control, ok := operand.(ConstTimeControl)
+		if !ok {
+			return ConstNull{}
+		}
+		return apply(control)
+	}
+}
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// Return the date in the given string, see ParseDate
+func (date ConstDate) parse(text string) (RelationalInterface, error) {
+	return ParseDate(text)
+}
+
+// Return the time in the given string, see ParseTime
+func (value ConstTime) parse(text string) (RelationalInterface, error) {
+	return ParseTime(text)
+}
+
+// Return the time control in the given string, see ParseTimeControl
+func (control ConstTimeControl) parse(text string) (RelationalInterface, error) {
+	return ParseTimeControl(text)
+}
+
+// Return the date in the same format used in PGN files
+func (date ConstDate) String() string {
+
+	text := func(value, width int) string {
+		if value < 0 {
+			return fmt.Sprintf("%.*s", width, "????")
+		}
+		return fmt.Sprintf("%0*d", width, value)
+	}
+	return text(date.year, 4) + "." + text(date.month, 2) + "." + text(date.day, 2)
+}
+
+// Return the time in the same format used in PGN files
+func (value ConstTime) String() string {
+
+	text := func(value int) string {
+		if value < 0 {
+			return "??"
+		}
+		return fmt.Sprintf("%02d", value)
+	}
+	return text(value.hour) + ":" + text(value.minute) + ":" + text(value.second)
+}
+
+// Return the time control as it was given
+func (control ConstTimeControl) String() string {
+	return control.text
+}
+
+// isKnown returns true if all components of this date are known
+func (date ConstDate) isKnown() bool {
+	return date.year >= 0 && date.month >= 0 && date.day >= 0
+}
+
+// getTime returns this date as an instance of time.Time. It assumes that all
+// its components are known
+func (date ConstDate) getTime() time.Time {
+	return time.Date(date.year, time.Month(date.month), date.day, 0, 0, 0, 0, time.UTC)
+}
+
+// weekday returns the name of the day of the week of this date in English, or
+// '?' if any of its components is unknown
+func (date ConstDate) weekday() RelationalInterface {
+
+	if !date.isKnown() {
+		return ConstString("?")
+	}
+	return ConstString(date.getTime().Weekday().String())
+}
+
+// shift returns the date that results from adding the given number of days to
+// this date. Dates with unknown components are unknown after being shifted
+func (date ConstDate) shift(days ConstInteger) ConstDate {
+
+	if !date.isKnown() {
+		return ConstDate{-1, -1, -1}
+	}
+	year, month, day := date.getTime().AddDate(0, 0, int(days)).Date()
+	return ConstDate{year, int(month), day}
+}
+
+// Compare this date with the one specified in right (which can be also given as
+// a string) and return whether the first is before the second. If this can
+// not be decided because of unknown components, false is returned
+func (date ConstDate) Less(right RelationalInterface) TypeBool {
+
+	value, ok := parseOperand(date, right).(ConstDate)
+	if !ok {
+		return ConstString(date.String()).Less(right)
+	}
+
+	result, known := compare([]int{date.year, date.month, date.day},
+		[]int{value.year, value.month, value.day})
+	return TypeBool(known && result < 0)
+}
+
+// Compare this date with the one specified in right (which can be also given as
+// a string) and return whether both are the same day. If this can not be
+// decided because of unknown components, false is returned
+func (date ConstDate) Equal(right RelationalInterface) TypeBool {
+
+	value, ok := parseOperand(date, right).(ConstDate)
+	if !ok {
+		return ConstString(date.String()).Equal(right)
+	}
+
+	result, known := compare([]int{date.year, date.month, date.day},
+		[]int{value.year, value.month, value.day})
+	return TypeBool(known && result == 0)
+}
+
+// Dates are used as strings with in, see ConstString
+func (date ConstDate) In(right RelationalInterface) TypeBool {
+	return ConstString(date.String()).In(right)
+}
+
+// Dates are used as strings with starts_with, see ConstString
+func (date ConstDate) StartsWith(right RelationalInterface) TypeBool {
+	return ConstString(date.String()).StartsWith(right)
+}
+
+// Dates are used as strings with contains, see ConstString
+func (date ConstDate) Contains(right RelationalInterface) TypeBool {
+	return ConstString(date.String()).Contains(right)
+}
+
+// The evaluation of a date returns the same date
+func (date ConstDate) Evaluate(symtable map[string]RelationalInterface) RelationalInterface {
+	return date
+}
+
+// Compare this time with the one specified in right (which can be also given as
+// a string) and return whether the first is before the second. If this can
+// not be decided because of unknown components, false is returned
+func (value ConstTime) Less(right RelationalInterface) TypeBool {
+
+	other, ok := parseOperand(value, right).(ConstTime)
+	if !ok {
+		return ConstString(value.String()).Less(right)
+	}
+
+	result, known := compare([]int{value.hour, value.minute, value.second},
+		[]int{other.hour, other.minute, other.second})
+	return TypeBool(known && result < 0)
+}
+
+// Compare this time with the one specified in right (which can be also given as
+// a string) and return whether both are the same. If this can not be decided
+// because of unknown components, false is returned
+func (value ConstTime) Equal(right RelationalInterface) TypeBool {
+
+	other, ok := parseOperand(value, right).(ConstTime)
+	if !ok {
+		return ConstString(value.String()).Equal(right)
+	}
+
+	result, known := compare([]int{value.hour, value.minute, value.second},
+		[]int{other.hour, other.minute, other.second})
+	return TypeBool(known && result == 0)
+}
+
+// Times are used as strings with in, see ConstString
+func (value ConstTime) In(right RelationalInterface) TypeBool {
+	return ConstString(value.String()).In(right)
+}
+
+// Times are used as strings with starts_with, see ConstString
+func (value ConstTime) StartsWith(right RelationalInterface) TypeBool {
+	return ConstString(value.String()).StartsWith(right)
+}
+
+// Times are used as strings with contains, see ConstString
+func (value ConstTime) Contains(right RelationalInterface) TypeBool {
+	return ConstString(value.String()).Contains(right)
+}
+
+// getDuration returns the estimated duration in seconds of a game played with
+// this time control assuming it lasts 40 moves, or -1 if it is unknown
+func (control ConstTimeControl) getDuration() int {
+
+	if control.base < 0 {
+		return -1
+	}
+	return control.base + 40*control.increment
+}
+
+// Compare this time control with the one specified in right (which can be also
+// given as a string or as an integer number of seconds) and return whether the
+// estimated duration of the first is less than the second. Time controls with
+// the same estimated duration are sorted by their base time. If any time
+// control is unknown false is returned
+func (control ConstTimeControl) Less(right RelationalInterface) TypeBool {
+
+	if seconds, ok := right.(ConstInteger); ok {
+		return TypeBool(control.base >= 0 && control.getDuration() < int(seconds))
+	}
+	other, ok := parseOperand(control, right).(ConstTimeControl)
+	if !ok {
+		return ConstString(control.String()).Less(right)
+	}
+
+	result, known := compare([]int{control.getDuration(), control.base},
+		[]int{other.getDuration(), other.base})
+	return TypeBool(known && result < 0)
+}
+
+// Compare this time control with the one specified in right (which can be also
+// given as a string or as an integer number of seconds) and return whether both
+// are the same. Integers are compared with the estimated duration. Unknown time
+// controls ('?') and games without time control ('-') are equal only to the
+// same text
+func (control ConstTimeControl) Equal(right RelationalInterface) TypeBool {
+
+	if seconds, ok := right.(ConstInteger); ok {
+		return TypeBool(control.base >= 0 && control.getDuration() == int(seconds))
+	}
+	other, ok := parseOperand(control, right).(ConstTimeControl)
+	if !ok {
+		return ConstString(control.String()).Equal(right)
+	}
+	if control.base < 0 || other.base < 0 {
+		return TypeBool(control.text == other.text)
+	}
+
+	result, known := compare([]int{control.base, control.increment, control.moves},
+		[]int{other.base, other.increment, other.moves})
+	return TypeBool(known && result == 0)
+}
+
+// Time controls are used as strings with in, see ConstString
+func (control ConstTimeControl) In(right RelationalInterface) TypeBool {
+	return ConstString(control.text).In(right)
+}
+
+// Time controls are used as strings with starts_with, see ConstString
+func (control ConstTimeControl) StartsWith(right RelationalInterface) TypeBool {
+	return ConstString(control.text).StartsWith(right)
+}
+
+// Time controls are used as strings with contains, see ConstString
+func (control ConstTimeControl) Contains(right RelationalInterface) TypeBool {
+	return ConstString(control.text).Contains(right)
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
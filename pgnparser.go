@@ -21,10 +21,12 @@ package main
 // imports
 // ----------------------------------------------------------------------------
 import (
-	"flag" // arg parsing
-	"fmt"  // printing msgs
-	"log"  // logging services
-	"os"   // operating system services
+	"errors"  // inspecting errors
+	"flag"    // arg parsing
+	"fmt"     // printing msgs
+	"log"     // logging services
+	"os"      // operating system services
+	"strings" // string manipulation
 
 	// import a package to manage paths
 	"github.com/clinaresl/pgnparser/fstools"
@@ -38,15 +40,33 @@ import (
 var VERSION string = "0.1.0" // current version
 var EXIT_SUCCESS int = 0     // exit with success
 var EXIT_FAILURE int = 1     // exit with failure
+var EXIT_SYNTAX int = 2      // exit with a syntax error in the pgn file
+var EXIT_TAG int = 3         // exit with a missing or malformed tag
+var EXIT_MOVE int = 4        // exit with a move that can not be reproduced
+var EXIT_QUERY int = 5       // exit with an error in the query, sort string or position
+var EXIT_TEMPLATE int = 6    // exit with an error in a template
+var EXIT_IO int = 7          // exit with an input/output error
+
+// the following map stores the modes acknowledged to search for positions
+var positionModes = map[string]pgntools.PositionMode{
+	"full":      pgntools.FullPosition,
+	"placement": pgntools.PiecePlacement,
+	"pattern":   pgntools.PiecePattern,
+}
 
 // Options
 var pgnfile string       // base directory
 var showboard int = 0    // number of moves between boards
 var tableTemplate string // file with the table template
 var latexTemplate string // file with the latex template
+var outputPgn string     // file where games are written in PGN format
 var query string         // select query to filter games
 var sort string          // sorting descriptor
 var histogram string     // histogram descriptor
+var position string      // FEN string of the position to search for
+var positionMode string  // how positions are matched
+var strict bool          // are moves validated?
+var lenient bool         // are malformed games skipped?
 
 var helpExpressions bool // is help on expressions requested?
 var helpSort bool        // is help on sorting requested?
@@ -72,6 +92,9 @@ func init() {
 	// Flag to store the file with the LaTeX template
 	flag.StringVar(&latexTemplate, "latex", "", "file with a LaTeX template to use. If given, a file with the same name used in 'file' and extension '.tex' is automatically generated in the same directory where the pgn file resides. For more information on how to create and use LaTeX templates see the documentation")
 
+	// Flag to store the file where games are written in PGN format
+	flag.StringVar(&outputPgn, "output-pgn", "", "if a file is given here, all games (after being filtered with --select and sorted with --sort) are written to it in PGN export format. The file must not exist")
+
 	// Flag to receive a select query
 	flag.StringVar(&query, "select", "", "if an expression is provided here, only games meeting it are accepted. For more information on expressions acknowledged by this directive use '--help-expressions'")
 	flag.BoolVar(&helpExpressions, "help-expressions", false, "if given, additional information on expressions acknowledged by this application is provided")
@@ -84,6 +107,16 @@ func init() {
 	flag.StringVar(&histogram, "histogram", "", "if a string is given here, a histogram with the information requested is generated. For more information on how to specify histograms use '--help-histogram'")
 	flag.BoolVar(&helpHistogram, "help-histogram", false, "if given, additional information on how histograms are specified is provided")
 
+	// Flags to search for positions
+	flag.StringVar(&position, "position", "", "if a FEN string is given here, only games that reached this position (whatever the move order) are accepted, and the plies where it was reached are shown")
+	flag.StringVar(&positionMode, "position-mode", "full", "how positions given with '--position' are matched: 'full' compares the piece placement, side to move, castling ability and en passant captures; 'placement' compares only the piece placement; 'pattern' accepts positions where the pieces given in the placement are on the same squares, e.g., '8/8/8/8/3PP3/8/8/8' for white pawns on d4 and e4")
+
+	// Flag to validate all moves against the rules of chess
+	flag.BoolVar(&strict, "strict", false, "if given, all moves are verified to be legal according to the rules of chess and games with illegal moves are rejected")
+
+	// Flag to process malformed games in lenient mode
+	flag.BoolVar(&lenient, "lenient", false, "if given, games that can not be parsed are skipped and games with moves that can not be reproduced are truncated at the last legal move. A summary of all problems found is shown at the end. It can not be used together with --strict")
+
 	// other optional parameters are verbose and version
 	flag.BoolVar(&verbose, "verbose", false, "provides verbose output")
 	flag.BoolVar(&version, "version", false, "shows version info and exists")
@@ -101,32 +134,117 @@ func showVersion(signal int) {
 // --select
 func showExpressions(signal int) {
 
-	fmt.Println(` 
+	fmt.Printf("%v", ` 
  Expressions are a powerful mechanism to filter games in a PGN file. They consist of
  logical expressions made of relational groups. 
 
  A relational group consists of two terms related by any of the relational operators 
 
-                        <=, <, =, !=, >, >=, in, not_in
+         <=, <, =, !=, >, >=, in, not_in, starts_with, contains, ~, !~, ~*, !~*,
+         in_set, in_file
 
  where a term can be either a constant or a variable. 'in' and 'not_in' can be
  used only with string constants and they serve to verify whether the left term
- is a substring (or not) of the right term. 
+ is a substring (or not) of the right term. 'starts_with' and 'contains' verify
+ whether the right term is a prefix or a substring of the left term. 
+
+ '~' and '!~' verify whether the left term matches (or not) the regular
+ expression given in the right term, which has to be a string constant, e.g.,
+ "%Event ~ '^Titled Arena'" or "%White ~ '^(clinares|clinaresl)$'". '~*' and
+ '!~*' do the same but ignoring case. The syntax of regular expressions is
+ described in https://golang.org/s/re2syntax
+
+ 'in_set' verifies whether the left term is equal to any of the integer or string
+ constants given in a parenthesized list separated by commas, e.g., "%White
+ in_set ('alice', 'bob', 'carol')", and 'in_file' does the same with the lines of
+ the file given in the right term, e.g., "%White in_file 'roster.txt'", where
+ empty lines and those starting with '#' are ignored. Lines are taken as integers
+ only if all of them are integers
+
+ They are also used with the reserved word 'moves' (not preceded by '%') to
+ match the moves of the mainline, e.g., "moves starts_with '1. e4 c5 2. Nf3 d6'"
+ or "moves contains 'Bxh7+'". Moves are compared in SAN and move numbers and
+ annotations are ignored, so that they can be given or not. Besides, checks are
+ ignored unless they are explicitly given, so that 'Bxh7' matches 'Bxh7+'.
 
  Constants can be either integer (such as 40) or strings (such as '1-0'). Note
  that strings have to be single quoted. Variables are preceded by the character
  '%'. Any tag appearing in the header of a PGN game can be used as a variable
  such as '%White' or '%WhiteElo'.
 
+ Besides, replaying the moves of every game computes additional variables. Some
+ of them hold the first ply where something happened, or 0 if it never did:
+ '%ThreefoldRepetition', '%InsufficientMaterial', '%OppositeBishops' (an ending
+ with opposite-coloured bishops was reached), '%QueensTraded' (no queens are left)
+ or '%Promotion'. '%WhiteCastling' and '%BlackCastling' are either 'O-O', 'O-O-O'
+ or '-'. Finally, functions take a list of terms separated by commas between
+ parenthesis, such as '%Material(40)' which returns the difference of material
+ between white and black after 40 plies. '%WhiteMaterial' and '%BlackMaterial'
+ return instead the material of each side, where pawns are worth 1, knights and
+ bishops 3, rooks 5 and queens 9.
+
+ Computed fields can be used as variables as well: '%Moves', '%Result' (a utf-8
+ string in tables), '%Variations', '%EloDiff' (white's rating minus black's),
+ '%OpeningFamily' (the tag 'Opening' without variations, or the volume of its
+ ECO code), '%Winner' and '%Loser' (the names of the players, or '-' if it was
+ drawn), '%Duration' (the sum of the elapsed move times in seconds),
+ '%FinalFEN', '%Captures' and '%Checks'. '%PlayerColor' is used as a function
+ whose argument is the name of a player, e.g., "%PlayerColor('clinares') =
+ 'Black'", and it is '-' if the player did not play the game. Fields that can
+ not be computed are missing and tags with the same name take precedence.
+
+ The tags 'Date', 'UTCDate' and 'EventDate', 'Time' and 'UTCTime' and
+ 'TimeControl' are compared as dates, times and time controls instead of
+ strings, e.g., "%Date >= '2016.01.01' and %UTCTime < '12:00:00'". Components
+ given as '??' are unknown so that comparisons that depend on them are false,
+ e.g., '2016.??.??' is after '2015.12.31' but it is neither before nor after
+ '2016.06.01'. The current date is given with 'today' and dates can be shifted
+ any number of days (d) or weeks (w), e.g., "%Date >= today-30d". Time controls
+ are compared with their estimated duration in seconds (the base time plus 40
+ times the increment), e.g., "%TimeControl < 480". Finally, the following
+ functions extract components of these values: %Year, %Month, %Day, %Weekday
+ (its name in English, e.g., 'Sunday'), %Hour, %Minute, %Base and %Increment,
+ e.g., "%Weekday(%Date) in 'Saturday Sunday'". Unknown components are -1. They
+ take exactly one argument and they are null if it has a different type.
+
+ Integer terms can be combined in arithmetic expressions with the operators
+ +, -, *, / (integer division) and % (remainder), where * / and % have precedence
+ over + and -, e.g., "%WhiteElo - %BlackElo > 200" or "%PlyCount / 2 >= 40".
+ Unary minus and parenthesis can be used as well. Note that % has to be followed
+ by a blank space to distinguish it from variables. Arithmetic operators can not
+ be applied to string constants, and their result is null when applied to tags
+ whose value is not an integer (e.g., [WhiteElo "?"]) and in case of a division
+ by zero.
+
  Logical expressions consist of relational groups related by any of the logical 
  operators:
 
-                                  and, or
+                                  and, xor, or
 
- where 'and' has precedence over 'or'. To modify the precedence rules, parenthesis
- can be freely used. 
+ where 'and' has precedence over 'xor' which has precedence over 'or'. Besides,
+ any relational group or parenthesized expression can be negated with 'not',
+ which applies only to the group that immediately follows it. To modify the
+ precedence rules, parenthesis can be freely used. 
 
- Note that the names of variables and the logical operators are case sensitive.
+ Note that the names of variables are case sensitive, whereas the logical
+ operators can be written either in lowercase (and) or uppercase (AND) letters.
+
+ Variables which are not defined in a game, e.g., tags which are missing, are
+ null. Relational groups over null values are unknown and logical operators
+ follow the rules of three-valued logic, so that "%FICSGamesDBGameNo > 0 and
+ %WhiteElo > 2000" is false but "%FICSGamesDBGameNo > 0 or %WhiteElo > 2000" is
+ true in games without 'FICSGamesDBGameNo' and a rating above 2000. Note that
+ the negation of unknown is unknown as well. So are comparisons between integers
+ and strings, e.g., "%WhiteElo > 2000" in games with [WhiteElo "?"]. Games are
+ accepted only if the query is true. To deal with missing tags explicitly use
+ the predicates 'exists' and 'missing', e.g., "missing(%FICSGamesDBGameNo) or %FICSGamesDBGameNo > 1000".
+
+ Queries are compiled before reading any game. Syntax errors and type errors
+ that can be detected before evaluating the query, such as comparing an integer
+ with a string constant, are reported along with the column where they were
+ found, which is shown with a caret under the offending token. Variables and
+ functions which are not defined in any game are reported once all games have
+ been read.
 
 
  Examples:
@@ -153,6 +271,12 @@ func showExpressions(signal int) {
 
  which returns 1229 games.
 
+ To know how many games were drawn after trading queens before move 20:
+
+    $ ./pgnparser --file examples/ficsgamesdb_search_1255777.pgn
+                  --select "%QueensTraded > 0 and %QueensTraded <= 38 and
+                            %Result = '1/2-1/2'"
+
  To know the number of games won/lost with ECO code C25 by the same player:
 
     $ ./pgnparser --file examples/ficsgamesdb_search_1255777.pgn
@@ -167,7 +291,12 @@ func showExpressions(signal int) {
                              (%Black = 'clinares' and %Result = '1-0')) and
                             %ECO='C25'"
 
- returns 140 games.
+ returns 140 games. Finally, the games played by the same player which were
+ not won by white are:
+
+    $ ./pgnparser --file examples/ficsgamesdb_search_1255777.pgn
+                  --select "(%White = 'clinares' xor %Black = 'clinares') and
+                            not %Result = '1-0'"
 
 `)
 	os.Exit(signal)
@@ -177,12 +306,20 @@ func showExpressions(signal int) {
 // --sort
 func showSortingDescriptors(signal int) {
 
-	fmt.Println(` 
+	fmt.Printf("%v", ` 
  Games can be sorted according to different criteria either in ascending or
  descending order. The keys to use are given as a string which consists of a
  sequence of variables (and hence, they should be preceded with the character
  '%'). A key is applied in increasing order if it is preceded by '<' and in
- decreasing order if it is given as '>'.
+ decreasing order if it is given as '>'. Computed fields such as '%EloDiff' or
+ '%PlayerColor(clinares)' can be used as keys as well (see '--help-expressions').
+
+ Integers are sorted by their value. Dates, times and time controls are sorted
+ according to their type, where time controls are sorted by their estimated
+ duration and unknown components go first, e.g., '2016.??.??' goes before
+ '2016.01.01'. All other values are sorted in natural order, i.e., numbers
+ within strings are compared by their value so that '60+0' goes before '180+2'
+ and 'Round 9' goes before 'Round 10'.
 
  Examples:
 
@@ -201,7 +338,18 @@ func showSortingDescriptors(signal int) {
  sorts games in increasing order of white's name and in decreasing order of the
  result for all games played by the same player as white.
 
- It is possible to use an arbitrary number of keys for sorting games.
+ It is possible to use an arbitrary number of keys for sorting games. Games with
+ the same values of all keys keep the order in which they were read.
+
+ By default, all games must have all keys. Games where a key is missing can be
+ placed either before or after all the others, regardless of the sorting
+ direction, with 'missing_first' or 'missing_last' after the key. For example:
+
+    $ ./pgnparser --file examples/mygames.pgn
+                  --sort "> %EloDiff missing_last < %Date"
+
+ sorts games in decreasing order of the difference of ratings, placing games
+ without ratings at the end, and then in increasing order of their date.
 `)
 	os.Exit(signal)
 }
@@ -210,7 +358,7 @@ func showSortingDescriptors(signal int) {
 // --select
 func showHistogram(signal int) {
 
-	fmt.Println(` 
+	fmt.Printf("%v", ` 
  Histograms are used to produce information about the frequencies of a variable
  or a combination of two variables. This is, histograms are limited to one or
  two variables.
@@ -222,7 +370,8 @@ func showHistogram(signal int) {
                              title: variable
 
     Variables here refer mainly to tags defined in *all* PGN games or variables
-    defined automatically by this software
+    defined automatically by this software, including computed fields such as
+    %Winner or %PlayerColor(clinares)
 
     If a variable is given, histograms are computed as the number of ocurrences
     of each observed value of the specified variable.
@@ -290,6 +439,11 @@ func verify() {
 			pgnfile)
 	}
 
+	// verify that the mode used to search for positions is known
+	if _, ok := positionModes[positionMode]; !ok {
+		log.Fatalf("unknown position mode '%s'", positionMode)
+	}
+
 	// very that the tableTemplate file exists and is accessible
 	tableTemplateisregular, _ := fstools.IsRegular(tableTemplate)
 	if !tableTemplateisregular {
@@ -299,19 +453,108 @@ func verify() {
 
 }
 
+// shows the given error and exits with the signal that corresponds to its
+// kind. Errors which are not raised by pgntools exit with failure
+func exitWithError(err error) {
+
+	log.Println(err)
+
+	signal := EXIT_FAILURE
+	var pgnerr *pgntools.PgnError
+	if errors.As(err, &pgnerr) {
+		switch pgnerr.Kind {
+		case pgntools.ErrSyntax:
+			signal = EXIT_SYNTAX
+		case pgntools.ErrTag:
+			signal = EXIT_TAG
+		case pgntools.ErrMove:
+			signal = EXIT_MOVE
+		case pgntools.ErrQuery:
+			signal = EXIT_QUERY
+		case pgntools.ErrTemplate:
+			signal = EXIT_TEMPLATE
+		case pgntools.ErrIO:
+			signal = EXIT_IO
+		}
+	}
+	os.Exit(signal)
+}
+
+// shows a summary of the problems found on the standard error
+func showDiagnostics(diagnostics []pgntools.PgnDiagnostic) {
+
+	// count the number of games skipped and truncated and the warnings
+	var skipped, truncated, warnings int
+	for _, diagnostic := range diagnostics {
+		switch diagnostic.Action {
+		case pgntools.Skipped:
+			skipped += 1
+		case pgntools.Truncated:
+			truncated += 1
+		default:
+			warnings += 1
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "\n # Diagnostics: %v games skipped, %v games truncated, %v warnings\n", skipped, truncated, warnings)
+	for _, diagnostic := range diagnostics {
+		fmt.Fprintf(os.Stderr, "   %v\n", diagnostic)
+	}
+}
+
+// shows the plies where the position searched for was reached in every game
+func showPositions(games pgntools.PgnCollection) {
+
+	fmt.Printf(" # Position found in %v games:\n", games.Len())
+	for _, game := range games.GetGames() {
+		white, _ := game.GetTagValue("White")
+		black, _ := game.GetTagValue("Black")
+		date, _ := game.GetTagValue("Date")
+		fmt.Printf("   %v - %v (%v): plies %v\n", white, black, date,
+			strings.Trim(fmt.Sprint(game.GetPositionPlies()), "[]"))
+	}
+	fmt.Println()
+}
+
 // Main body
 func main() {
 
 	// verify the values parsed
 	verify()
 
-	// process the contents of the given file
-	games := pgntools.GetGamesFromFile(pgnfile, showboard, query, sort, verbose)
+	// process the contents of the given file. In case a position is
+	// searched for, games are sorted only once they have been found
+	sortString := sort
+	if position != "" {
+		sortString = ""
+	}
+	games, err := pgntools.ReadGamesFromFile(pgnfile, showboard, query, sortString,
+		pgntools.ReadOptions{Verbose: verbose, Strict: strict, Lenient: lenient, Replay: true})
+	if err != nil {
+		exitWithError(err)
+	}
+	if position != "" {
+		if games, err = games.FindPosition(position, positionModes[positionMode]); err != nil {
+			exitWithError(err)
+		}
+		if sort != "" {
+			if err = games.Sort(sort); err != nil {
+				exitWithError(err)
+			}
+		}
+	}
 
 	// show a table with information of the games been processed. For this,
 	// a template is used: tableTemplate contains the location of a default
 	// template to use; others can be defined with --table
-	games.GamesToWriterFromTemplate(os.Stdout, tableTemplate)
+	if err = games.WriteTemplate(os.Stdout, tableTemplate); err != nil {
+		exitWithError(err)
+	}
+
+	// show the plies where the position searched for was reached
+	if position != "" {
+		showPositions(games)
+	}
 
 	// In case at least one histogram was given, then process it over the
 	// whole collection of pgn games
@@ -325,7 +568,22 @@ func main() {
 	// extension '.tex' from the contents given in the specified template
 	if latexTemplate != "" {
 
-		games.GamesToFileFromTemplate(pgnfile+".tex", latexTemplate)
+		if err = games.WriteTemplateToFile(pgnfile+".tex", latexTemplate); err != nil {
+			exitWithError(err)
+		}
+	}
+
+	// in case an output pgn file has been given, then write all games to it
+	if outputPgn != "" {
+
+		if err = games.WritePGNToFile(outputPgn); err != nil {
+			exitWithError(err)
+		}
+	}
+
+	// finally, show a summary of all problems found
+	if len(games.GetDiagnostics()) > 0 {
+		showDiagnostics(games.GetDiagnostics())
 	}
 }
 
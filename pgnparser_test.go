@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// the tests of the command run it in a child process with the arguments
+// given, which is recognized with the following environment variable
+const testMainEnv = "PGNPARSER_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+
+	if os.Getenv(testMainEnv) != "" {
+		main()
+		os.Exit(EXIT_SUCCESS)
+	}
+	os.Exit(m.Run())
+}
+
+// Test that the command exits with the code that corresponds to the errors
+// found in its arguments
+func TestExitCodes(t *testing.T) {
+
+	// games are shown with a template that does not depend on their tags
+	dir := t.TempDir()
+	pgnfile, template := filepath.Join(dir, "games.pgn"), filepath.Join(dir, "table.tpl")
+	if err := os.WriteFile(pgnfile, []byte("[Event \"A\"]\n\n1. e4 e5 2. Nf3 *\n"), 0644); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	if err := os.WriteFile(template, []byte("# Games found: {{.Len}}\n"), 0644); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	var exitTable = []struct {
+		args []string
+		code int
+	}{
+		{[]string{"--position", "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2"}, EXIT_SUCCESS},
+		{[]string{"--position", "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP w KQkq - 0 2"}, EXIT_QUERY},
+		{[]string{"--position", "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR x KQkq - 0 2"}, EXIT_QUERY},
+		{[]string{"--position", "8/8/8/8/4P3/8/8", "--position-mode", "pattern"}, EXIT_QUERY},
+		{[]string{"--select", "%Event = "}, EXIT_QUERY},
+		{[]string{"--strict", "--lenient"}, EXIT_QUERY},
+	}
+
+	for _, tt := range exitTable {
+		t.Run(tt.args[len(tt.args)-1], func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], append([]string{"--file", pgnfile, "--table", template}, tt.args...)...)
+			cmd.Env = append(os.Environ(), testMainEnv+"=1")
+			err := cmd.Run()
+
+			code := EXIT_SUCCESS
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			if code != tt.code {
+				t.Fatalf("got exit code %v want %v", code, tt.code)
+			}
+		})
+	}
+}
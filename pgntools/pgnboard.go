@@ -25,6 +25,7 @@ import (
 	"math"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 // globals
@@ -52,6 +53,13 @@ var literal map[int]string
 // separate lists. Each list represents a specific direction.
 var threats map[string]map[int][][]int
 
+// the following map stores the translation of the characters used in FEN
+// strings to pieces
+var fenPieces = map[rune]int{
+	'P': WPAWN, 'N': WKNIGHT, 'B': WBISHOP, 'R': WROOK, 'Q': WQUEEN, 'K': WKING,
+	'p': BPAWN, 'n': BKNIGHT, 'b': BBISHOP, 'r': BROOK, 'q': BQUEEN, 'k': BKING,
+}
+
 // the following regexp captures all the information given from the textual
 // description of a move in different groups as follows:
 //
@@ -86,13 +94,21 @@ const (
 
 // A PgnBoard consists simply of an array of 64 integers. In addition, the
 // location of both kings has to be updated. This information is used to decide
-// whether a piece is pinned or no
+// whether a piece is pinned or no. Boards also store the rest of information
+// given in FEN strings: the side to move, castling ability, the en passant
+// target square, the halfmove clock and the fullmove number, and the Zobrist
+// hash of the position which is updated after every move
 type PgnBoard struct {
 	squares      [64]int // contents of each square
 	wking, bking int     // location of the white and black king
 	wkcastling, wqcastling bool	// white king and queen side castling ability
 	bkcastling, bqcastling bool	// black king and queen side castling ability
 	turn	int	// 1 if play's white, -1 if play's black
+	enpassant int   // en passant target square or -1 if there is none
+	halfmove  int   // number of plies since the last capture or pawn move
+	fullmove  int   // number of the next move, starting at 1
+	strict    bool  // whether moves are validated against the rules of chess
+	hash      uint64 // Zobrist hash of this position
 }
 
 // Functions
@@ -186,7 +202,7 @@ func init() {
 
 			// and store the transformation from literal coordinates
 			// to integers
-			coords[string('a'+column)+string('0'+1+row)] = row*8 + column
+			coords[string(rune('a'+column))+string(rune('0'+1+row))] = row*8 + column
 		}
 	}
 
@@ -194,7 +210,7 @@ func init() {
 	// coordinates to literal coordinates
 	literal = make(map[int]string)
 	for index := 0; index < 64; index++ {
-		literal[index] = string('a'+index%8) + string('0'+1+index/8)
+		literal[index] = string(rune('a'+index%8)) + string(rune('0'+1+index/8))
 	}
 
 	// now, compute all threats
@@ -216,7 +232,7 @@ func init() {
 				}
 				threat[piece] = getThreat(row*8+column, piece)
 			}
-			threats[string('a'+column)+string('0'+1+row)] = threat
+			threats[string(rune('a'+column))+string(rune('0'+1+row))] = threat
 		}
 	}
 }
@@ -545,7 +561,7 @@ func getKingThreats(target int) [][]int {
 // returns the two qualifiers (row and column) for the given square identified
 // as an index
 func getQualifier(square int) (row, column string) {
-	row, column = string(square/8+'1'), string(square%8+'a')
+	row, column = string(rune(square/8+'1')), string(rune(square%8+'a'))
 	return
 }
 
@@ -564,8 +580,14 @@ func InitPgnBoard() (board PgnBoard) {
 		60, // initial location of the black king
 		true, true, // initial white king and queen side castling ability
 		true, true, // initial black king and queen side castling ability
-		1 } // initial turn 
-		 
+		1,          // initial turn
+		-1,         // no en passant target square
+		0,          // halfmove clock
+		1,          // fullmove number
+		false,      // moves are not validated by default
+		0 }         // Zobrist hash, computed below
+	board.hash = board.getZobrist()
+
 	return
 }
 
@@ -581,6 +603,11 @@ func InitPgnBoard() (board PgnBoard) {
 // It returns a positive value in case of success and a negative value otherwise
 func (board *PgnBoard) getOriginPawn(piece int, target string, qualifier string, capture bool) int {
 
+	// pawns can not reach the first two rows of their own side
+	if len(threats[target][piece]) < 2 {
+		return -1
+	}
+
 	// ordinary threats are stored always in the first list; whereas
 	// captures are stored in the second and third list
 	if capture {
@@ -605,8 +632,6 @@ func (board *PgnBoard) getOriginPawn(piece int, target string, qualifier string,
 			if columnsecond == qualifier && board.squares[second] == piece {
 				return second
 			}
-		} else {
-			log.Fatalf(" Fatal Error getting the origin of a white pawn (capture)")
 		}
 	} else {
 
@@ -621,8 +646,6 @@ func (board *PgnBoard) getOriginPawn(piece int, target string, qualifier string,
 			// otherwise, verify there is available a second
 			// location to look up
 			return threats[target][piece][0][1]
-		} else {
-			log.Fatalf(" Fatal Error getting the origin of a pawn (ordinary)")
 		}
 	}
 
@@ -747,31 +770,15 @@ func (board *PgnBoard) getOrigin(piece int, target string, qualifier string, cap
 	if piece == WPAWN || piece == BPAWN {
 
 		// -- Pawns
-		origin = board.getOriginPawn(piece, target, qualifier, capture)
-		if origin < 0 {
-			log.Fatalf("It was not possible to get the origin location of a pawn")
-		}
-		return origin
+		return board.getOriginPawn(piece, target, qualifier, capture)
 	} else if piece == WKNIGHT || piece == BKNIGHT {
 
 		// -- Knights
-		origin = board.getOriginKnight(piece, target, qualifier, capture)
-		if origin < 0 {
-			log.Fatalf("It was not possible to get the origin location of a knight")
-		}
-		return origin
-	} else {
-
-		// --- Bishops, Rooks, Queens and Kings
-		origin = board.getOriginGeneric(piece, target, qualifier, capture)
-		if origin < 0 {
-			log.Fatalf("It was not possible to get the origin location of a generic piece")
-		}
-		return origin
+		return board.getOriginKnight(piece, target, qualifier, capture)
 	}
 
-	// in case of failure return a negative number
-	return -1
+	// --- Bishops, Rooks, Queens and Kings
+	return board.getOriginGeneric(piece, target, qualifier, capture)
 }
 
 // determine whether a piece in the given location which moves to the given
@@ -854,203 +861,426 @@ func (board *PgnBoard) isPinned(location int, dest int) bool {
 		board.isPinnedGeneric(location, dest, rook, threats[literal[king]][rook])
 }
 
-// update the contents of this board after the side of the given color makes a
-// short castling
-func (board *PgnBoard) updateShortCastling(color int) {
+// return true if the given square is attacked by any piece of the given
+// color. To decide it, the threats to the given square are traversed looking
+// for pieces of the given color which can reach it
+func (board *PgnBoard) isAttacked(square int, color int) bool {
+
+	target := literal[square]
 
+	// -- pawns, which attack only diagonally, i.e., all lists but the first
+	// one
+	if pawns := threats[target][WPAWN*color]; len(pawns) > 1 {
+		for _, direction := range pawns[1:] {
+			if board.squares[direction[0]] == WPAWN*color {
+				return true
+			}
+		}
+	}
+
+	// -- knights and kings which can not be blocked
+	for _, loc := range threats[target][WKNIGHT][0] {
+		if board.squares[loc] == WKNIGHT*color {
+			return true
+		}
+	}
+	for _, direction := range threats[target][WKING] {
+		if board.squares[direction[0]] == WKING*color {
+			return true
+		}
+	}
+
+	// -- bishops, rooks and queens, which are blocked by any other piece
+	for _, piece := range []int{WBISHOP, WROOK} {
+		for _, direction := range threats[target][piece] {
+			for _, loc := range direction {
+				if board.squares[loc] == piece*color || board.squares[loc] == WQUEEN*color {
+					return true
+				}
+				if board.squares[loc] != BLANK {
+					break
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// return true if the king of the given color is in check
+func (board *PgnBoard) isChecked(color int) bool {
 	if color < 0 {
-		board.squares[coords["e8"]] = BLANK // remove the king
-		board.squares[coords["h8"]] = BLANK // remove the rook
-		board.squares[coords["f8"]] = BROOK // relocate the rook
-		board.squares[coords["g8"]] = BKING // relocate the king
+		return board.isAttacked(board.bking, 1)
+	}
+	return board.isAttacked(board.wking, -1)
+}
+
+// update the castling ability after a piece leaves or reaches the given
+// square. Castling is not possible anymore once the king or the rook leave
+// their original squares, or once the rook is captured
+func (board *PgnBoard) updateCastlingAbility(square int) {
+
+	switch square {
+	case 4: // e1
+		board.wkcastling, board.wqcastling = false, false
+	case 0: // a1
+		board.wqcastling = false
+	case 7: // h1
+		board.wkcastling = false
+	case 60: // e8
+		board.bkcastling, board.bqcastling = false, false
+	case 56: // a8
+		board.bqcastling = false
+	case 63: // h8
+		board.bkcastling = false
+	}
+}
+
+// update the contents of this board after moving the piece in the given origin
+// to the given target. If promotion is not null, then the pawn is replaced by
+// it. Kings moved two squares castle, and pawns moved diagonally to an empty
+// square capture en passant. The side to move, castling ability, en passant
+// target square, halfmove clock and fullmove number are updated as well. No
+// verification is made at all
+func (board *PgnBoard) makeMove(origin, target, promotion int) {
+
+	piece := board.squares[origin]
+	color := getColor(piece)
+	capture := board.squares[target] != BLANK
+
+	// the part of the Zobrist hash which does not depend on the pieces is
+	// removed now and added back once the move is made
+	board.hash ^= board.getZobristState()
+
+	// First, remove the piece from its origin and place it (or the piece
+	// it is promoted to) in the target
+	board.setSquare(origin, BLANK)
+	if promotion != BLANK {
+		board.setSquare(target, promotion)
+	} else {
+		board.setSquare(target, piece)
+	}
+
+	switch piece {
+	case WPAWN, BPAWN:
+
+		// --en passant capture: remove the captured pawn
+		if origin%8 != target%8 && !capture {
+			board.setSquare(target-8*color, BLANK)
+			capture = true
+		}
+	case WKING, BKING:
+
+		// update the location of the king and relocate the rook in
+		// case of castling
+		if color < 0 {
+			board.bking = target
+		} else {
+			board.wking = target
+		}
+		if target-origin == 2 {
+			board.setSquare(origin+3, BLANK)
+			board.setSquare(origin+1, WROOK*color)
+		} else if origin-target == 2 {
+			board.setSquare(origin-4, BLANK)
+			board.setSquare(origin-1, WROOK*color)
+		}
+	}
 
-		board.bking = coords["g8"]
+	// -- check for the castling ability
+	board.updateCastlingAbility(origin)
+	board.updateCastlingAbility(target)
+
+	// -- en passant target square and halfmove clock: pawn moves and
+	// captures reset the clock, and pawns moved two squares forward set the
+	// en passant target square behind them
+	board.enpassant = -1
+	if piece == WPAWN*color {
+		board.halfmove = 0
+		if target-origin == 16 || origin-target == 16 {
+			board.enpassant = (origin + target) / 2
+		}
+	} else if capture {
+		board.halfmove = 0
 	} else {
-		board.squares[coords["e1"]] = BLANK // remove the king
-		board.squares[coords["h1"]] = BLANK // remove the rook
-		board.squares[coords["f1"]] = WROOK // relocate the rook
-		board.squares[coords["g1"]] = WKING // relocate the king
+		board.halfmove += 1
+	}
 
-		board.wking = coords["g1"]
+	// update turn and the fullmove number after black moves
+	board.turn = -color
+	if color < 0 {
+		board.fullmove += 1
 	}
+	board.hash ^= board.getZobristState()
 }
 
-// update the contents of this board after the side of the given color makes a
-// long castling
-func (board *PgnBoard) updateLongCastling(color int) {
+// return true if the given origin satisfies the given qualifier, which can
+// consist of a column, a row or both
+func isQualified(origin int, qualifier string) bool {
+	row, column := getQualifier(origin)
+	return qualifier == "" || qualifier == row || qualifier == column ||
+		qualifier == column+row
+}
 
-	if color < 0 {
-		board.squares[coords["e8"]] = BLANK // remove the king
-		board.squares[coords["a8"]] = BLANK // remove the rook
-		board.squares[coords["d8"]] = BROOK // relocate the rook
-		board.squares[coords["c8"]] = BKING // relocate the king
+// return all squares occupied by the given piece from which it can reach the
+// given target in this board regardless of whether the king is left in check
+// or not. Pawns are considered to move forward or to capture depending on the
+// given flag
+func (board *PgnBoard) getCandidates(piece int, target int, capture bool) (origins []int) {
 
-		board.bking = coords["c8"]
-	} else {
-		board.squares[coords["e1"]] = BLANK // remove the king
-		board.squares[coords["a1"]] = BLANK // remove the rook
-		board.squares[coords["d1"]] = WROOK // relocate the rook
-		board.squares[coords["c1"]] = WKING // relocate the king
+	directions := threats[literal[target]][piece]
+	switch piece {
+	case WPAWN, BPAWN:
+		if len(directions) == 0 {
+			return
+		}
+
+		// pawns capture diagonally and move forward one or two
+		// squares, provided that there is no piece in between
+		if capture {
+			for _, direction := range directions[1:] {
+				if board.squares[direction[0]] == piece {
+					origins = append(origins, direction[0])
+				}
+			}
+		} else if ordinary := directions[0]; board.squares[ordinary[0]] == piece {
+			origins = append(origins, ordinary[0])
+		} else if len(ordinary) > 1 && board.squares[ordinary[0]] == BLANK &&
+			board.squares[ordinary[1]] == piece {
+			origins = append(origins, ordinary[1])
+		}
+
+	case WKNIGHT, BKNIGHT:
+		for _, loc := range directions[0] {
+			if board.squares[loc] == piece {
+				origins = append(origins, loc)
+			}
+		}
+
+	default:
+
+		// bishops, rooks, queens and kings can not jump over other
+		// pieces
+		for _, direction := range directions {
+			for _, loc := range direction {
+				if board.squares[loc] == piece {
+					origins = append(origins, loc)
+				}
+				if board.squares[loc] != BLANK {
+					break
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// return the square from which the given piece legally moves to the given
+// target. The qualifier is used to solve ambiguities, the capture flag states
+// whether the move is annotated as a capture and promotion is the piece a pawn
+// is promoted to, if any. It returns a *PgnError with the reason if the move is
+// not legal or it is ambiguous
+func (board *PgnBoard) getLegalOrigin(piece int, target int, qualifier string,
+	capture bool, promotion int) (int, error) {
+
+	color := getColor(piece)
+
+	// the target square can be occupied only by a piece of the opponent
+	// other than the king
+	if board.squares[target] != BLANK && getColor(board.squares[target]) == color {
+		return -1, fmt.Errorf("the target square is occupied by a piece of the same side")
+	}
+	if board.squares[target] == -WKING*color {
+		return -1, fmt.Errorf("the king can not be captured")
+	}
+
+	// pawns have to be promoted when reaching the last row, and only then
+	if piece == WPAWN*color {
+		last := (color > 0 && target/8 == 7) || (color < 0 && target/8 == 0)
+		if last && promotion == BLANK {
+			return -1, fmt.Errorf("pawns have to be promoted in the last row")
+		}
+		if !last && promotion != BLANK {
+			return -1, fmt.Errorf("pawns can be promoted only in the last row")
+		}
+		if promotion == WPAWN*color || promotion == WKING*color {
+			return -1, fmt.Errorf("pawns can not be promoted to pawns or kings")
+		}
+	} else if promotion != BLANK {
+		return -1, fmt.Errorf("only pawns can be promoted")
+	}
+
+	// captures have to be annotated, and only pawns capture en passant
+	if capture && board.squares[target] == BLANK &&
+		(piece != WPAWN*color || target != board.enpassant) {
+		return -1, fmt.Errorf("the move does not capture any piece")
+	}
+	if !capture && board.squares[target] != BLANK {
+		return -1, fmt.Errorf("the capture is not annotated")
+	}
 
-		board.wking = coords["c1"]
+	// finally, look for those pieces that can reach the target satisfying
+	// the qualifier without leaving their king in check
+	var origins []int
+	candidates := board.getCandidates(piece, target, capture)
+	for _, origin := range candidates {
+		next := *board
+		next.makeMove(origin, target, promotion)
+		if isQualified(origin, qualifier) && !next.isChecked(color) {
+			origins = append(origins, origin)
+		}
 	}
+	if len(origins) > 1 {
+		return -1, fmt.Errorf("the move is ambiguous")
+	}
+	if len(origins) == 0 {
+		if len(candidates) > 0 {
+			return -1, fmt.Errorf("the move leaves the king in check")
+		}
+		return -1, fmt.Errorf("no piece can reach the target square")
+	}
+	return origins[0], nil
+}
+
+// verify that the side of the given color can castle to the specified side
+// according to the rules of chess: the king and the rook have not been moved,
+// there are no pieces between them and the king is not in check, neither it
+// passes through or reaches a square attacked by the opponent. It returns an
+// error with the reason if castling is not legal
+func (board *PgnBoard) checkCastling(color int, short bool) error {
+
+	// compute the squares of the king and the rook, whether castling is
+	// available and the squares between them
+	king, rook, direction, available := 4, 7, 1, board.wkcastling
+	switch {
+	case color > 0 && !short:
+		rook, direction, available = 0, -1, board.wqcastling
+	case color < 0 && short:
+		king, rook, available = 60, 63, board.bkcastling
+	case color < 0 && !short:
+		king, rook, direction, available = 60, 56, -1, board.bqcastling
+	}
+
+	if !available || board.squares[king] != WKING*color || board.squares[rook] != WROOK*color {
+		return fmt.Errorf("castling is not available")
+	}
+	for square := king + direction; square != rook; square += direction {
+		if board.squares[square] != BLANK {
+			return fmt.Errorf("there are pieces between the king and the rook")
+		}
+	}
+	for square := king; square != king+3*direction; square += direction {
+		if board.isAttacked(square, -color) {
+			if square == king {
+				return fmt.Errorf("the king can not castle while in check")
+			}
+			return fmt.Errorf("the king can not castle through or into check")
+		}
+	}
+	return nil
+}
+
+// Set whether moves played on this board are validated against the rules of
+// chess. By default, only the origin of every move is resolved and no further
+// verification is made
+func (board *PgnBoard) SetStrict(strict bool) {
+	board.strict = strict
 }
 
 // The following method updates the contents of the current board after making
 // the given move as retrieved directly from a pgn game. If showmoves is true,
-// then each move is shown on the standard output
+// then each move is shown on the standard output. It behaves like Play but any
+// error is fatal
 func (board *PgnBoard) UpdateBoard(move PgnMove, showmoves bool) {
 
+	if err := board.Play(move, showmoves); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// The following method updates the contents of the current board after making
+// the given move as retrieved directly from a pgn game. If showmoves is true,
+// then each move is shown on the standard output. It returns a *PgnError in case
+// the move can not be reproduced on this board or, in strict mode, if it is not
+// legal
+func (board *PgnBoard) Play(move PgnMove, showmoves bool) error {
+
 	if showmoves {
 		fmt.Printf(" %v\n", move)
 	}
 
-	if reTextualMove.MatchString(move.moveValue) {
+	// moves have to be played by the side to move
+	if move.color != board.turn {
+		return newError(ErrMove, move.moveValue, "the move is not played by the side to move")
+	}
 
+	if !reTextualMove.MatchString(move.moveValue) {
+		return newError(ErrMove, move.moveValue, "the move could not be parsed")
+	}
 
-		// update turn
-		board.turn = -1*(move.color)
-		
-		// get the different parts of this move necessary to reproduce
-		// it on the board
-		matches := reTextualMove.FindStringSubmatch(move.moveValue)
+	// get the different parts of this move necessary to reproduce it on
+	// the board
+	matches := reTextualMove.FindStringSubmatch(move.moveValue)
 
-		// fmt.Println()
-		// for idx, value := range matches {
-		// 	fmt.Printf("\t\tmatches [%v]: %v\n", idx, value)
-		// }
+	// fmt.Println()
+	// for idx, value := range matches {
+	// 	fmt.Printf("\t\tmatches [%v]: %v\n", idx, value)
+	// }
 
-		if matches[6] == "O-O" {
-			
-			// Update castling ability
-			if board.turn == 1 {
-				board.wkcastling = false
-				board.wqcastling = false
-			} else if board.turn == -1 {
-				board.bkcastling = false
-				board.bqcastling = false
-			}
-			// -- Short castling
-			board.updateShortCastling(move.color)
-		} else if matches[6] == "O-O-O" {
-
-			// Update castling ability
-			if board.turn == 1 {
-				board.wkcastling = false
-				board.wqcastling = false
-			} else if board.turn == -1 {
-				board.bkcastling = false
-				board.bqcastling = false
-			}
+	if matches[6] == "O-O" || matches[6] == "O-O-O" {
 
-			// -- Long castling
-			board.updateLongCastling(move.color)
+		// -- Castling, which is given as a move of the king two
+		// squares towards the rook
+		if board.strict {
+			if err := board.checkCastling(move.color, matches[6] == "O-O"); err != nil {
+				return newError(ErrMove, move.moveValue, "%v", err)
+			}
+		}
+		origin := coords["e1"]
+		if move.color < 0 {
+			origin = coords["e8"]
+		}
+		if matches[6] == "O-O" {
+			board.makeMove(origin, origin+2, BLANK)
 		} else {
-			
-			// -- Other moves
-
-			// get the square from which the move was originated
-			origin := board.getOrigin(
-				getPieceIndex(matches[1])*move.color, // piece
-				matches[4],                           // target square
-				matches[2],                           // qualifier
-				matches[3] == "x")                    // capture flag
-			if origin < 0 {
-				log.Fatalf("It was not possible to reproduce the move '%v'\n", move)
-			} else {
-
-				// First, remove the piece from its origin
-				board.squares[origin] = BLANK
-
-				// now, place the same piece in the target
-				// unless this move resulted in a promotion
-				if len(matches[5]) > 0 {
-
-					// --Promotion
-					board.squares[coords[matches[4]]] = getPieceIndex(string(matches[5][1])) * move.color
-				} else {
-
-					// --en passant capture
-					if getPieceIndex(matches[1]) == WPAWN &&
-						matches[3] == "x" &&
-						board.squares[coords[matches[4]]] == BLANK {
-
-						// remove the captured pawn
-						if move.color > 0 {
-							board.squares[coords[matches[4]]-8] = BLANK
-						} else {
-							board.squares[coords[matches[4]]+8] = BLANK
-						}
-					}
-
-					// copy this piece to the target square
-					board.squares[coords[matches[4]]] = getPieceIndex(matches[1]) * move.color
-
-					// finally, update the location of the
-					// king if necessary
-					if matches[1] == "K" {
-
-						if move.color < 0 {
-							board.bking = coords[matches[4]]
-						} else {
-							board.wking = coords[matches[4]]
-						}
-					}
-				}
-				
-				// -- check for the castling ability
-				
-				// Check if white haven't castled yet
-				if (board.wkcastling || board.wqcastling){
-					// If king is moved then no castling is possible
-					if getPieceIndex(matches[1]) == WKING {
-						board.wkcastling, board.wqcastling = false, false
-					
-					}else if ( getPieceIndex(matches[1]) == WROOK &&
-						origin == 63 ) { 
-						// if king side rook is moved 
-						// then no king side castling is possible
-						board.wkcastling = false
-	
-					} else if getPieceIndex(matches[1]) == WROOK &&
-						origin == 56 {
+			board.makeMove(origin, origin-2, BLANK)
+		}
+		return nil
+	}
 
-						// if queen side rook is moved 
-						// then no king side castling is possible
-						board.wqcastling = false
-					}
-				}
+	// -- Other moves
+	target, ok := coords[matches[4]]
+	if !ok {
+		return newError(ErrMove, move.moveValue, "the move could not be parsed")
+	}
+	piece := getPieceIndex(matches[1]) * move.color
+	promotion := BLANK
+	if len(matches[5]) > 0 {
+		promotion = getPieceIndex(string(matches[5][1])) * move.color
+	}
 
-				// Check if black haven't castled yet
-				if (board.bkcastling || board.bqcastling){
-					// If king is moved then no castling is possible
-					if matches[1]== "K" && move.color < 0 {
-						board.bkcastling, board.bqcastling = false, false
-					
-					}else if getPieceIndex(matches[1]) == BROOK &&
-						origin == 7 { 
-						// if king side rook is moved 
-						// then no king side castling is possible
-
-						board.bkcastling = false
-	
-					} else if getPieceIndex(matches[1]) == WROOK && 
-						origin == 0 {
-
-						// if queen side rook is moved 
-						// then no king side castling is possible
-						
-						board.wqcastling = false
-					}
-				}
-						
-			}
+	// get the square from which the move was originated. In strict mode,
+	// the move is verified to be legal
+	if board.strict {
+		origin, err := board.getLegalOrigin(piece, target, matches[2], matches[3] == "x", promotion)
+		if err != nil {
+			return newError(ErrMove, move.moveValue, "%v", err)
 		}
-	} else {
-		log.Fatalf("\t '%v' not parsed!\n", move.moveValue)
+		board.makeMove(origin, target, promotion)
+		return nil
+	}
+	origin := board.getOrigin(
+		piece,             // piece
+		matches[4],        // target square
+		matches[2],        // qualifier
+		matches[3] == "x") // capture flag
+	if origin < 0 {
+		return newError(ErrMove, move.moveValue, "it was not possible to reproduce the move")
 	}
+	board.makeMove(origin, target, promotion)
 
-	return
+	return nil
 }
 
 // show a graphical view of this chess board
@@ -1066,12 +1296,14 @@ func (board PgnBoard) String() (output string) {
 	}
 	output += "  +-+-+-+-+-+-+-+-+\n  "
 	for column := 0; column < 8; column++ {
-		output += fmt.Sprintf(" %v", string('a'+column))
+		output += fmt.Sprintf(" %v", string(rune('a'+column)))
 	}
 	return output
 }
 
-// Return FEN string of the board
+// Return FEN string of the board with its six fields: piece placement, side to
+// move, castling ability, en passant target square, halfmove clock and fullmove
+// number
 func (board PgnBoard) GetFen() (fen string){
 	fen = ""
 
@@ -1156,11 +1388,142 @@ func (board PgnBoard) GetFen() (fen string){
 			fen += "-"
 		}
 
+	// Append the en passant target square, the halfmove clock and the
+	// fullmove number
+	if board.enpassant >= 0 {
+		fen += " " + literal[board.enpassant]
+	} else {
+		fen += " -"
+	}
+	fen += fmt.Sprintf(" %v %v", board.halfmove, board.fullmove)
 
-	
 	return
 }
 
+// return the contents of all squares given in the piece placement of a FEN
+// string, i.e., from the eighth rank to the first. It returns a *PgnError if
+// the piece placement is not correct
+func getPiecePlacement(placement string) (squares [64]int, err error) {
+
+	ranks := strings.Split(placement, "/")
+	if len(ranks) != 8 {
+		return squares, newError(ErrTag, placement, "the piece placement should consist of eight ranks")
+	}
+	for idx, rank := range ranks {
+		row, column := 7-idx, 0
+		for _, char := range rank {
+			if char >= '1' && char <= '8' {
+				column += int(char - '0')
+				continue
+			}
+			piece, ok := fenPieces[char]
+			if !ok {
+				return squares, newError(ErrTag, placement, "unknown piece '%c' in the piece placement", char)
+			}
+			if column > 7 {
+				return squares, newError(ErrTag, placement, "the rank %v does not consist of eight squares", 1+row)
+			}
+			squares[row*8+column] = piece
+			column += 1
+		}
+		if column != 8 {
+			return squares, newError(ErrTag, placement, "the rank %v does not consist of eight squares", 1+row)
+		}
+	}
+	return squares, nil
+}
+
+// Return a new board with the position given in the specified FEN string. The
+// placement of pieces, the side to move and the castling ability are
+// mandatory. By default, there is no en passant target square, the halfmove
+// clock is zero and the fullmove number is 1. It returns a *PgnError if the FEN
+// string is not correct
+func NewPgnBoardFromFen(fen string) (board PgnBoard, err error) {
+
+	fields := strings.Fields(fen)
+	if len(fields) < 3 || len(fields) > 6 {
+		return board, newError(ErrTag, fen, "a FEN string should consist of three to six fields")
+	}
+
+	// -- piece placement, which is given from the eighth rank to the first
+	if board.squares, err = getPiecePlacement(fields[0]); err != nil {
+		err.(*PgnError).Text = fen
+		return board, err
+	}
+	board.wking, board.bking = -1, -1
+	for square, piece := range board.squares {
+		if piece == WKING {
+			if board.wking >= 0 {
+				return board, newError(ErrTag, fen, "there is more than one white king")
+			}
+			board.wking = square
+		} else if piece == BKING {
+			if board.bking >= 0 {
+				return board, newError(ErrTag, fen, "there is more than one black king")
+			}
+			board.bking = square
+		}
+	}
+	if board.wking < 0 || board.bking < 0 {
+		return board, newError(ErrTag, fen, "both kings should be on the board")
+	}
+
+	// -- side to move
+	switch fields[1] {
+	case "w":
+		board.turn = 1
+	case "b":
+		board.turn = -1
+	default:
+		return board, newError(ErrTag, fen, "unknown side to move '%v'", fields[1])
+	}
+
+	// -- castling ability
+	if fields[2] != "-" {
+		for _, char := range fields[2] {
+			switch char {
+			case 'K':
+				board.wkcastling = true
+			case 'Q':
+				board.wqcastling = true
+			case 'k':
+				board.bkcastling = true
+			case 'q':
+				board.bqcastling = true
+			default:
+				return board, newError(ErrTag, fen, "unknown castling ability '%v'", fields[2])
+			}
+		}
+	}
+
+	// -- en passant target square, which is on the sixth rank if white is
+	// to move and on the third rank otherwise
+	board.enpassant = -1
+	if len(fields) > 3 && fields[3] != "-" {
+		square, ok := coords[fields[3]]
+		if !ok || (board.turn > 0 && square/8 != 5) || (board.turn < 0 && square/8 != 2) {
+			return board, newError(ErrTag, fen, "wrong en passant target square '%v'", fields[3])
+		}
+		board.enpassant = square
+	}
+
+	// -- halfmove clock and fullmove number
+	if len(fields) > 4 {
+		if board.halfmove, err = strconv.Atoi(fields[4]); err != nil || board.halfmove < 0 {
+			return board, newError(ErrTag, fen, "wrong halfmove clock '%v'", fields[4])
+		}
+	}
+	board.fullmove = 1
+	if len(fields) > 5 {
+		if board.fullmove, err = strconv.Atoi(fields[5]); err != nil || board.fullmove < 1 {
+			return board, newError(ErrTag, fen, "wrong fullmove number '%v'", fields[5])
+		}
+	}
+	board.hash = board.getZobrist()
+
+	return board, nil
+}
+
 /* Local Variables: */
 /* mode:go */
 /* fill-column:80 */
@@ -8,7 +8,7 @@ import (
 func TestInitialPosition(t *testing.T) {
 	board := InitPgnBoard()
 	got := board.GetFen()
-	want := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq"
+	want := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
 	assert(t, got, want)
 }
 
@@ -20,10 +20,10 @@ func TestMoveKing(t *testing.T){
 		move PgnMove
 		fen string
 	}{
-		{ PgnMove{1, 1, "e3",-1,""}, "rnbqkbnr/pppppppp/8/8/8/4P3/PPPP1PPP/RNBQKBNR b KQkq"},
-		{ PgnMove{1, -1, "e6",-1,""}, "rnbqkbnr/pppp1ppp/4p3/8/8/4P3/PPPP1PPP/RNBQKBNR w KQkq"},
-		{ PgnMove{1, 1, "Ke2",-1,""}, "rnbqkbnr/pppp1ppp/4p3/8/8/4P3/PPPPKPPP/RNBQ1BNR b kq"},
-		{ PgnMove{1, -1, "Ke7",-1,""},"rnbq1bnr/ppppkppp/4p3/8/8/4P3/PPPPKPPP/RNBQ1BNR w -"},
+		{ PgnMove{number: 1, color: 1, moveValue: "e3", emt: -1}, "rnbqkbnr/pppppppp/8/8/8/4P3/PPPP1PPP/RNBQKBNR b KQkq - 0 1"},
+		{ PgnMove{number: 1, color: -1, moveValue: "e6", emt: -1}, "rnbqkbnr/pppp1ppp/4p3/8/8/4P3/PPPP1PPP/RNBQKBNR w KQkq - 0 2"},
+		{ PgnMove{number: 1, color: 1, moveValue: "Ke2", emt: -1}, "rnbqkbnr/pppp1ppp/4p3/8/8/4P3/PPPPKPPP/RNBQ1BNR b kq - 1 2"},
+		{ PgnMove{number: 1, color: -1, moveValue: "Ke7", emt: -1},"rnbq1bnr/ppppkppp/4p3/8/8/4P3/PPPPKPPP/RNBQ1BNR w - - 2 3"},
 	}
 
 	for _, tt := range moveTable {
@@ -45,3 +45,115 @@ func assert(t *testing.T, got, want string){
     }
 }
 
+
+// Test that boards are created from FEN strings and that wrong FEN strings are
+// rejected
+func TestNewPgnBoardFromFen(t *testing.T) {
+
+	var fenTable = []struct {
+		fen  string
+		want string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+		{"r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4",
+			"r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4"},
+		{"8/8/4k3/8/8/4K3/8/8 b - -", "8/8/4k3/8/8/4K3/8/8 b - - 0 1"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 12", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 12"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR", ""},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - 0 1", ""},
+		{"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", ""},
+		{"rnbqkbnr/ppppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", ""},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQ1BNR w KQkq - 0 1", ""},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1", ""},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KX - 0 1", ""},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e4 0 1", ""},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+			"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e3 0 1", ""},
+		{"4k3/8/8/3pP3/8/8/8/4K3 b - d6 0 12", ""},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0", ""},
+	}
+
+	for _, tt := range fenTable {
+		t.Run(tt.fen, func(t *testing.T) {
+			board, err := NewPgnBoardFromFen(tt.fen)
+			if tt.want == "" {
+				if pgnerr, ok := err.(*PgnError); !ok || pgnerr.Kind != ErrTag {
+					t.Fatalf("got '%v' want a %v", err, ErrTag)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			assert(t, board.GetFen(), tt.want)
+		})
+	}
+}
+
+// Test that the castling ability is updated when kings and rooks are moved or
+// rooks are captured
+func TestCastlingAbility(t *testing.T) {
+
+	var castlingTable = []struct {
+		fen   string
+		moves []PgnMove
+		want  []string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			[]PgnMove{
+				{number: 1, color: 1, moveValue: "a4", emt: -1},
+				{number: 1, color: -1, moveValue: "a5", emt: -1},
+				{number: 2, color: 1, moveValue: "Ra3", emt: -1},
+				{number: 2, color: -1, moveValue: "Ra6", emt: -1},
+				{number: 3, color: 1, moveValue: "h4", emt: -1},
+				{number: 3, color: -1, moveValue: "h5", emt: -1},
+				{number: 4, color: 1, moveValue: "Rh3", emt: -1},
+				{number: 4, color: -1, moveValue: "Rh6", emt: -1},
+			},
+			[]string{
+				"rnbqkbnr/pppppppp/8/8/P7/8/1PPPPPPP/RNBQKBNR b KQkq a3 0 1",
+				"rnbqkbnr/1ppppppp/8/p7/P7/8/1PPPPPPP/RNBQKBNR w KQkq a6 0 2",
+				"rnbqkbnr/1ppppppp/8/p7/P7/R7/1PPPPPPP/1NBQKBNR b Kkq - 1 2",
+				"1nbqkbnr/1ppppppp/r7/p7/P7/R7/1PPPPPPP/1NBQKBNR w Kk - 2 3",
+				"1nbqkbnr/1ppppppp/r7/p7/P6P/R7/1PPPPPP1/1NBQKBNR b Kk h3 0 3",
+				"1nbqkbnr/1pppppp1/r7/p6p/P6P/R7/1PPPPPP1/1NBQKBNR w Kk h6 0 4",
+				"1nbqkbnr/1pppppp1/r7/p6p/P6P/R6R/1PPPPPP1/1NBQKBN1 b k - 1 4",
+				"1nbqkbn1/1pppppp1/r6r/p6p/P6P/R6R/1PPPPPP1/1NBQKBN1 w - - 2 5",
+			}},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1",
+			[]PgnMove{
+				{number: 1, color: 1, moveValue: "O-O", emt: -1},
+				{number: 1, color: -1, moveValue: "O-O-O", emt: -1},
+			},
+			[]string{
+				"r3k2r/8/8/8/8/8/8/R4RK1 b kq - 1 1",
+				"2kr3r/8/8/8/8/8/8/R4RK1 w - - 2 2",
+			}},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1",
+			[]PgnMove{
+				{number: 1, color: 1, moveValue: "Rxa8+", emt: -1},
+				{number: 1, color: -1, moveValue: "Ke7", emt: -1},
+			},
+			[]string{
+				"R3k2r/8/8/8/8/8/8/4K2R b Kk - 0 1",
+				"R6r/4k3/8/8/8/8/8/4K2R w K - 1 2",
+			}},
+	}
+
+	for _, tt := range castlingTable {
+		t.Run(tt.fen, func(t *testing.T) {
+			board, err := NewPgnBoardFromFen(tt.fen)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			for idx, move := range tt.moves {
+				if err := board.Play(move, false); err != nil {
+					t.Fatalf("unexpected error '%v'", err)
+				}
+				assert(t, board.GetFen(), tt.want[idx])
+			}
+		})
+	}
+}
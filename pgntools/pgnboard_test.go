@@ -0,0 +1,96 @@
+package pgntools
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that moves are verified to be legal in strict mode. Legal moves are
+// given along with the resulting position and illegal moves with the reason
+func TestStrictMoves(t *testing.T) {
+
+	var strictTable = []struct {
+		fen  string
+		move string
+		want string
+		err  string
+	}{
+		// pinned pieces and kings moving into check
+		{"4k3/4r3/8/8/8/8/4N3/4K3 w - - 0 1", "Nc3", "", "leaves the king in check"},
+		{"4k3/8/8/8/8/8/r7/4K3 w - - 0 1", "Kf2", "", "leaves the king in check"},
+		{"4k3/8/8/8/8/8/r7/4K3 w - - 0 1", "Kf1", "4k3/8/8/8/8/8/r7/5K2 b - - 1 1", ""},
+		{"4k3/4r3/8/8/8/8/4N3/1N2K3 w - - 0 1", "Nc3", "4k3/4r3/8/8/8/2N5/4N3/4K3 b - - 1 1", ""},
+
+		// ambiguities
+		{"4k3/8/8/8/8/8/8/1N1K1N2 w - - 0 1", "Nd2", "", "ambiguous"},
+		{"4k3/8/8/8/8/8/8/1N1K1N2 w - - 0 1", "Nbd2", "4k3/8/8/8/8/8/3N4/3K1N2 b - - 1 1", ""},
+
+		// castling
+		{"4kr2/8/8/8/8/8/8/4K2R w K - 0 1", "O-O", "", "through or into check"},
+		{"4r1k1/8/8/8/8/8/8/4K2R w K - 0 1", "O-O", "", "while in check"},
+		{"4k3/8/8/8/8/8/8/4KB1R w K - 0 1", "O-O", "", "pieces between"},
+		{"4k3/8/8/8/8/8/8/4K2R w - - 0 1", "O-O", "", "not available"},
+		{"r3k3/8/8/8/8/8/8/4K3 b q - 0 1", "O-O-O", "2kr4/8/8/8/8/8/8/4K3 w - - 1 2", ""},
+
+		// captures, en passant and promotions
+		{"4k3/8/8/8/8/8/8/4K2R w - - 0 1", "Rxh5", "", "does not capture"},
+		{"4k3/8/8/7p/8/8/8/4K2R w - - 0 1", "Rh5", "", "not annotated"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 2", "exd6", "4k3/8/3P4/8/8/8/8/4K3 b - - 0 2", ""},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - - 0 2", "exd6", "", "does not capture"},
+		{"4k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a8", "", "have to be promoted"},
+		{"4k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a8=Q+", "Q3k3/8/8/8/8/8/8/4K3 b - - 0 1", ""},
+		{"4k3/8/8/8/8/4n3/4P3/4K3 w - - 0 1", "e4", "", "no piece can reach"},
+	}
+
+	for _, tt := range strictTable {
+		t.Run(tt.fen+" "+tt.move, func(t *testing.T) {
+			board, err := NewPgnBoardFromFen(tt.fen)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			board.SetStrict(true)
+			err = board.Play(PgnMove{number: 1, color: board.turn, moveValue: tt.move, emt: -1}, false)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got '%v' want an error with '%v'", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			assert(t, board.GetFen(), tt.want)
+		})
+	}
+}
+
+// Test that illegal moves are reported with the game and ply where they are
+// found
+func TestValidate(t *testing.T) {
+
+	var pgn = `[Event "A"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 Nd4 4. Nxe5 Qg5 5. Nxf7 Qxg2 6. Rg1 Qxe4+ 7. d3 1-0
+`
+	games, err := ReadGamesFromString(pgn, 0, "", "", ReadOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	game := games.slice[0]
+	err = game.Validate()
+	pgnerr, ok := err.(*PgnError)
+	if !ok {
+		t.Fatalf("got '%v' want a *PgnError", err)
+	}
+	if pgnerr.Kind != ErrMove || pgnerr.Game != 1 || pgnerr.Ply != 13 ||
+		pgnerr.Line != 3 || pgnerr.Column != 73 ||
+		!strings.Contains(pgnerr.Msg, "leaves the king in check") {
+		t.Fatalf("got '%v' (game %v, ply %v, line %v, column %v)",
+			pgnerr, pgnerr.Game, pgnerr.Ply, pgnerr.Line, pgnerr.Column)
+	}
+
+	// in strict mode, the game is rejected when it is read
+	if _, err = ReadGamesFromString(pgn, 0, "", "", ReadOptions{Strict: true}); err == nil {
+		t.Fatalf("an error was expected")
+	}
+}
@@ -20,11 +20,15 @@
 package pgntools
 
 import (
+	"errors"  // for inspecting errors
+	"fmt"     // printing msgs
 	"io"      // io streams
 	"log"     // logging services
 	"os"      // access to file mgmt functions
 	"regexp"  // pgn files are parsed with a regexp
+	"sort"    // for sorting games
 	"strconv" // to convert integers into strings
+	"strings" // natural order of strings
 
 	"text/template" // go facility for processing templates
 
@@ -44,13 +48,17 @@ import (
 // used as a key for sorting games. The direction is specified with either < or
 // > meaning increasing and decreasing order respectively; the variable to use
 // is preceded by '%' (there is no need actually to use that prefix and this is
-// done only for the sake of consistency across different commands of pgnparser)
-var reSortingCriteria = regexp.MustCompile(`^\s*(<|>)\s*%([A-Za-z]+)\s*`)
+// done only for the sake of consistency across different commands of pgnparser).
+// Computed fields with arguments can be used as well, e.g., %PlayerColor(alice).
+// Optionally, the variable can be followed by either missing_first or
+// missing_last to choose the position of games where it is missing
+var reSortingCriteria = regexp.MustCompile(`^\s*(<|>)\s*%([A-Za-z][A-Za-z0-9_]*(?:\([^)]*\))?)(?:\s+(missing_first|missing_last))?\s*`)
 
 // the following regexps are used to process histogram command lines
 
-// A histogram command line might consist of a title and a variable name
-var reHistogramCmdVar = regexp.MustCompile(`^\s*([A-Za-z0-9]+)\s*:\s*%([A-Za-z]+)\s*`)
+// A histogram command line might consist of a title and a variable name, which
+// might be a computed field with arguments
+var reHistogramCmdVar = regexp.MustCompile(`^\s*([A-Za-z0-9]+)\s*:\s*%([A-Za-z]+(?:\([^)]*\))?)\s*`)
 
 // Also, a histogram command line might consist of the definition of a case
 // which consists of a number of different regular expressions
@@ -64,12 +72,17 @@ var reHistogramCmdSubcase = regexp.MustCompile(`^\s*(?P<subtitle>[A-Za-z0-9]+)\s
 // direction is then defined as an integer
 type sortingDirection int
 
-// A pgnSorting consists of two items: a constant value for distinguishing
-// ascending from descending order and a variable name used as a key for sorting
-// pgn games
+// Games where a sorting key is missing are either rejected or placed before or
+// after all the others
+type missingPosition int
+
+// A pgnSorting consists of three items: a constant value for distinguishing
+// ascending from descending order, a variable name used as a key for sorting
+// pgn games and the position of games where the variable is missing
 type pgnSorting struct {
 	direction sortingDirection
 	variable  string
+	missing   missingPosition
 }
 
 // A PgnCollection consists of an arbitrary number of PgnGames along with a
@@ -79,11 +92,15 @@ type pgnSorting struct {
 
 // In addition, a PGN collection contains a sort descriptor which consists of a
 // slice of pairs that contain for each variable whether PGN games should be
-// sorted in increasing or decreasing order
+// sorted in increasing or decreasing order.
+//
+// Finally, collections store the diagnostics of all games that were skipped or
+// truncated in lenient mode and the warnings raised by any game
 type PgnCollection struct {
 	slice          []PgnGame
 	sortDescriptor []pgnSorting
 	nbGames        int
+	diagnostics    []PgnDiagnostic
 }
 
 // A histogram is indexed by keys. Keys are either variables (represented as a
@@ -132,6 +149,14 @@ const (
 	decreasing                              // decreasing order
 )
 
+// Games where a sorting key is missing are rejected unless they are explicitly
+// placed either first or last, regardless of the sorting direction
+const (
+	missingFail  missingPosition = 1 << iota // missing keys are errors
+	missingFirst                             // missing keys go first
+	missingLast                              // missing keys go last
+)
+
 // Methods
 // ----------------------------------------------------------------------------
 
@@ -150,6 +175,13 @@ func (games *PgnCollection) GetGame(index int) PgnGame {
 	return games.slice[index]
 }
 
+// Return the diagnostics of all games that were skipped or truncated when
+// reading this collection in lenient mode, along with the warnings raised by
+// any game
+func (games *PgnCollection) GetDiagnostics() []PgnDiagnostic {
+	return games.diagnostics
+}
+
 // Return the number of items in the collection
 func (games PgnCollection) Len() int {
 	return games.nbGames
@@ -168,16 +200,54 @@ func (games PgnCollection) Swap(i, j int) {
 // string specification. The string contains pairs of the form (<|>) and
 // %variable and there can be an arbitrary number of them. The first item is
 // used to decide whether to sort games in ascending or descending order; the
-// second one is used to decide what variable to use as a key.
+// second one is used to decide what variable to use as a key. Optionally,
+// every pair can be followed by either missing_first or missing_last to place
+// games where the variable is missing before or after all the others.
+// Otherwise, all games must have the variable
 func (games *PgnCollection) GetSortDescriptor(sortString string) []pgnSorting {
 
+	if err := games.parseSortDescriptor(sortString); err != nil {
+		log.Fatal(err)
+	}
+	return games.sortDescriptor
+}
+
+// Sort the games of this collection according to the sorting criteria given in
+// the specified string, see GetSortDescriptor. Sorting is stable, i.e., games
+// with the same values of all keys keep their relative order. It returns a
+// *PgnError if the string is not correct or any game lacks any of the variables
+// used as keys and it was not given where to place it
+func (games *PgnCollection) Sort(sortString string) error {
+
+	games.sortDescriptor = nil
+	if err := games.parseSortDescriptor(sortString); err != nil {
+		return err
+	}
+	sort.Stable(games)
+	return nil
+}
+
+// parseSortDescriptor is a helper function that adds to the sort descriptor of
+// this collection the sorting criteria given in the specified string. It returns
+// a *PgnError if the string is not correct or if any game lacks any of the
+// variables used as keys and it was not given where to place it
+func (games *PgnCollection) parseSortDescriptor(sortString string) error {
+
 	// extract all sorting criteria given in the string
 	for reSortingCriteria.MatchString(sortString) {
 
-		// extract the two groups in the sorting criteria: the direction
-		// and the key
+		// extract the groups in the sorting criteria: the direction, the
+		// key and, optionally, the position of missing values
 		tag := reSortingCriteria.FindStringSubmatchIndex(sortString)
 		direction, key := sortString[tag[2]:tag[3]], sortString[tag[4]:tag[5]]
+		missing := missingFail
+		if tag[6] >= 0 {
+			if sortString[tag[6]:tag[7]] == "missing_first" {
+				missing = missingFirst
+			} else {
+				missing = missingLast
+			}
+		}
 
 		// and move forward in the string
 		sortString = sortString[tag[1]:]
@@ -185,27 +255,124 @@ func (games *PgnCollection) GetSortDescriptor(sortString string) []pgnSorting {
 		// store the direction and key in this collection
 		var newSorting pgnSorting
 		if direction == "<" {
-			newSorting = pgnSorting{increasing, key}
+			newSorting = pgnSorting{increasing, key, missing}
 
 		} else if direction == ">" {
-			newSorting = pgnSorting{decreasing, key}
+			newSorting = pgnSorting{decreasing, key, missing}
 		} else {
-			log.Fatalf(" An unknown sorting direction has been found: '%v'", direction)
+			return newError(ErrQuery, direction, "unknown sorting direction")
 		}
 		games.sortDescriptor = append(games.sortDescriptor, newSorting)
 	}
 
 	// make sure here that the full sort descriptor was successfully processed
 	if len(sortString) > 0 {
-		log.Fatalf(" There was an error in the sort string at point '%v'", sortString)
+		return newError(ErrQuery, sortString, "syntax error in the sort string")
 	}
 
-	// and return the descriptor
-	return games.sortDescriptor
+	// finally, verify that all games have the keys that are not allowed to
+	// be missing. Values of different types are compared as strings
+	for _, descriptor := range games.sortDescriptor {
+		if descriptor.missing != missingFail {
+			continue
+		}
+		for _, game := range games.slice {
+			if _, ok := game.getValue(descriptor.variable); !ok {
+				return game.location.locate(newError(ErrTag, descriptor.variable,
+					"the variable does not exist and can not be used for sorting games unless missing_first or missing_last is given"))
+			}
+		}
+	}
+
+	return nil
+}
+
+// getSortingValue is a helper function that returns the value of the given
+// variable in the specified game to be used as a sorting key and whether it
+// exists or not. Dates, times and time controls are returned as typed values
+func getSortingValue(game *PgnGame, variable string) (pfparser.RelationalInterface, bool) {
+
+	content, ok := game.getValue(variable)
+	if !ok {
+		return nil, false
+	}
+	return getRelationalValue(variable, content), true
+}
+
+// compareValues is a helper function that returns -1, 0 or +1 if the value in
+// left goes before, along with or after the value in right. Integers, dates,
+// times and time controls are compared according to their type, and all other
+// values are compared as strings in natural order
+func compareValues(left, right pfparser.RelationalInterface) int {
+
+	if order, ok := pfparser.Order(left, right); ok {
+		return order
+	}
+	return compareNatural(fmt.Sprintf("%v", left), fmt.Sprintf("%v", right))
+}
+
+// compareNatural is a helper function that returns -1, 0 or +1 if the string
+// in left goes before, along with or after the one in right in natural order,
+// i.e., sequences of digits are compared by their numerical value so that, for
+// example, '60+0' goes before '180+2' and 'Round 9' goes before 'Round 10'
+func compareNatural(left, right string) int {
+
+	// digits returns the sequence of digits starting at the given position
+	// of the given string without leading zeroes, and the position after it
+	digits := func(text string, idx int) (string, int) {
+		start := idx
+		for idx < len(text) && text[idx] >= '0' && text[idx] <= '9' {
+			idx++
+		}
+		return strings.TrimLeft(text[start:idx], "0"), idx
+	}
+	isDigit := func(char byte) bool { return char >= '0' && char <= '9' }
+
+	i, j := 0, 0
+	for i < len(left) && j < len(right) {
+
+		// sequences of digits are compared first by their length and then
+		// lexicographically, which is the same as comparing their values
+		if isDigit(left[i]) && isDigit(right[j]) {
+			var lnumber, rnumber string
+			lnumber, i = digits(left, i)
+			rnumber, j = digits(right, j)
+			if len(lnumber) != len(rnumber) {
+				if len(lnumber) < len(rnumber) {
+					return -1
+				}
+				return +1
+			}
+			if order := strings.Compare(lnumber, rnumber); order != 0 {
+				return order
+			}
+			continue
+		}
+
+		// otherwise, compare the next characters
+		if left[i] != right[j] {
+			if left[i] < right[j] {
+				return -1
+			}
+			return +1
+		}
+		i, j = i+1, j+1
+	}
+
+	// if one string is a prefix of the other, the shortest goes first. Ties
+	// (e.g., '01' and '1') are broken lexicographically
+	if len(left)-i != len(right)-j {
+		if len(left)-i < len(right)-j {
+			return -1
+		}
+		return +1
+	}
+	return strings.Compare(left, right)
 }
 
 // Return true if the i-th game should be before the j-th game and false
-// otherwise
+// otherwise, i.e., if both games have the same values of all keys false is
+// returned
 func (games PgnCollection) Less(i, j int) bool {
 
 	// go over all items of the sort descriptor stored in this collection
@@ -213,40 +380,37 @@ func (games PgnCollection) Less(i, j int) bool {
 	// the i-th game should be before or after the j-th game
 	for _, descriptor := range games.sortDescriptor {
 
-		// first of all, check this variable exists in both games
-		icontent, ok := games.slice[i].tags[descriptor.variable]
-		if !ok {
+		// first of all, check whether this variable exists in both games
+		icontent, iok := getSortingValue(&games.slice[i], descriptor.variable)
+		jcontent, jok := getSortingValue(&games.slice[j], descriptor.variable)
+		if (!iok || !jok) && descriptor.missing == missingFail {
 			log.Fatalf("'%v' is not a variable and can not be used for sorting games",
 				descriptor.variable)
 		}
-		jcontent, ok := games.slice[j].tags[descriptor.variable]
-		if !ok {
-			log.Fatalf("'%v' is not a variable and can not be used for sorting games",
-				descriptor.variable)
+
+		// games where the variable is missing are placed either first or
+		// last regardless of the direction
+		if !iok || !jok {
+			if iok == jok {
+				continue
+			}
+			return iok == (descriptor.missing == missingLast)
 		}
 
 		// check the direction and then the variable to use
-		if descriptor.direction == increasing {
-			if icontent.Less(jcontent) {
-				return true
-			}
-			if icontent.Greater(jcontent) {
-				return false
-			}
-		} else if descriptor.direction == decreasing {
-			if icontent.Greater(jcontent) {
-				return true
-			}
-			if icontent.Less(jcontent) {
-				return false
-			}
-		} else {
+		order := compareValues(icontent, jcontent)
+		if descriptor.direction == decreasing {
+			order = -order
+		} else if descriptor.direction != increasing {
 			log.Fatalf(" Unknown sorting direction '%v'", descriptor.direction)
 		}
+		if order != 0 {
+			return order < 0
+		}
 	}
 
-	// if the sorting descriptor was exhausted, then return true by default
-	return true
+	// if the sorting descriptor was exhausted, then both games are equal
+	return false
 }
 
 // -- Histograms
@@ -295,44 +459,30 @@ func (key pgnKeyCases) GetSubtitle(game *PgnGame) dataInterface {
 
 	var ititle string
 
-	// first, start by creating a symbol table with all the information
-	// appearing in the headers of this game
-	symtable := make(map[string]pfparser.RelationalInterface)
-	for key, content := range game.tags {
-
-		// first, verify whether this is an integer
-		value, ok := content.(constInteger)
-		if ok {
-
-			symtable[key] = pfparser.ConstInteger(value)
-		} else {
-
-			// if not, check if it is a string
-			value, ok := content.(constString)
-			if ok {
-				symtable[key] = pfparser.ConstString(value)
-			} else {
-				log.Fatal(" Unknown type")
-			}
-		}
-	}
-
-	// for all cases in this specification
+	// first, compile all cases to know the variables used in them
+	var formulas []*pfparser.Formula
+	var names []string
 	for _, icase := range key.expressions {
-
-		// verify whether this expression is verified
-		var err error
-		var logEvaluator pfparser.LogicalEvaluator
-
-		// parse and evaluate this particular case
-		iexpression := icase.expression
-		logEvaluator, err = pfparser.Parse(&iexpression, 0)
+		formula, err := pfparser.Compile(icase.expression)
 		if err != nil {
 			log.Fatal(err)
 		}
+		if err = formula.CheckArity(getFieldArities()); err != nil {
+			log.Fatal(err)
+		}
+		formulas = append(formulas, formula)
+		names = append(names, formula.Variables()...)
+	}
+
+	// next, create a symbol table with all the information appearing in
+	// the headers of this game and the computed fields used in the cases
+	symtable := game.getSymtable(names...)
 
-		if logEvaluator.Evaluate(symtable) == pfparser.TypeBool(true) {
-			ititle = icase.title
+	// for all cases in this specification, verify whether its expression
+	// is verified
+	for idx, formula := range formulas {
+		if formula.Evaluate(symtable) == pfparser.TypeBool(true) {
+			ititle = key.expressions[idx].title
 		}
 	}
 
@@ -532,13 +682,14 @@ func (games *PgnCollection) GetSlice(fields ...string) []string {
 
 // returns a table according to the specification given in first place. Columns
 // are populated with the tags given in fields. It is intended to be used in
-// ascii table templates
-func (games *PgnCollection) GetTable(specline string, fields []string) tbl.Tbl {
+// ascii table templates, and it returns a *PgnError in case any field does not
+// exist in a game
+func (games *PgnCollection) GetTable(specline string, fields []string) (tbl.Tbl, error) {
 
 	// Create a table according to the given specification
 	table, err := tbl.NewTable(specline)
 	if err != nil {
-		log.Fatal(" Fatal error while constructing the table")
+		return table, newError(ErrTemplate, specline, "%v", err)
 	}
 
 	// Add the header
@@ -556,29 +707,58 @@ func (games *PgnCollection) GetTable(specline string, fields []string) tbl.Tbl {
 
 		// and show here the information from the specified fields for
 		// this game
-		table.AddRow(game.getFields(fields))
+		row, err := game.getFields(fields)
+		if err != nil {
+			return table, err
+		}
+		table.AddRow(row)
 	}
 
 	// End the table and return the table as a string
 	table.BottomRule()
-	return table
+	return table, nil
 }
 
 // Writes into the specified writer the result of instantiating the given
 // template file with information of all games in this collection. The template
 // acknowledges all tags of a pgngame plus others. For a full description, see
 // the manual.
-func (games *PgnCollection) GamesToWriterFromTemplate(dst io.Writer, templateFile string) {
+//
+// It returns a *PgnError if the template can not be processed. In case the
+// error was raised by a game, it is returned instead
+func (games *PgnCollection) WriteTemplate(dst io.Writer, templateFile string) error {
 
 	// access a template and parse its contents
 	template, err := template.ParseFiles(templateFile)
 	if err != nil {
-		log.Fatal(err)
+		return newError(ErrTemplate, templateFile, "%v", err)
 	}
 
 	// and now execute the template
-	err = template.Execute(dst, games)
-	if err != nil {
+	return games.executeTemplate(dst, template)
+}
+
+// executeTemplate is a helper function that writes into the specified writer
+// the result of executing the given template with information of all games in
+// this collection. Errors raised by games are returned unmodified
+func (games *PgnCollection) executeTemplate(dst io.Writer, template *template.Template) error {
+
+	if err := template.Execute(dst, games); err != nil {
+		var pgnerr *PgnError
+		if errors.As(err, &pgnerr) {
+			return pgnerr
+		}
+		return newError(ErrTemplate, template.Name(), "%v", err)
+	}
+	return nil
+}
+
+// Writes into the specified writer the result of instantiating the given
+// template file with information of all games in this collection. It behaves
+// like WriteTemplate but any error is fatal
+func (games *PgnCollection) GamesToWriterFromTemplate(dst io.Writer, templateFile string) {
+
+	if err := games.WriteTemplate(dst, templateFile); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -587,31 +767,41 @@ func (games *PgnCollection) GamesToWriterFromTemplate(dst io.Writer, templateFil
 // template file with information of all games in this collection. The template
 // acknowledges all tags of a pgngame plus others. For a full description, see
 // the manual.
-func (games *PgnCollection) GamesToFileFromTemplate(dst, templateFile string) {
+//
+// It returns a *PgnError if the file already exists or it can not be created or
+// the template can not be processed
+func (games *PgnCollection) WriteTemplateToFile(dst, templateFile string) error {
 
 	// access a template and parse its contents
 	template, err := template.ParseFiles(templateFile)
 	if err != nil {
-		log.Fatal(err)
+		return newError(ErrTemplate, templateFile, "%v", err)
 	}
 
 	// check if the file exists
 	if _, err = os.Stat(dst); err == nil {
-		log.Fatalf("The file '%v' already exists", dst)
+		return newError(ErrIO, dst, "the file already exists")
 	}
 
 	// now, open the file in read/write mode
 	file, err := os.Create(dst)
 	if err != nil {
-		log.Fatalf("It was not possible to create the file '%v'", dst)
+		return newError(ErrIO, dst, "%v", err)
 	}
 
 	// make sure the file is closed before leaving
 	defer file.Close()
 
 	// and now execute the template
-	err = template.Execute(file, games)
-	if err != nil {
+	return games.executeTemplate(file, template)
+}
+
+// Writes into the specified dst file the result of instantiating the given
+// template file with information of all games in this collection. It behaves
+// like WriteTemplateToFile but any error is fatal
+func (games *PgnCollection) GamesToFileFromTemplate(dst, templateFile string) {
+
+	if err := games.WriteTemplateToFile(dst, templateFile); err != nil {
 		log.Fatal(err)
 	}
 }
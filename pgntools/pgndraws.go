@@ -0,0 +1,92 @@
+/*
+  pgndraws.go
+  Description: Detection of draws by repetition, the move rules and
+  insufficient material
+*/
+
+package pgntools
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// While a game is replayed, the following struct counts the number of times
+// every position (identified by its Zobrist hash) has been reached and records
+// the first ply where every draw rule held: threefold and fivefold repetition,
+// the 50-move and 75-move rules and insufficient material. Plies are numbered
+// starting from 1 and those rules which never held are recorded with a null ply
+type pgnDraws struct {
+	positions    map[uint64]int
+	threefold    int
+	fivefold     int
+	fiftymoves   int
+	seventyfive  int
+	insufficient int
+}
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// newDraws is a helper function that returns a new record of draw rules for a
+// game which starts in the given board
+func newDraws(board *PgnBoard) *pgnDraws {
+	return &pgnDraws{positions: map[uint64]int{board.hash: 1}}
+}
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// isInsufficientMaterial is a helper function that returns true if neither side
+// can checkmate, i.e., if there are only kings and either one minor piece or
+// bishops all on squares of the same color
+func (board *PgnBoard) isInsufficientMaterial() bool {
+
+	var knights, bishops, colors int
+	for square, piece := range board.squares {
+		switch piece {
+		case WPAWN, BPAWN, WROOK, BROOK, WQUEEN, BQUEEN:
+			return false
+		case WKNIGHT, BKNIGHT:
+			knights += 1
+		case WBISHOP, BBISHOP:
+			bishops += 1
+			colors |= 1 << uint((square/8+square%8)%2)
+		}
+	}
+	return knights+bishops <= 1 || (knights == 0 && colors != 3)
+}
+
+// update is a helper function that records the position of the given board,
+// which was reached after the given ply, and the draw rules that held for the
+// first time in it
+func (draws *pgnDraws) update(board *PgnBoard, ply int) {
+
+	// first, the repetitions. Positions are the same if they have the same
+	// placement of pieces, side to move, castling ability and en passant
+	// captures, which is exactly what the Zobrist hash accounts for
+	draws.positions[board.hash] += 1
+	if draws.threefold == 0 && draws.positions[board.hash] >= 3 {
+		draws.threefold = ply
+	}
+	if draws.fivefold == 0 && draws.positions[board.hash] >= 5 {
+		draws.fivefold = ply
+	}
+
+	// next, the move rules which are given in plies without captures or
+	// pawn moves
+	if draws.fiftymoves == 0 && board.halfmove >= 100 {
+		draws.fiftymoves = ply
+	}
+	if draws.seventyfive == 0 && board.halfmove >= 150 {
+		draws.seventyfive = ply
+	}
+
+	// and finally, the material on the board
+	if draws.insufficient == 0 && board.isInsufficientMaterial() {
+		draws.insufficient = ply
+	}
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
@@ -0,0 +1,119 @@
+package pgntools
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// Test that the first ply where every draw rule held is recorded
+func TestDraws(t *testing.T) {
+
+	var drawsTable = []struct {
+		pgn    string
+		values map[string]int
+	}{
+		{"1. e4 e5 2. Nf3 Nc6 *", map[string]int{"ThreefoldRepetition": 0,
+			"FiftyMoveRule": 0, "InsufficientMaterial": 0}},
+		{"1. Nf3 Nf6 2. Ng1 Ng8 3. Nf3 Nf6 4. Ng1 Ng8 *", map[string]int{
+			"ThreefoldRepetition": 8, "FivefoldRepetition": 0}},
+		{"1. Nf3 Nf6 2. Ng1 Ng8 3. Nf3 Nf6 4. Ng1 Ng8 5. Nf3 Nf6 6. Ng1 Ng8 7. Nf3 Nf6 8. Ng1 Ng8 *",
+			map[string]int{"ThreefoldRepetition": 8, "FivefoldRepetition": 16}},
+
+		// the en passant capture is available only after the fourth
+		// ply, so that the same placement is not repeated until later
+		{"1. e4 Nf6 2. e5 d5 3. Nf3 Nd7 4. Ng1 Nf6 5. Nf3 Nd7 6. Ng1 Nf6 7. Nf3 Nd7 8. Ng1 Nf6 *",
+			map[string]int{"ThreefoldRepetition": 16}},
+		{"[SetUp \"1\"]\n[FEN \"4k3/8/8/8/8/8/R7/4K3 w - - 98 60\"]\n\n60. Ra3 Kd7 61. Ra4 *",
+			map[string]int{"FiftyMoveRule": 2, "SeventyFiveMoveRule": 0}},
+		{"[SetUp \"1\"]\n[FEN \"4k3/8/8/8/8/8/R7/4K3 w - - 149 60\"]\n\n60. Ra3 *",
+			map[string]int{"FiftyMoveRule": 1, "SeventyFiveMoveRule": 1}},
+		{"[SetUp \"1\"]\n[FEN \"4k3/8/8/8/8/8/R7/4K3 w - - 98 60\"]\n\n60. Ra3 Kd7 61. Kd1 *",
+			map[string]int{"FiftyMoveRule": 2}},
+		{"[SetUp \"1\"]\n[FEN \"4k3/8/8/8/8/8/3p4/4KB2 w - - 0 1\"]\n\n1. Kxd2 *",
+			map[string]int{"InsufficientMaterial": 1}},
+	}
+
+	for _, tt := range drawsTable {
+		t.Run(tt.pgn, func(t *testing.T) {
+			game, err := getGameFromString("[Event \"A\"]\n"+tt.pgn, false)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			if err = game.Replay(0); err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			for name, ply := range tt.values {
+				value, ok := game.getValue(name)
+				if !ok || value != constInteger(ply) {
+					t.Errorf("got %v = %v want %v", name, value, ply)
+				}
+			}
+		})
+	}
+}
+
+// Test that insufficient material is correctly detected
+func TestInsufficientMaterial(t *testing.T) {
+
+	var materialTable = []struct {
+		fen  string
+		want bool
+	}{
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/4KN2 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/4KB2 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/1n2KN2 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/8/2b1KB2 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/8/3bKB2 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/6b1/4KB2 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/4KR2 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", false},
+	}
+
+	for _, tt := range materialTable {
+		board, err := NewPgnBoardFromFen(tt.fen)
+		if err != nil {
+			t.Fatalf("unexpected error '%v'", err)
+		}
+		if board.isInsufficientMaterial() != tt.want {
+			t.Errorf("got %v want %v for '%v'", !tt.want, tt.want, tt.fen)
+		}
+	}
+}
+
+// Test that the draw rules can be used in queries and tables
+func TestDrawsQuery(t *testing.T) {
+
+	var pgn = `[Event "First"]
+
+1. Nf3 Nf6 2. Ng1 Ng8 3. Nf3 Nf6 4. Ng1 Ng8 1/2-1/2
+
+[Event "Second"]
+
+1. e4 e5 1-0
+`
+
+	reader := NewReader(strings.NewReader(pgn))
+	if err := reader.SetQuery("%ThreefoldRepetition > 0"); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	var events []string
+	for {
+		game, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error '%v'", err)
+		}
+		event, _ := game.getField("Event")
+		events = append(events, event)
+		ply, _ := game.getField("ThreefoldRepetition")
+		assert(t, ply, "8")
+		status, _ := game.getField("Status")
+		assert(t, status, "Draw")
+	}
+	assert(t, strings.Join(events, " "), "First")
+}
@@ -0,0 +1,258 @@
+/*
+  pgnerror.go
+  Description: Errors raised while processing chess games in PGN format
+*/
+
+package pgntools
+
+import (
+	"fmt"     // printing msgs
+	"sort"    // binary search
+	"strings" // string manipulation
+)
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// Errors are classified in different kinds which are represented with an
+// integer that is matched against the constants: ErrSyntax, ErrTag, ErrMove,
+// ErrQuery, ErrTemplate and ErrIO
+type ErrorKind int
+
+// A PgnError describes a failure while processing a collection of chess
+// games. Besides the kind of error and a description, it stores the index of
+// the game where it happened (starting at 1), the byte offset of the
+// offending text in the input stream and its line and column (both starting at
+// 1). In case the error was raised while replaying the moves of a game, the ply
+// where it happened is stored as well (starting at 1).
+//
+// Those fields which are not known are null. However, the offset is -1 when
+// unknown.
+type PgnError struct {
+	Kind   ErrorKind
+	Game   int
+	Offset int64
+	Line   int
+	Column int
+	Ply    int
+	Text   string
+	Msg    string
+}
+
+// In lenient mode, games which can not be processed are either skipped or
+// truncated at the last legal move. Besides, games might raise warnings that do
+// not prevent them from being processed. These actions are represented with an
+// integer that is matched against the constants Skipped, Truncated and Warning
+type DiagnosticAction int
+
+// A PgnDiagnostic records a problem found in lenient mode: the index of the game
+// (starting at 1), the line and column where it was found (both starting at 1,
+// or null if unknown), the ply where the game was truncated (null if it was
+// skipped), the reason and the action taken
+type PgnDiagnostic struct {
+	Game   int
+	Line   int
+	Column int
+	Ply    int
+	Reason string
+	Action DiagnosticAction
+}
+
+// The location of a game in the input stream is used to compute the position
+// of any offending text within it. It consists of the index of the game, the
+// byte offset, line and column where it starts and the offsets (relative to
+// the beginning of the game) of all newlines within it
+type pgnLocation struct {
+	index    int
+	offset   int64
+	line     int
+	column   int
+	newlines []int
+}
+
+// constants
+// ----------------------------------------------------------------------------
+
+// An error can be of any of the following kinds
+const (
+	ErrSyntax   ErrorKind = 1 << iota // malformed transcription of a game
+	ErrTag                            // missing or malformed tag
+	ErrMove                           // a move can not be reproduced
+	ErrQuery                          // malformed query or sorting criteria
+	ErrTemplate                       // error while processing a template
+	ErrIO                             // input/output error
+)
+
+// A diagnostic records any of the following actions
+const (
+	Skipped   DiagnosticAction = 1 << iota // the game was not returned
+	Truncated                              // the game was truncated
+	Warning                                // the game was not modified
+)
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// newError is a helper function that returns a new PgnError of the given kind
+// with the given offending text and a formatted description. Its location is
+// unknown
+func newError(kind ErrorKind, text string, format string, a ...interface{}) *PgnError {
+	return &PgnError{Kind: kind, Offset: -1, Text: text, Msg: fmt.Sprintf(format, a...)}
+}
+
+// newSyntaxError is a helper function that returns a new syntax error found at
+// the given offset relative to the beginning of a game. Only an excerpt of the
+// offending text is stored
+func newSyntaxError(offset int, text, msg string) *PgnError {
+	return newError(ErrSyntax, excerpt(text), "%s", msg).at(offset)
+}
+
+// excerpt is a helper function that returns the first line of the given text
+// truncated to a reasonable length, so that it can be shown in error messages
+func excerpt(text string) string {
+
+	const length = 40
+
+	if idx := strings.IndexAny(text, "\r\n"); idx >= 0 {
+		text = text[:idx]
+	}
+	if len(text) > length {
+		text = text[:length] + "..."
+	}
+	return text
+}
+
+// newLocation is a helper function that returns the location of the given game
+// which starts at the given offset, line and column of the input stream
+func newLocation(pgn string, index int, offset int64, line, column int) (location pgnLocation) {
+
+	location = pgnLocation{index: index, offset: offset, line: line, column: column}
+	for idx := 0; idx < len(pgn); idx++ {
+		if pgn[idx] == '\n' {
+			location.newlines = append(location.newlines, idx)
+		}
+	}
+	return
+}
+
+// newDiagnostic is a helper function that returns a diagnostic that records the
+// given action taken because of the specified error
+func newDiagnostic(err *PgnError, action DiagnosticAction) PgnDiagnostic {
+	return PgnDiagnostic{Game: err.Game, Line: err.Line, Column: err.Column,
+		Ply: err.Ply, Reason: err.reason(), Action: action}
+}
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// Return a string with a description of this error, preceded by its location
+// if it is known
+func (err *PgnError) Error() (output string) {
+
+	if err.Game > 0 {
+		output += fmt.Sprintf("game #%v", err.Game)
+		if err.Line > 0 {
+			output += fmt.Sprintf(" (line %v, column %v)", err.Line, err.Column)
+		}
+		if err.Ply > 0 {
+			output += fmt.Sprintf(" ply %v", err.Ply)
+		}
+		output += ": "
+	}
+	return output + err.reason()
+}
+
+// reason is a helper function that returns the description of this error along
+// with the offending text, if any
+func (err *PgnError) reason() string {
+	if err.Text != "" {
+		return fmt.Sprintf("%v in %q", err.Msg, err.Text)
+	}
+	return err.Msg
+}
+
+// Return a string with the name of this kind of error
+func (kind ErrorKind) String() string {
+	switch kind {
+	case ErrSyntax:
+		return "syntax error"
+	case ErrTag:
+		return "tag error"
+	case ErrMove:
+		return "move error"
+	case ErrQuery:
+		return "query error"
+	case ErrTemplate:
+		return "template error"
+	case ErrIO:
+		return "i/o error"
+	}
+	return "unknown error"
+}
+
+// Return a string with the name of this action
+func (action DiagnosticAction) String() string {
+	switch action {
+	case Skipped:
+		return "skipped"
+	case Truncated:
+		return "truncated"
+	case Warning:
+		return "warning"
+	}
+	return "unknown action"
+}
+
+// Return a string with the location of this diagnostic, the action taken and
+// its reason
+func (diagnostic PgnDiagnostic) String() (output string) {
+
+	output = fmt.Sprintf("game #%v", diagnostic.Game)
+	if diagnostic.Line > 0 {
+		output += fmt.Sprintf(" (line %v, column %v)", diagnostic.Line, diagnostic.Column)
+	}
+	if diagnostic.Ply > 0 {
+		output += fmt.Sprintf(" ply %v", diagnostic.Ply)
+	}
+	return output + fmt.Sprintf(" %v: %v", diagnostic.Action, diagnostic.Reason)
+}
+
+// at sets the offset of this error relative to the beginning of the game where
+// it was found and returns it. This offset is translated into a location in the
+// input stream with locate
+func (err *PgnError) at(offset int) *PgnError {
+	err.Offset = int64(offset)
+	return err
+}
+
+// locate updates the given error with the index of this game and the position
+// in the input stream of its offset, which is assumed to be relative to the
+// beginning of the game. If the error already has a location it is not
+// modified, and if its offset is unknown only the index of the game is updated
+func (location pgnLocation) locate(err *PgnError) *PgnError {
+
+	if err.Game == 0 {
+		err.Game = location.index
+	}
+	if err.Line > 0 || err.Offset < 0 || location.line == 0 {
+		return err
+	}
+
+	// count the number of newlines before the given offset
+	offset := int(err.Offset)
+	nblines := sort.SearchInts(location.newlines, offset)
+
+	err.Offset += location.offset
+	err.Line = location.line + nblines
+	if nblines == 0 {
+		err.Column = location.column + offset
+	} else {
+		err.Column = offset - location.newlines[nblines-1]
+	}
+	return err
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
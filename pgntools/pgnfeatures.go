@@ -0,0 +1,181 @@
+/*
+  pgnfeatures.go
+  Description: Features of the positions reached in chess games that can be
+  used in queries
+*/
+
+package pgntools
+
+import (
+	"strings" // string manipulation
+
+	// import the parser of propositional formulae
+	"github.com/clinaresl/pgnparser/pfparser"
+)
+
+// globals
+// ----------------------------------------------------------------------------
+
+// the following map stores the value of every piece. Kings have no value
+var materialValues = map[int]int{
+	WPAWN: 1, WKNIGHT: 3, WBISHOP: 3, WROOK: 5, WQUEEN: 9,
+}
+
+// the following map stores the number of arguments of every function added to
+// the symbol table of queries, see addFunctions
+var functionArities = map[string]int{
+	"WhiteMaterial": 1,
+	"BlackMaterial": 1,
+	"Material":      1,
+}
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// While a game is replayed, the following struct records the material of both
+// sides after every ply, the first ply where an ending with opposite-coloured
+// bishops was reached, the first ply where no queens were left on the board
+// (provided that there were queens before), the first ply where a pawn was
+// promoted and how both sides castled, if they did. Plies are numbered starting
+// from 1 and those features which never happened are recorded with a null ply
+type pgnFeatures struct {
+	material        [][2]int
+	oppositeBishops int
+	queensTraded    int
+	promotion       int
+	castling        [2]string
+	queens          bool
+}
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// newFeatures is a helper function that returns a new record of features for a
+// game which starts in the given board
+func newFeatures(board *PgnBoard) *pgnFeatures {
+
+	white, black := board.getMaterial()
+	return &pgnFeatures{material: [][2]int{{white, black}}, castling: [2]string{"-", "-"},
+		queens: board.hasQueens()}
+}
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// getMaterial is a helper function that returns the material of both sides in
+// this board, where pawns are worth 1, knights and bishops 3, rooks 5 and
+// queens 9
+func (board *PgnBoard) getMaterial() (white, black int) {
+
+	for _, piece := range board.squares {
+		if piece > 0 {
+			white += materialValues[piece]
+		} else {
+			black += materialValues[-piece]
+		}
+	}
+	return
+}
+
+// isOppositeBishops is a helper function that returns true if this board is an
+// ending with opposite-coloured bishops, i.e., if besides kings and pawns both
+// sides have only one bishop each and they move on squares of different colors
+func (board *PgnBoard) isOppositeBishops() bool {
+
+	var bishops [2]int
+	var colors [2]int
+	for square, piece := range board.squares {
+		switch piece {
+		case WKNIGHT, BKNIGHT, WROOK, BROOK, WQUEEN, BQUEEN:
+			return false
+		case WBISHOP, BBISHOP:
+			side := (1 - getColor(piece)) / 2
+			bishops[side] += 1
+			colors[side] = (square/8 + square%8) % 2
+		}
+	}
+	return bishops[0] == 1 && bishops[1] == 1 && colors[0] != colors[1]
+}
+
+// hasQueens is a helper function that returns true if there is any queen in
+// this board
+func (board *PgnBoard) hasQueens() bool {
+
+	for _, piece := range board.squares {
+		if piece == WQUEEN || piece == BQUEEN {
+			return true
+		}
+	}
+	return false
+}
+
+// update is a helper function that records the features of the given board,
+// which was reached after playing the given move in the given ply
+func (features *pgnFeatures) update(board *PgnBoard, move PgnMove, ply int) {
+
+	white, black := board.getMaterial()
+	features.material = append(features.material, [2]int{white, black})
+
+	if features.oppositeBishops == 0 && board.isOppositeBishops() {
+		features.oppositeBishops = ply
+	}
+	if board.hasQueens() {
+		features.queens = true
+	} else if features.queensTraded == 0 && features.queens {
+		features.queensTraded = ply
+	}
+	if features.promotion == 0 && strings.Contains(move.moveValue, "=") {
+		features.promotion = ply
+	}
+
+	// castling is recorded for the side that moved, which is now the
+	// opposite of the side to move
+	if side := (1 + board.turn) / 2; strings.HasPrefix(move.moveValue, "O-O") {
+		features.castling[side] = strings.TrimRight(move.moveValue, "+#")
+	}
+}
+
+// getMaterialFunction is a helper function that returns a function to be used
+// in queries which computes the material after the ply given as its only
+// argument with the given function. Plies beyond the end of the game refer to
+// the final position, and the material is null if the argument is not a
+// non-negative integer. The number of arguments is verified when the query is
+// given, see SetQuery
+func (game *PgnGame) getMaterialFunction(value func(material [2]int) int) pfparser.Function {
+
+	return func(args []pfparser.RelationalInterface) pfparser.RelationalInterface {
+
+		ply, ok := args[0].(pfparser.ConstInteger)
+		if !ok || ply < 0 {
+			return pfparser.ConstNull{}
+		}
+		if int(ply) >= len(game.material) {
+			ply = pfparser.ConstInteger(len(game.material) - 1)
+		}
+		return pfparser.ConstInteger(value(game.material[ply]))
+	}
+}
+
+// addFunctions is a helper function that adds to the given symbol table all
+// functions that can be used in queries over this game: WhiteMaterial,
+// BlackMaterial and Material (the difference between both) after the given ply
+func (game *PgnGame) addFunctions(symtable map[string]pfparser.RelationalInterface) {
+
+	if len(game.material) == 0 {
+		return
+	}
+	symtable["WhiteMaterial"] = game.getMaterialFunction(func(material [2]int) int {
+		return material[0]
+	})
+	symtable["BlackMaterial"] = game.getMaterialFunction(func(material [2]int) int {
+		return material[1]
+	})
+	symtable["Material"] = game.getMaterialFunction(func(material [2]int) int {
+		return material[0] - material[1]
+	})
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
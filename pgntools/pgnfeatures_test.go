@@ -0,0 +1,119 @@
+package pgntools
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// a short collection of games with promotions, castling, queen trades and
+// endings with opposite-coloured bishops
+var featuresGames = `[Event "First"]
+
+1. e4 d5 2. exd5 c6 3. dxc6 Nf6 4. cxb7 e6 5. bxa8=Q Be7 6. Nf3 O-O 7. Be2 Nd5
+8. O-O *
+
+[Event "Second"]
+
+1. e4 e5 2. d4 exd4 3. Qxd4 Qf6 4. Qxf6 Nxf6 *
+
+[Event "Third"]
+[SetUp "1"]
+[FEN "4k3/4b3/8/8/8/8/3nB3/4K3 w - - 0 1"]
+
+1. Kxd2 Kd8 *
+
+[Event "Fourth"]
+[SetUp "1"]
+[FEN "r3k3/3b4/8/8/8/8/4B3/R3K3 w Qq - 0 1"]
+
+1. O-O-O O-O-O+ *
+`
+
+// Test that the features of the positions reached are computed
+func TestFeatures(t *testing.T) {
+
+	var featuresTable = []struct {
+		event  string
+		values map[string]dataInterface
+	}{
+		{"First", map[string]dataInterface{"Promotion": constInteger(9),
+			"WhiteCastling": constString("O-O"), "BlackCastling": constString("O-O"),
+			"QueensTraded": constInteger(0), "OppositeBishops": constInteger(0)}},
+		{"Second", map[string]dataInterface{"Promotion": constInteger(0),
+			"WhiteCastling": constString("-"), "BlackCastling": constString("-"),
+			"QueensTraded": constInteger(8)}},
+		{"Third", map[string]dataInterface{"OppositeBishops": constInteger(1),
+			"QueensTraded": constInteger(0)}},
+		{"Fourth", map[string]dataInterface{"OppositeBishops": constInteger(0),
+			"WhiteCastling": constString("O-O-O"), "BlackCastling": constString("O-O-O")}},
+	}
+
+	games, err := ReadGamesFromString(featuresGames, 0, "", "", ReadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	for idx, tt := range featuresTable {
+		game := games.GetGame(idx)
+		event, _ := game.getField("Event")
+		assert(t, event, tt.event)
+		for name, want := range tt.values {
+			value, ok := game.getValue(name)
+			if !ok || value != want {
+				t.Errorf("got %v = %v want %v in game '%v'", name, value, want, tt.event)
+			}
+		}
+	}
+}
+
+// Test that queries can use the features of the positions reached and the
+// material after any ply
+func TestFeaturesQuery(t *testing.T) {
+
+	var queryTable = []struct {
+		query  string
+		events string
+	}{
+		{"%Promotion > 0", "First"},
+		{"%WhiteCastling = 'O-O-O' or %BlackCastling = 'O-O'", "First Fourth"},
+		{"%QueensTraded > 0 and %QueensTraded <= 38", "Second"},
+		{"%OppositeBishops > 0", "Third"},
+		{"%WhiteMaterial(9) = 47 and %BlackMaterial(9) = 31", "First"},
+		{"%Material(9) = 16", "First"},
+		{"%Material(0) = 0 and %Material(1000) = 0", "Second Fourth"},
+		{"%BlackMaterial(0) > %WhiteMaterial(0)", "Third"},
+		{"%Material(-3) = 0", ""},
+		{"%Material('x') = 0 or %Material(0) = 0", "First Second Fourth"},
+	}
+
+	for _, tt := range queryTable {
+		t.Run(tt.query, func(t *testing.T) {
+			reader := NewReader(strings.NewReader(featuresGames))
+			if err := reader.SetQuery(tt.query); err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			var events []string
+			for {
+				game, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error '%v'", err)
+				}
+				event, _ := game.getField("Event")
+				events = append(events, event)
+			}
+			assert(t, strings.Join(events, " "), tt.events)
+		})
+	}
+
+	// functions used with a wrong number of arguments are reported when
+	// the query is set
+	for _, query := range []string{"%Material(1, 2) > 0", "%Material() > 0", "%WhiteMaterial > 0"} {
+		err := NewReader(strings.NewReader(featuresGames)).SetQuery(query)
+		if pgnerr, ok := err.(*PgnError); !ok || pgnerr.Kind != ErrQuery || !strings.Contains(err.Error(), "column 1") {
+			t.Errorf("a query error was expected in '%v' but '%v' was found", query, err)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+/*
+  pgnfields.go
+  Description: Registry of fields computed from chess games
+*/
+
+package pgntools
+
+import (
+	"errors"  // for signaling errors
+	"fmt"     // printing msgs
+	"regexp"  // fields with arguments are parsed with a regexp
+	"sort"    // names of fields are sorted
+	"strings" // string manipulation
+
+	// import the parser of propositional formulae
+	"github.com/clinaresl/pgnparser/pfparser"
+)
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// Computed fields are named functions of games. They compute a value from the
+// given game and the arguments given to the field, if any, and return it along
+// with nil, or an error if it can not be computed. Values have to be either
+// integers (int) or strings
+type FieldFunction func(game *PgnGame, args []string) (interface{}, error)
+
+// A computed field consists of the number of arguments it expects and the
+// function that computes its value
+type pgnField struct {
+	arity    int
+	function FieldFunction
+}
+
+// globals
+// ----------------------------------------------------------------------------
+
+// fields with arguments are given as the name of the field immediately followed
+// by a parenthesized list of arguments separated by commas, e.g.,
+// PlayerColor(clinares)
+var reFieldCall = regexp.MustCompile(`^\s*(?P<name>[A-Za-z0-9_]+)\((?P<args>[^)]*)\)\s*$`)
+
+// the following map is the registry of computed fields, which can be extended
+// with RegisterField
+var fields = map[string]pgnField{
+	"Moves":         {0, getMovesField},
+	"Result":        {0, getResultField},
+	"Variations":    {0, getVariationsField},
+	"EloDiff":       {0, getEloDiffField},
+	"OpeningFamily": {0, getOpeningFamilyField},
+	"Winner":        {0, getWinnerField},
+	"Loser":         {0, getLoserField},
+	"PlayerColor":   {1, getPlayerColorField},
+	"Duration":      {0, getDurationField},
+	"FinalFEN":      {0, getFinalFENField},
+	"Captures":      {0, getCapturesField},
+	"Checks":        {0, getChecksField},
+}
+
+// the following map stores the name of every volume of the Encyclopaedia of
+// Chess Openings, which is used as the opening family when the name of the
+// opening is not known
+var ecoVolumes = map[byte]string{
+	'A': "Flank Openings",
+	'B': "Semi-Open Games",
+	'C': "Open Games",
+	'D': "Closed Games",
+	'E': "Indian Defences",
+}
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// Register the given function as a computed field with the given name which
+// expects the given number of arguments. It replaces any field previously
+// registered with the same name. Computed fields can be used in ascii tables,
+// templates, sorting criteria, queries and histograms. In queries, fields with
+// arguments are used as functions, e.g., %PlayerColor('clinares')
+func RegisterField(name string, arity int, function FieldFunction) {
+	fields[name] = pgnField{arity, function}
+}
+
+// getFieldArities is a helper function that returns the number of arguments
+// expected by every computed field and every function that can be used in
+// queries indexed by its name
+func getFieldArities() map[string]int {
+
+	arities := make(map[string]int)
+	for name, arity := range functionArities {
+		arities[name] = arity
+	}
+	for name, field := range fields {
+		arities[name] = field.arity
+	}
+	return arities
+}
+
+// Return the names of all computed fields in alphabetical order
+func GetFieldNames() (names []string) {
+
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// parseFieldCall is a helper function that returns the name and arguments of
+// the given field. Arguments might be single quoted, so that they can contain
+// commas, and they are returned without quotes
+func parseFieldCall(field string) (name string, args []string) {
+
+	tag := reFieldCall.FindStringSubmatchIndex(field)
+	if tag == nil {
+		return strings.TrimSpace(field), nil
+	}
+	name, list := field[tag[2]:tag[3]], field[tag[4]:tag[5]]
+	if strings.TrimSpace(list) == "" {
+		return name, []string{}
+	}
+	quoted, start := false, 0
+	for idx := 0; idx <= len(list); idx++ {
+		if idx < len(list) && list[idx] == '\'' {
+			quoted = !quoted
+		}
+		if idx == len(list) || (list[idx] == ',' && !quoted) {
+			args = append(args, strings.Trim(strings.TrimSpace(list[start:idx]), "'"))
+			start = idx + 1
+		}
+	}
+	return
+}
+
+// getTag is a helper function that returns the value of the given tag of the
+// given game, or a *PgnError if it does not exist. Note that computed fields
+// are not considered
+func getTag(game *PgnGame, name string) (dataInterface, error) {
+
+	value, ok := game.tags[name]
+	if !ok {
+		return nil, game.location.locate(newError(ErrTag, name, "tag not found"))
+	}
+	return value, nil
+}
+
+// getIntegerTag is a helper function that returns the value of the given tag of
+// the given game as an integer, or an error if it does not exist or it is not
+// an integer
+func getIntegerTag(game *PgnGame, name string) (int, error) {
+
+	value, err := getTag(game, name)
+	if err != nil {
+		return 0, err
+	}
+	integer, ok := value.(constInteger)
+	if !ok {
+		return 0, game.location.locate(newError(ErrTag, fmt.Sprintf("%v", value),
+			"it was not possible to convert the %v into an integer", name))
+	}
+	return int(integer), nil
+}
+
+// getMovesField returns the number of moves of the given game (two plies
+// each) as given in the tag PlyCount
+func getMovesField(game *PgnGame, args []string) (interface{}, error) {
+
+	// get the ply count of this game
+	plies, err := getIntegerTag(game, "PlyCount")
+	if err != nil {
+		return nil, err
+	}
+
+	// now, compute the number of moves from the number of plies. If the
+	// number of plies is even, then the number of moves is half the number
+	// of plies, otherwise, add 1
+	return (plies + 1) / 2, nil
+}
+
+// getResultField returns a utf-8 string with the final result of the given
+// game
+func getResultField(game *PgnGame, args []string) (interface{}, error) {
+
+	if game.outcome.scoreWhite == 0.5 {
+		return "½-½", nil
+	} else if game.outcome.scoreWhite == 1 {
+		return "1-0", nil
+	}
+	return "0-1", nil
+}
+
+// getVariationsField returns the number of variations found in the given game,
+// including those nested within other variations
+func getVariationsField(game *PgnGame, args []string) (interface{}, error) {
+	return countVariations(game.moves), nil
+}
+
+// getEloDiffField returns the difference between the ratings of white and
+// black
+func getEloDiffField(game *PgnGame, args []string) (interface{}, error) {
+
+	white, err := getIntegerTag(game, "WhiteElo")
+	if err != nil {
+		return nil, err
+	}
+	black, err := getIntegerTag(game, "BlackElo")
+	if err != nil {
+		return nil, err
+	}
+	return white - black, nil
+}
+
+// getOpeningFamilyField returns the family of the opening of the given game,
+// i.e., the name of the opening given in the tag Opening without variations or
+// the name of the volume of its ECO code otherwise
+func getOpeningFamilyField(game *PgnGame, args []string) (interface{}, error) {
+
+	if value, ok := game.tags["Opening"]; ok {
+		family := strings.SplitN(fmt.Sprintf("%v", value), ":", 2)[0]
+		if idx := strings.Index(family, " #"); idx >= 0 {
+			family = family[:idx]
+		}
+		return strings.TrimSpace(family), nil
+	}
+	if value, ok := game.tags["ECO"]; ok {
+		if eco := fmt.Sprintf("%v", value); len(eco) > 0 {
+			if family, ok := ecoVolumes[eco[0]]; ok {
+				return family, nil
+			}
+		}
+	}
+	return nil, errors.New("the opening is not known")
+}
+
+// getPlayer is a helper function that returns the name of the player of the
+// given game who obtained the given score, or '-' if none did
+func getPlayer(game *PgnGame, score float32) (interface{}, error) {
+
+	var name string
+	switch {
+	case game.outcome.scoreWhite == score && game.outcome.scoreBlack != score:
+		name = "White"
+	case game.outcome.scoreBlack == score && game.outcome.scoreWhite != score:
+		name = "Black"
+	default:
+		return "-", nil
+	}
+	value, err := getTag(game, name)
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// getWinnerField returns the name of the player who won the given game, or '-'
+// if it was drawn
+func getWinnerField(game *PgnGame, args []string) (interface{}, error) {
+	return getPlayer(game, 1)
+}
+
+// getLoserField returns the name of the player who lost the given game, or '-'
+// if it was drawn
+func getLoserField(game *PgnGame, args []string) (interface{}, error) {
+	return getPlayer(game, 0)
+}
+
+// getPlayerColorField returns the color played by the player given in the only
+// argument, either 'White' or 'Black', or '-' if the player did not play the
+// given game
+func getPlayerColorField(game *PgnGame, args []string) (interface{}, error) {
+
+	for _, color := range []string{"White", "Black"} {
+		if value, ok := game.tags[color]; ok && fmt.Sprintf("%v", value) == args[0] {
+			return color, nil
+		}
+	}
+	return "-", nil
+}
+
+// getDurationField returns the duration of the given game in seconds computed
+// as the sum of the elapsed move times of all moves of its mainline. It
+// returns an error if no move has an elapsed move time
+func getDurationField(game *PgnGame, args []string) (interface{}, error) {
+
+	var duration float32
+	found := false
+	for _, move := range game.moves {
+		if move.emt != -1 {
+			duration += move.emt
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("the elapsed move times are not known")
+	}
+	return int(duration + 0.5), nil
+}
+
+// getFinalFENField returns the FEN string of the final position of the given
+// game
+func getFinalFENField(game *PgnGame, args []string) (interface{}, error) {
+	return game.GetFenAt(len(game.moves))
+}
+
+// getCapturesField returns the number of captures in the mainline of the given
+// game
+func getCapturesField(game *PgnGame, args []string) (interface{}, error) {
+
+	captures := 0
+	for _, move := range game.moves {
+		if strings.Contains(move.moveValue, "x") {
+			captures += 1
+		}
+	}
+	return captures, nil
+}
+
+// getChecksField returns the number of checks (including checkmates) in the
+// mainline of the given game
+func getChecksField(game *PgnGame, args []string) (interface{}, error) {
+
+	checks := 0
+	for _, move := range game.moves {
+		if strings.ContainsAny(move.moveValue, "+#") {
+			checks += 1
+		}
+	}
+	return checks, nil
+}
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// computeField is a helper function that returns the value of the given
+// computed field for this game, which can be given with arguments, and whether
+// it is a registered field or not. It returns a *PgnError if the field is
+// registered but its value can not be computed
+func (game *PgnGame) computeField(field string) (value dataInterface, found bool, err error) {
+
+	name, args := parseFieldCall(field)
+	return game.callField(field, name, args)
+}
+
+// callField is a helper function that returns the value of the computed field
+// with the given name for this game with the given arguments, and whether it
+// is a registered field or not. Errors are reported with the given text of the
+// field
+func (game *PgnGame) callField(field, name string, args []string) (value dataInterface, found bool, err error) {
+
+	registered, found := fields[name]
+	if !found {
+		return nil, false, nil
+	}
+	if len(args) != registered.arity {
+		return nil, true, game.location.locate(newError(ErrTag, field,
+			"the field '%v' expects %v arguments", name, registered.arity))
+	}
+
+	// compute the value of the field and convert it to the types of data
+	// stored in games
+	result, err := registered.function(game, args)
+	if err != nil {
+		if _, ok := err.(*PgnError); ok {
+			return nil, true, err
+		}
+		return nil, true, game.location.locate(newError(ErrTag, field, "%v", err))
+	}
+	switch result := result.(type) {
+	case int:
+		return constInteger(result), true, nil
+	case string:
+		return constString(result), true, nil
+	}
+	return nil, true, game.location.locate(newError(ErrTag, field,
+		"the field computed a value of type %T which is neither an integer nor a string", result))
+}
+
+// getFieldFunction is a helper function that returns a function to be used in
+// queries which computes the given field with arguments. Its arguments are
+// given to the field as strings and it is null if the field can not be
+// computed. The number of arguments is verified when the query is given, see
+// SetQuery
+func (game *PgnGame) getFieldFunction(name string) pfparser.Function {
+
+	return func(args []pfparser.RelationalInterface) pfparser.RelationalInterface {
+
+		texts := make([]string, len(args))
+		for idx, arg := range args {
+			texts[idx] = fmt.Sprintf("%v", arg)
+		}
+		value, _, err := game.callField(name, name, texts)
+		if err != nil {
+			return pfparser.ConstNull{}
+		}
+		return getRelationalValue(name, value)
+	}
+}
+
+// addFields is a helper function that adds to the given symbol table the
+// computed fields with the given names, unless they are already defined. Fields
+// without arguments are added with their value, which is null if it can not be
+// computed, whereas fields with arguments are added as functions
+func (game *PgnGame) addFields(symtable map[string]pfparser.RelationalInterface, names []string) {
+
+	for _, name := range names {
+		if _, ok := symtable[name]; ok {
+			continue
+		}
+		registered, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if registered.arity > 0 {
+			symtable[name] = game.getFieldFunction(name)
+		} else if value, _, err := game.computeField(name); err != nil {
+			symtable[name] = pfparser.ConstNull{}
+		} else {
+			symtable[name] = getRelationalValue(name, value)
+		}
+	}
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
@@ -0,0 +1,239 @@
+package pgntools
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// a short collection of games with ratings, openings, elapsed move times and
+// different results
+var fieldsGames = `[Event "First"]
+[White "alice"]
+[Black "bob"]
+[WhiteElo "2100"]
+[BlackElo "2000"]
+[ECO "C50"]
+[Opening "Italian Game: Two Knights Defense"]
+[PlyCount "7"]
+[Result "1-0"]
+
+1. e4 {[%emt 1.5]} e5 {[%emt 2.0]} 2. Bc4 {[%emt 3.0]} Nc6 {[%emt 1.0]}
+3. Qh5 {[%emt 2.5]} Nf6 {[%emt 4.5]} 4. Qxf7# {[%emt 0.5]} 1-0
+
+[Event "Second"]
+[White "bob"]
+[Black "alice"]
+[WhiteElo "1900"]
+[BlackElo "2000"]
+[ECO "C44"]
+[PlyCount "4"]
+[Result "1/2-1/2"]
+
+1. e4 e5 2. Nf3 Nc6 1/2-1/2
+
+[Event "Third"]
+[White "carol"]
+[Black "dave"]
+[Opening "King's Pawn Game #2"]
+[PlyCount "4"]
+[Result "0-1"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+`
+
+// Test that the computed fields registered by default are correctly computed
+func TestFields(t *testing.T) {
+
+	var fieldsTable = []struct {
+		event  string
+		values map[string]string
+	}{
+		{"First", map[string]string{"Moves": "4", "Result": "1-0", "Variations": "0",
+			"EloDiff": "100", "OpeningFamily": "Italian Game", "Winner": "alice",
+			"Loser": "bob", "PlayerColor(alice)": "White", "PlayerColor('bob')": "Black",
+			"PlayerColor(carol)": "-", "Duration": "15", "Captures": "1", "Checks": "1",
+			"FinalFEN": "r1bqkb1r/pppp1Qpp/2n2n2/4p3/2B1P3/8/PPPP1PPP/RNB1K1NR b KQkq - 0 4"}},
+		{"Second", map[string]string{"Moves": "2", "Result": "½-½", "EloDiff": "-100",
+			"OpeningFamily": "Open Games", "Winner": "-", "Loser": "-",
+			"PlayerColor(alice)": "Black", "Captures": "0", "Checks": "0"}},
+		{"Third", map[string]string{"Result": "0-1", "OpeningFamily": "King's Pawn Game",
+			"Winner": "dave", "Loser": "carol", "Checks": "1",
+			"FinalFEN": "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3"}},
+	}
+
+	games, err := ReadGamesFromString(fieldsGames, 0, "", "", ReadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	for idx, tt := range fieldsTable {
+		game := games.GetGame(idx)
+		event, _ := game.getField("Event")
+		assert(t, event, tt.event)
+		for name, want := range tt.values {
+			value, err := game.getField(name)
+			if err != nil {
+				t.Errorf("unexpected error '%v' in field %v of game '%v'", err, name, tt.event)
+			}
+			assert(t, value, want)
+		}
+	}
+
+	// fields that can not be computed and fields with a wrong number of
+	// arguments are reported as errors
+	game := games.GetGame(2)
+	for _, name := range []string{"EloDiff", "Duration", "PlayerColor", "Winner(alice)"} {
+		if _, err := game.getField(name); err == nil {
+			t.Errorf("an error was expected in field %v of game 'Third'", name)
+		}
+	}
+}
+
+// Test that computed fields can be used in queries, with fields with arguments
+// used as functions
+func TestFieldsQuery(t *testing.T) {
+
+	var queryTable = []struct {
+		query  string
+		events string
+	}{
+		{"%EloDiff > 0", "First"},
+		{"%EloDiff < 0 or missing(%EloDiff)", "Second Third"},
+		{"%PlayerColor('alice') = 'White'", "First"},
+		{"%PlayerColor('alice') != '-'", "First Second"},
+		{"%Winner = 'dave' and %Checks = 1", "Third"},
+		{"%OpeningFamily = 'Open Games'", "Second"},
+		{"%Duration >= 15", "First"},
+		{"exists(%Duration)", "First"},
+		{"%Captures > 0", "First"},
+	}
+
+	for _, tt := range queryTable {
+		t.Run(tt.query, func(t *testing.T) {
+			reader := NewReader(strings.NewReader(fieldsGames))
+			if err := reader.SetQuery(tt.query); err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			var events []string
+			for {
+				game, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error '%v'", err)
+				}
+				event, _ := game.getField("Event")
+				events = append(events, event)
+			}
+			assert(t, strings.Join(events, " "), tt.events)
+		})
+	}
+}
+
+// Test that the arguments of computed fields are given to them as they are,
+// and that fields used with a wrong number of arguments are reported when the
+// query is set
+func TestFieldsArguments(t *testing.T) {
+
+	var pgn = `[Event "First"]
+[White "Carlsen, Magnus"]
+[Black "Nakamura, Hikaru"]
+[Result "1-0"]
+
+1. e4 e5 1-0
+`
+
+	reader := NewReader(strings.NewReader(pgn))
+	if err := reader.SetQuery("%PlayerColor('Carlsen, Magnus') = 'White'"); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	game, err := reader.Next()
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	color, err := game.getField("PlayerColor('Nakamura, Hikaru')")
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	assert(t, color, "Black")
+
+	var errorTable = []struct {
+		query string
+		msg   string
+	}{
+		{"%PlayerColor() = 'White'", "at column 1"},
+		{"%Moves > 20 and %PlayerColor('alice', 'bob') = 'White'", "at column 17"},
+		{"%PlayerColor = 'White'", "at column 1"},
+		{"%Winner('alice') = 'alice'", "at column 1"},
+	}
+	for _, tt := range errorTable {
+		err := NewReader(strings.NewReader(pgn)).SetQuery(tt.query)
+		if pgnerr, ok := err.(*PgnError); !ok || pgnerr.Kind != ErrQuery {
+			t.Fatalf("a query error was expected in '%v' but '%v' was found", tt.query, err)
+		}
+		if !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("the location of the error is not shown in '%v'", err)
+		}
+	}
+}
+
+// Test that computed fields can be used as sorting keys and in histograms
+func TestFieldsSortHistogram(t *testing.T) {
+
+	var sortTable = []struct {
+		query      string
+		sortString string
+		events     string
+	}{
+		{"exists(%EloDiff)", "> %EloDiff", "First Second"},
+		{"", "< %Checks < %Captures", "Second Third First"},
+		{"", "> %PlayerColor(bob)", "Second First Third"},
+	}
+
+	for _, tt := range sortTable {
+		t.Run(tt.sortString, func(t *testing.T) {
+			games, err := ReadGamesFromString(fieldsGames, 0, tt.query, tt.sortString, ReadOptions{Strict: true})
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			var events []string
+			for _, game := range games.GetGames() {
+				event, _ := game.getField("Event")
+				events = append(events, event)
+			}
+			assert(t, strings.Join(events, " "), tt.events)
+		})
+	}
+
+	games, err := ReadGamesFromString(fieldsGames, 0, "", "", ReadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	hist := games.ComputeHistogram("Winner: %Winner Color: %PlayerColor(alice)")
+	assert(t, hist.Lookup([]string{"alice", "White"}).String(), "1")
+	assert(t, hist.Lookup([]string{"-", "Black"}).String(), "1")
+	assert(t, hist.Lookup([]string{"dave", "-"}).String(), "1")
+}
+
+// Test that new fields can be registered
+func TestRegisterField(t *testing.T) {
+
+	RegisterField("Plies", 0, func(game *PgnGame, args []string) (interface{}, error) {
+		return len(game.GetMoves()), nil
+	})
+	defer delete(fields, "Plies")
+
+	games, err := ReadGamesFromString(fieldsGames, 0, "%Plies > 4", "< %Plies", ReadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	game := games.GetGame(0)
+	plies, err := game.getField("Plies")
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	assert(t, plies, "7")
+	assert(t, strings.Join(GetFieldNames(), " "), "Captures Checks Duration EloDiff FinalFEN Loser "+
+		"Moves OpeningFamily PlayerColor Plies Result Variations Winner")
+}
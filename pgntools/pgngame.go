@@ -19,10 +19,14 @@
 package pgntools
 
 import (
-	"errors"  // for signaling errors
-	"fmt"     // printing msgs
-	"log"     // logging services
-	"strconv" // to conver int to string
+	"errors" // for signaling errors
+	"fmt"    // printing msgs
+	"io"     // boards are written to io streams
+	"log"    // logging services
+	"os"     // standard output
+
+	// import the parser of propositional formulae
+	"github.com/clinaresl/pgnparser/pfparser"
 )
 
 // typedefs
@@ -45,15 +49,29 @@ type constString string
 // the elapsed move time was present in the PGN file, it is also stored
 // here.
 //
-// Finally, any combination of moves after the move are combined into the
-// same field (comments). In case various comments were given they are then
-// separated by '\n'.
+// Any combination of moves after the move are combined into the same field
+// (comments). In case various comments were given they are then separated by
+// '\n'.
+//
+// Moves can be also annotated with an arbitrary number of Numeric Annotation
+// Glyphs (NAG), including the traditional suffix annotations such as '!' or
+// '?!'. They are stored in the same order they were found.
+//
+// A move might have an arbitrary number of variations, i.e., alternative lines
+// that could have been played instead of it. Each variation is a sequence of
+// moves which might have its own variations as well.
+//
+// Finally, the offset of the move relative to the beginning of the game is
+// stored to locate errors
 type PgnMove struct {
-	number    int
-	color     int
-	moveValue string
-	emt       float32
-	comments  string
+	number     int
+	color      int
+	moveValue  string
+	emt        float32
+	comments   string
+	nags       []PgnNag
+	variations [][]PgnMove
+	offset     int
 }
 
 // The outcome of a chess game consists of the score obtained by every player as
@@ -64,11 +82,21 @@ type PgnOutcome struct {
 }
 
 // A game consists just of a map that stores information of all PGN tags, the
-// sequence of moves and finally the outcome.
+// sequence of moves and finally the outcome. Games also remember their location
+// in the input stream to report errors. Once a game is replayed, its final
+// status, the warnings raised and the values computed from its moves are stored
+// as well
 type PgnGame struct {
-	tags    map[string]dataInterface
-	moves   []PgnMove
-	outcome PgnOutcome
+	tags      map[string]dataInterface
+	moves     []PgnMove
+	outcome   PgnOutcome
+	location  pgnLocation
+	status    GameStatus
+	warnings  []PgnDiagnostic
+	computed  map[string]dataInterface
+	hashes    []uint64
+	positions []int
+	material  [][2]int
 }
 
 // Methods
@@ -185,6 +213,41 @@ func (move PgnMove) String() string {
 	return output
 }
 
+// Return the Numeric Annotation Glyphs of this move in the same order they were
+// given
+func (move PgnMove) GetNAGs() []PgnNag {
+	return move.nags
+}
+
+// getSuffix is a helper function that returns the traditional suffix
+// annotations of this move (such as '!' or '?!') in the same order they were
+// given, and the empty string if there are none
+func (move PgnMove) getSuffix() (suffix string) {
+	for _, nag := range move.nags {
+		if nag.IsSuffix() {
+			suffix += nags[nag].latex
+		}
+	}
+	return
+}
+
+// getSymbols is a helper function that returns a slice with the NAGs of this
+// move which are not traditional suffix annotations
+func (move PgnMove) getSymbols() (symbols []PgnNag) {
+	for _, nag := range move.nags {
+		if !nag.IsSuffix() {
+			symbols = append(symbols, nag)
+		}
+	}
+	return
+}
+
+// Return the variations of this move, i.e., alternative lines that could have
+// been played instead of it
+func (move PgnMove) GetVariations() [][]PgnMove {
+	return move.variations
+}
+
 // Produces a string with information of this outcome as a pair of
 // floating-point numbers
 func (outcome PgnOutcome) String() string {
@@ -207,21 +270,142 @@ func (game *PgnGame) GetOutcome() PgnOutcome {
 	return game.outcome
 }
 
+// getValue is a helper function that returns the value of the given variable,
+// which is either a tag of this game or a value computed when replaying it,
+// and whether it exists or not. Tags take precedence over computed values,
+// which take precedence over computed fields. Fields whose value can not be
+// computed are considered not to exist
+func (game *PgnGame) getValue(name string) (dataInterface, bool) {
+	if value, ok := game.tags[name]; ok {
+		return value, true
+	}
+	if value, ok := game.computed[name]; ok {
+		return value, true
+	}
+	value, _, err := game.computeField(name)
+	return value, value != nil && err == nil
+}
+
+// getRelationalValue is a helper function that returns the value of the given
+// tag, which might be a typed value, to be used in the symbol table of queries
+func getRelationalValue(tag string, content dataInterface) pfparser.RelationalInterface {
+
+	// first, verify whether this is an integer
+	value, ok := content.(constInteger)
+	if ok {
+		return pfparser.ConstInteger(value)
+	}
+
+	// if not, check if it is a string, which might be a typed value
+	text, ok := content.(constString)
+	if !ok {
+		log.Fatal(" Unknown type")
+	}
+	return getTypedValue(tag, string(text))
+}
+
+// getTypedValue is a helper function that returns the value of the given tag
+// in a symbol table. Dates, times and time controls are given as typed values
+// if they are correct, and all other tags are given as strings
+func getTypedValue(tag, value string) pfparser.RelationalInterface {
+
+	var typed pfparser.RelationalInterface
+	var err error
+	switch tag {
+	case "Date", "UTCDate", "EventDate":
+		typed, err = pfparser.ParseDate(value)
+	case "Time", "UTCTime":
+		typed, err = pfparser.ParseTime(value)
+	case "TimeControl":
+		typed, err = pfparser.ParseTimeControl(value)
+	default:
+		return pfparser.ConstString(value)
+	}
+	if err != nil {
+		return pfparser.ConstString(value)
+	}
+	return typed
+}
+
+// Return a symbol table with all the information appearing in the headers of
+// this game and the values computed when replaying it. It is used to evaluate
+// propositional formulae over games. Tags take precedence over computed values.
+// Additionally, the moves of the mainline are stored in the reserved variable
+// 'moves'. Computed fields are costly and hence only those with the given names
+// are added, unless they are shadowed by other values
+func (game *PgnGame) getSymtable(names ...string) map[string]pfparser.RelationalInterface {
+
+	symtable := make(map[string]pfparser.RelationalInterface)
+	for _, values := range []map[string]dataInterface{game.computed, game.tags} {
+		for key, content := range values {
+			symtable[key] = getRelationalValue(key, content)
+		}
+	}
+	game.addFunctions(symtable)
+	symtable["moves"] = game.getMoveSequence()
+
+	// finally, add the computed fields with the given names, if any
+	game.addFields(symtable, names)
+
+	return symtable
+}
+
 // Parse all moves of this game. Show the board between showboard consecutive
-// plies
-func (game *PgnGame) ParseMoves(plies int) {
+// plies. It returns a *PgnError, located in the input stream, in case any move
+// can not be reproduced on the board. Otherwise, the final status of the game
+// is computed, and moves with wrong check or checkmate suffixes and results
+// that contradict each other are recorded as warnings
+func (game *PgnGame) Replay(plies int) error {
+	return game.replay(plies, false, os.Stdout)
+}
+
+// Parse all moves of this game verifying that they are legal according to the
+// rules of chess. It returns a *PgnError, located in the input stream, with
+// the ply and the reason why the first illegal move is not legal
+func (game *PgnGame) Validate() error {
+	return game.replay(0, true, os.Stdout)
+}
+
+// replay is a helper function that parses all moves of this game showing the
+// board between showboard consecutive plies on the given writer. In strict
+// mode, all moves are verified to be legal
+func (game *PgnGame) replay(plies int, strict bool, w io.Writer) error {
 
 	nrplies := 0
 
-	board := InitPgnBoard()
+	board, _, _, err := game.getInitialPosition()
+	if err != nil {
+		return err
+	}
+	board.SetStrict(strict)
+	game.status, game.warnings = 0, nil
+	game.hashes = []uint64{board.hash}
+	draws := newDraws(&board)
+	features := newFeatures(&board)
 
 	for _, move := range game.moves {
-		board.UpdateBoard(move, plies > 0)
+		if plies > 0 {
+			fmt.Fprintf(w, " %v\n", move)
+		}
+		if err := board.Play(move, false); err != nil {
+			err.(*PgnError).Ply = 1 + nrplies
+			return game.location.locate(err.(*PgnError).at(move.offset))
+		}
+
+		// verify the check and checkmate suffixes, if any, and the draw
+		// rules
+		if warning := checkSuffix(&board, move); warning != nil {
+			warning.Ply = 1 + nrplies
+			game.warn(warning.at(move.offset))
+		}
+		draws.update(&board, 1+nrplies)
+		features.update(&board, move, 1+nrplies)
+		game.hashes = append(game.hashes, board.hash)
 
 		// show the board on the console?
 		nrplies += 1 // incremente the number of plies processed
 		if plies > 0 && nrplies%plies == 0 {
-			fmt.Printf("%v\n\n", board)
+			fmt.Fprintf(w, "%v\n\n", board)
 		}
 	}
 
@@ -229,7 +413,114 @@ func (game *PgnGame) ParseMoves(plies int) {
 	// incidentally shown within the previous loops
 	if plies > 0 && nrplies%plies != 0 {
 
-		fmt.Printf("%v\n\n", board)
+		fmt.Fprintf(w, "%v\n\n", board)
+	}
+
+	// compute the final status of the game and verify its result
+	game.status = game.getStatus(board)
+	for _, warning := range game.checkResult(board) {
+		game.warn(warning)
+	}
+
+	// and store all values computed from the moves of this game
+	game.computed = map[string]dataInterface{
+		"Status":               constString(game.status.String()),
+		"ThreefoldRepetition":  constInteger(draws.threefold),
+		"FivefoldRepetition":   constInteger(draws.fivefold),
+		"FiftyMoveRule":        constInteger(draws.fiftymoves),
+		"SeventyFiveMoveRule":  constInteger(draws.seventyfive),
+		"InsufficientMaterial": constInteger(draws.insufficient),
+		"OppositeBishops":      constInteger(features.oppositeBishops),
+		"QueensTraded":         constInteger(features.queensTraded),
+		"Promotion":            constInteger(features.promotion),
+		"WhiteCastling":        constString(features.castling[0]),
+		"BlackCastling":        constString(features.castling[1]),
+	}
+	game.material = features.material
+
+	return nil
+}
+
+// warn is a helper function that records the given warning located in the
+// input stream
+func (game *PgnGame) warn(warning *PgnError) {
+	game.warnings = append(game.warnings, newDiagnostic(game.location.locate(warning), Warning))
+}
+
+// getInitialPosition is a helper function that returns the board where this
+// game starts along with the number and color of the last move played before
+// it. Unless the tag SetUp is "0", the position is taken from the tag FEN if it
+// is given; otherwise, the game starts from the initial position. It returns a
+// *PgnError if the FEN string is not correct
+func (game *PgnGame) getInitialPosition() (board PgnBoard, moveNumber, color int, err error) {
+
+	fen, ok := game.tags["FEN"]
+	if setup, found := game.tags["SetUp"]; !ok || (found && fmt.Sprintf("%v", setup) == "0") {
+		return InitPgnBoard(), 0, -1, nil
+	}
+
+	// the move played before the initial position is white's move in the
+	// same move number if black is to move, or black's move in the
+	// previous move number otherwise
+	board, err = NewPgnBoardFromFen(fmt.Sprintf("%v", fen))
+	if err != nil {
+		return board, 0, 0, game.location.locate(err.(*PgnError))
+	}
+	if board.turn == -1 {
+		return board, board.fullmove, 1, nil
+	}
+	return board, board.fullmove - 1, -1, nil
+}
+
+// Return the board of this game after the given number of plies of its
+// mainline, so that 0 returns the initial position. It returns a *PgnError if
+// the number of plies is out of range or any move can not be played
+func (game *PgnGame) GetBoardAt(ply int) (board PgnBoard, err error) {
+
+	if ply < 0 || ply > len(game.moves) {
+		return board, game.location.locate(newError(ErrMove, "", "ply %v out of range [0, %v]", ply, len(game.moves)))
+	}
+	if board, _, _, err = game.getInitialPosition(); err != nil {
+		return
+	}
+	for idx, move := range game.moves[:ply] {
+		if err = board.Play(move, false); err != nil {
+			err.(*PgnError).Ply = 1 + idx
+			return board, game.location.locate(err.(*PgnError).at(move.offset))
+		}
+	}
+	return board, nil
+}
+
+// Return the position of this game after the given number of plies of its
+// mainline in FEN notation. It is intended to be used in templates
+func (game *PgnGame) GetFenAt(ply int) (string, error) {
+
+	board, err := game.GetBoardAt(ply)
+	if err != nil {
+		return "", err
+	}
+	return board.GetFen(), nil
+}
+
+// truncate is a helper function that removes all moves of the mainline of this
+// game after the given number of plies. The ply count is updated accordingly
+// if it is given in the tags
+func (game *PgnGame) truncate(plies int) {
+	if plies < len(game.moves) {
+		game.moves = game.moves[:plies]
+	}
+	if _, ok := game.tags["PlyCount"]; ok {
+		game.tags["PlyCount"] = constInteger(len(game.moves))
+	}
+}
+
+// Parse all moves of this game. Show the board between showboard consecutive
+// plies. It behaves like Replay but any error is fatal
+func (game *PgnGame) ParseMoves(plies int) {
+
+	if err := game.Replay(plies); err != nil {
+		log.Fatal(err)
 	}
 }
 
@@ -292,22 +583,36 @@ func (game *PgnGame) GetLaTeXMoves() (output string) {
 //
 // 2. %show which generates a LaTeX command for showing the current board
 //
+// Numeric Annotation Glyphs are shown as symbols of the LaTeX packages
+// skak/xskak, and variations are shown between parenthesis immediately after
+// the move they are an alternative to.
+//
 // It is intended to be used in LaTeX templates
 func (game *PgnGame) GetLaTeXMovesWithComments() (output string) {
 
+	// the mainline is shown with the LaTeX command \mainline so that the
+	// board is updated with these moves
+	return getLaTeXLine(game.moves, `\mainline`)
+}
+
+// getLaTeXLine is a helper function that returns a LaTeX string with the given
+// list of moves along with their annotations and variations. Moves are written
+// with the given LaTeX command, either \mainline or \variation.
+func getLaTeXLine(moves []PgnMove, command string) (output string) {
+
 	// the variable newMainLine is used to determine whether the next move
-	// should start with a LaTeX command \mainline. Obviously, this is
+	// should start with the given LaTeX command. Obviously, this is
 	// initially true
 	newMainLine := true
 
 	// Iterate over all moves
-	for _, move := range game.moves {
+	for _, move := range moves {
 
 		// before printing this move, check if a new mainline has to be
 		// started (e.g., because the previous move ended with a
 		// comment
 		if newMainLine {
-			output += `\mainline{ `
+			output += command + `{ `
 		}
 
 		// now in case either we are starting a new mainline or it is
@@ -316,18 +621,25 @@ func (game *PgnGame) GetLaTeXMovesWithComments() (output string) {
 		if newMainLine || move.color == 1 {
 
 			// now, show the actual move with all details
-			output += fmt.Sprintf("%v%v %v ", move.number, move.getColorPrefix(), move.moveValue)
+			output += fmt.Sprintf("%v%v %v%v ", move.number, move.getColorPrefix(), move.moveValue, move.getSuffix())
 		} else {
 
 			// otherwise, just show the actual move
-			output += fmt.Sprintf("%v ", move.moveValue)
+			output += fmt.Sprintf("%v%v ", move.moveValue, move.getSuffix())
 		}
 
-		// if this move contains either a comment or the emt
-		if move.emt != -1 || move.comments != "" {
+		// if this move contains either a comment, the emt, NAGs other
+		// than suffix annotations or variations
+		symbols := move.getSymbols()
+		if move.emt != -1 || move.comments != "" || len(symbols) > 0 || len(move.variations) > 0 {
 
 			output += "} "
 
+			// show first all NAGs as skak symbols
+			for _, nag := range symbols {
+				output += fmt.Sprintf("%v ", nag.LaTeX())
+			}
+
 			// now, in case emt is present, show it
 			if move.emt != -1 {
 				output += fmt.Sprintf(`({\it %v}) `, move.emt)
@@ -338,22 +650,79 @@ func (game *PgnGame) GetLaTeXMovesWithComments() (output string) {
 
 				output += fmt.Sprintf("%v ", move.comments)
 			}
+
+			// and finally show all variations between parenthesis
+			for _, variation := range move.variations {
+				output += fmt.Sprintf("(%v) ", getLaTeXLine(variation, `\variation`))
+			}
 		}
 
 		// and check whether a new mainline has to be started in the
 		// next iteration
-		newMainLine = (move.emt != -1 || move.comments != "")
+		newMainLine = (move.emt != -1 || move.comments != "" || len(symbols) > 0 || len(move.variations) > 0)
+	}
+
+	// in case the last move did not close the line, do it now
+	if !newMainLine {
+		output += "}"
 	}
 
 	// and return the string computed so far
 	return
 }
 
-// Return the value of a specific tag and nil if it exists or any value and err
-// in case it does not exist. It is intended to be used in LaTeX templates
+// Produces a plain text string with the list of moves of this game including
+// all variations which are shown between parenthesis. Numeric Annotation
+// Glyphs are shown as Unicode glyphs whereas comments and emt annotations are
+// not shown. It is intended to be used in text templates
+func (game *PgnGame) GetTextMoves() string {
+	return getTextLine(game.moves)
+}
+
+// getTextLine is a helper function that returns a plain text string with the
+// given list of moves and all their variations
+func getTextLine(moves []PgnMove) (output string) {
+
+	// the move counter and the color prefix are shown for the first move,
+	// for all white moves and also for black moves immediately after a
+	// variation
+	showPrefix := true
+	for idx, move := range moves {
+
+		if idx > 0 {
+			output += " "
+		}
+		if showPrefix || move.color == 1 {
+			output += fmt.Sprintf("%v%v ", move.number, move.getColorPrefix())
+		}
+		output += move.moveValue
+
+		// show all NAGs as Unicode glyphs. Suffix annotations are
+		// written immediately after the move
+		for _, nag := range move.nags {
+			if nag.IsSuffix() {
+				output += nag.String()
+			} else {
+				output += fmt.Sprintf(" %v", nag)
+			}
+		}
+
+		// show all variations of this move between parenthesis
+		for _, variation := range move.variations {
+			output += fmt.Sprintf(" (%v)", getTextLine(variation))
+		}
+		showPrefix = len(move.variations) > 0
+	}
+
+	return
+}
+
+// Return the value of a specific tag (or a value computed when replaying the
+// game) and nil if it exists or any value and err in case it does not
+// exist. It is intended to be used in LaTeX templates
 func (game *PgnGame) GetTagValue(name string) (value dataInterface, err error) {
 
-	if value, ok := game.tags[name]; ok {
+	if value, ok := game.getValue(name); ok {
 		return value, nil
 	}
 
@@ -362,85 +731,92 @@ func (game *PgnGame) GetTagValue(name string) (value dataInterface, err error) {
 }
 
 // getAndCheckTag is a helper function whose purpose is just to retrieve the
-// value of a given tag. In case an error happened (most likely because it does
-// not exist) then a fatal error is issued and execution is stopped
-func (game *PgnGame) getAndCheckTag(tagname string) dataInterface {
+// value of a given tag. In case it does not exist, a *PgnError is returned
+func (game *PgnGame) getAndCheckTag(tagname string) (dataInterface, error) {
 
 	value, err := game.GetTagValue(tagname)
 
-	// in an error was found, then issue a fatal error
+	// in an error was found, then return it along with the index of this
+	// game
 	if err != nil {
-		log.Fatalf(fmt.Sprintf("'%v' not found in game\n '%v'!", tagname, game))
+		return nil, game.location.locate(newError(ErrTag, tagname, "tag not found"))
 	}
 
 	// otherwise, return the value of this tagname
-	return value
+	return value, nil
 }
 
-// A field is either a tag of the receiver game or a value computed from the
-// tags. Fields which are computed from tags are:
+// A field is either a computed field (see RegisterField), a tag of the receiver
+// game or a value computed when replaying it (see Replay). Computed fields take
+// precedence over tags so that, e.g., Result is shown with a utf-8 string. The
+// computed fields registered by default are:
 //
 //    Moves: number of moves (two plies each)
 //    Result: consists of a utf-8 string which contains the final result of the
 //    game
+//    Variations: number of variations found in the game, including those
+//    nested within other variations
+//    EloDiff: difference between the ratings of white and black
+//    OpeningFamily: name of the opening without variations, or the volume of
+//    its ECO code if the tag Opening is not given
+//    Winner, Loser: name of the player who won/lost the game, or '-' if it
+//    was drawn
+//    PlayerColor(name): color played by the given player, either 'White' or
+//    'Black', or '-' if the player did not play the game
+//    Duration: duration of the game in seconds computed as the sum of the
+//    elapsed move times
+//    FinalFEN: FEN string of the final position
+//    Captures: number of captures in the mainline
+//    Checks: number of checks in the mainline, including checkmates
 //
-// This method is used to compute arbitrary fields to be shown in ascii tables
-func (game *PgnGame) getField(field string) string {
-
-	// -- Moves
-	if field == "Moves" {
-
-		// get the ply count of this game
-		plyCount := game.getAndCheckTag("PlyCount")
-
-		// now, compute the number of moves from the number of plies. If
-		// the number of plies is even, then the number of moves is half
-		// the number of plies, otherwise, add 1
-		moves, ok := plyCount.(constInteger)
-		if !ok {
-			log.Fatalf(fmt.Sprintf(" It was not possible to convert the PlyCount ('%v') into an integer", plyCount))
-		}
-		if 2*(moves/2) < moves {
-			moves = moves/2 + 1
-		} else {
-			moves /= 2
+// This method is used to compute arbitrary fields to be shown in ascii
+// tables. It returns a *PgnError if the field can not be computed
+func (game *PgnGame) getField(field string) (string, error) {
+
+	// -- computed fields
+	if value, found, err := game.computeField(field); found {
+		if err != nil {
+			return "", err
 		}
-
-		// and return the number of moves
-		return strconv.Itoa(int(moves))
+		return fmt.Sprintf("%v", value), nil
 	}
 
-	// -- Moves
-	if field == "Result" {
+	// -- tags
 
-		var scoreWhite, scoreBlack string
-		if game.outcome.scoreWhite == 0.5 {
-			scoreWhite, scoreBlack = "½", "½"
-		} else if game.outcome.scoreWhite == 1 {
-			scoreWhite, scoreBlack = "1", "0"
-		} else {
-			scoreWhite, scoreBlack = "0", "1"
-		}
-		return scoreWhite + "-" + scoreBlack
+	// after trying computed fields, then tags defined in this game are
+	// tried. In case they do not exist, an error is automatically raised
+	value, err := game.getAndCheckTag(field)
+	if err != nil {
+		return "", err
 	}
+	return fmt.Sprintf("%v", value), nil
+}
 
-	// -- tags
-
-	// after trying special fields, then tags defined in this game are
-	// tried. In case they do not exist, an error is automatically raisedx
-	return fmt.Sprintf("%v", game.getAndCheckTag(field))
+// countVariations is a helper function that returns the number of variations
+// found in the given list of moves, including those nested within others
+func countVariations(moves []PgnMove) (result int) {
+	for _, move := range moves {
+		for _, variation := range move.variations {
+			result += 1 + countVariations(variation)
+		}
+	}
+	return
 }
 
 // Return a slice of strings with the values of all given fields. This method is
 // used to compute the fields of a game to be shown on an ascii table
-func (game *PgnGame) getFields(fields []string) (result []string) {
+func (game *PgnGame) getFields(fields []string) (result []string, err error) {
 
 	// iterate over all fields
 	for _, field := range fields {
 
 		// compute the value of the next field and add it to the slice
 		// to return
-		result = append(result, game.getField(field))
+		value, err := game.getField(field)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
 	}
 
 	// return the slice of strings computed so far
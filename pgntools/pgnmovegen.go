@@ -0,0 +1,281 @@
+/*
+  pgnmovegen.go
+  Description: Generation of legal moves, perft and detection of mates
+*/
+
+package pgntools
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// A boardMove represents a move on a PgnBoard with the square where the piece
+// is located, the square it is moved to and the piece a pawn is promoted to
+// (which is null if there is no promotion). Castling is represented as a move
+// of the king two squares towards the rook
+type boardMove struct {
+	origin, target, promotion int
+}
+
+// globals
+// ----------------------------------------------------------------------------
+
+// pawns can be promoted to any of the following pieces, which are represented
+// as white pieces
+var promotions = []int{WQUEEN, WROOK, WBISHOP, WKNIGHT}
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// return the letter used in SAN to represent the given piece regardless of its
+// color. Pawns are represented with an empty string
+func getPieceLetter(piece int) string {
+	if piece < 0 {
+		piece = -piece
+	}
+	return []string{"", "", "N", "B", "R", "Q", "K"}[piece]
+}
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// getPawnMoves is a helper function that appends to the given slice all moves
+// of the pawn of the given color located in origin: one or two squares forward
+// if they are empty, captures and captures en passant. Moves that reach the
+// last row are appended once for every piece the pawn can be promoted to
+func (board *PgnBoard) getPawnMoves(moves []boardMove, origin int, color int) []boardMove {
+
+	// add the given move taking promotions into account
+	add := func(target int) {
+		if target/8 == 0 || target/8 == 7 {
+			for _, piece := range promotions {
+				moves = append(moves, boardMove{origin, target, piece * color})
+			}
+		} else {
+			moves = append(moves, boardMove{origin, target, BLANK})
+		}
+	}
+
+	// -- ordinary moves, two squares forward only from the original row
+	forward := origin + 8*color
+	if forward < 0 || forward > 63 {
+		return moves
+	}
+	if board.squares[forward] == BLANK {
+		add(forward)
+		if (color > 0 && origin/8 == 1) || (color < 0 && origin/8 == 6) {
+			if board.squares[forward+8*color] == BLANK {
+				add(forward + 8*color)
+			}
+		}
+	}
+
+	// -- captures, including en passant
+	for _, target := range []int{forward - 1, forward + 1} {
+		if target < 0 || target > 63 || target/8 != forward/8 {
+			continue
+		}
+		if (board.squares[target] != BLANK && getColor(board.squares[target]) != color) ||
+			target == board.enpassant {
+			add(target)
+		}
+	}
+
+	return moves
+}
+
+// getPseudoLegalMoves is a helper function that returns all moves of the side
+// to move in this board regardless of whether they leave the king in check
+// or not. The destinations of all pieces but pawns are computed with the
+// threats to their own location, since they move symmetrically. Castling is
+// returned only if it is legal
+func (board *PgnBoard) getPseudoLegalMoves() (moves []boardMove) {
+
+	color := board.turn
+	for origin, piece := range board.squares {
+		if piece == BLANK || getColor(piece) != color {
+			continue
+		}
+
+		switch piece * color {
+		case WPAWN:
+			moves = board.getPawnMoves(moves, origin, color)
+
+		case WKNIGHT:
+			for _, target := range threats[literal[origin]][WKNIGHT][0] {
+				if board.squares[target] == BLANK || getColor(board.squares[target]) != color {
+					moves = append(moves, boardMove{origin, target, BLANK})
+				}
+			}
+
+		default:
+
+			// bishops, rooks, queens and kings move in every
+			// direction until they find another piece, which can
+			// be captured if it belongs to the opponent
+			for _, direction := range threats[literal[origin]][piece*color] {
+				for _, target := range direction {
+					if board.squares[target] == BLANK {
+						moves = append(moves, boardMove{origin, target, BLANK})
+						continue
+					}
+					if getColor(board.squares[target]) != color {
+						moves = append(moves, boardMove{origin, target, BLANK})
+					}
+					break
+				}
+			}
+		}
+	}
+
+	// -- castling
+	king := board.wking
+	if color < 0 {
+		king = board.bking
+	}
+	if board.checkCastling(color, true) == nil {
+		moves = append(moves, boardMove{king, king + 2, BLANK})
+	}
+	if board.checkCastling(color, false) == nil {
+		moves = append(moves, boardMove{king, king - 2, BLANK})
+	}
+
+	return
+}
+
+// getLegalMoves is a helper function that returns all legal moves of the side
+// to move in this board, i.e., those that do not leave its king in check
+func (board *PgnBoard) getLegalMoves() (moves []boardMove) {
+
+	for _, move := range board.getPseudoLegalMoves() {
+		next := *board
+		next.makeMove(move.origin, move.target, move.promotion)
+		if !next.isChecked(board.turn) {
+			moves = append(moves, move)
+		}
+	}
+	return
+}
+
+// getSAN is a helper function that returns the given legal move in Standard
+// Algebraic Notation. The other legal moves of this board are given to
+// disambiguate it. Moves that check the opponent are suffixed with '+' or '#'
+// if they are checkmate
+func (board *PgnBoard) getSAN(move boardMove, moves []boardMove) (san string) {
+
+	piece := board.squares[move.origin]
+	color := getColor(piece)
+	row, column := getQualifier(move.origin)
+
+	switch {
+	case piece == WKING*color && move.target-move.origin == 2:
+		san = "O-O"
+	case piece == WKING*color && move.origin-move.target == 2:
+		san = "O-O-O"
+	case piece == WPAWN*color:
+
+		// pawns are qualified with their column when capturing
+		if move.origin%8 != move.target%8 {
+			san = column + "x"
+		}
+		san += literal[move.target]
+		if move.promotion != BLANK {
+			san += "=" + getPieceLetter(move.promotion)
+		}
+	default:
+
+		// other pieces are qualified only if there are other pieces
+		// of the same kind that can reach the same target. The column
+		// is preferred over the row, and both are given if necessary
+		ambiguous, samecolumn, samerow := false, false, false
+		for _, other := range moves {
+			if other.target != move.target || other.origin == move.origin ||
+				board.squares[other.origin] != piece {
+				continue
+			}
+			otherrow, othercolumn := getQualifier(other.origin)
+			ambiguous = true
+			samecolumn = samecolumn || othercolumn == column
+			samerow = samerow || otherrow == row
+		}
+
+		san = getPieceLetter(piece)
+		switch {
+		case ambiguous && !samecolumn:
+			san += column
+		case ambiguous && !samerow:
+			san += row
+		case ambiguous:
+			san += column + row
+		}
+		if board.squares[move.target] != BLANK {
+			san += "x"
+		}
+		san += literal[move.target]
+	}
+
+	// finally, check whether the opponent is checked or checkmated
+	next := *board
+	next.makeMove(move.origin, move.target, move.promotion)
+	if next.isChecked(-color) {
+		if len(next.getLegalMoves()) == 0 {
+			return san + "#"
+		}
+		return san + "+"
+	}
+	return
+}
+
+// Return all legal moves of the side to move in this board in Standard
+// Algebraic Notation, including castling, captures en passant and promotions
+func (board *PgnBoard) GetLegalMoves() (sans []string) {
+
+	moves := board.getLegalMoves()
+	for _, move := range moves {
+		sans = append(sans, board.getSAN(move, moves))
+	}
+	return
+}
+
+// Return true if the king of the side to move is in check
+func (board *PgnBoard) IsCheck() bool {
+	return board.isChecked(board.turn)
+}
+
+// Return true if the side to move is checkmated, i.e., if its king is in check
+// and there are no legal moves
+func (board *PgnBoard) IsCheckmate() bool {
+	return board.IsCheck() && len(board.getLegalMoves()) == 0
+}
+
+// Return true if the side to move is stalemated, i.e., if its king is not in
+// check and there are no legal moves
+func (board *PgnBoard) IsStalemate() bool {
+	return !board.IsCheck() && len(board.getLegalMoves()) == 0
+}
+
+// Return the number of leaf nodes of the tree of legal moves of the given
+// depth rooted at this board. This is known as perft, and it is used to verify
+// the generation of moves
+func (board *PgnBoard) Perft(depth int) (nodes int64) {
+
+	if depth == 0 {
+		return 1
+	}
+
+	// at the last level it suffices to count the legal moves
+	moves := board.getLegalMoves()
+	if depth == 1 {
+		return int64(len(moves))
+	}
+	for _, move := range moves {
+		next := *board
+		next.makeMove(move.origin, move.target, move.promotion)
+		nodes += next.Perft(depth - 1)
+	}
+	return
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
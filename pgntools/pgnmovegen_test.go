@@ -0,0 +1,126 @@
+package pgntools
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Test the generation of moves against the standard perft positions
+func TestPerft(t *testing.T) {
+
+	var perftTable = []struct {
+		fen   string
+		nodes []int64
+	}{
+		// initial position
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			[]int64{20, 400, 8902, 197281}},
+
+		// "Kiwipete"
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+			[]int64{48, 2039, 97862}},
+
+		// position 3
+		{"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+			[]int64{14, 191, 2812, 43238}},
+
+		// position 4
+		{"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+			[]int64{6, 264, 9467}},
+
+		// position 5
+		{"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+			[]int64{44, 1486, 62379}},
+
+		// position 6
+		{"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+			[]int64{46, 2079, 89890}},
+	}
+
+	for _, tt := range perftTable {
+		t.Run(tt.fen, func(t *testing.T) {
+			board, err := NewPgnBoardFromFen(tt.fen)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			for depth, nodes := range tt.nodes {
+				if got := board.Perft(1 + depth); got != nodes {
+					t.Fatalf("got %v nodes at depth %v want %v", got, 1+depth, nodes)
+				}
+			}
+		})
+	}
+}
+
+// Test that legal moves are given in SAN and that all of them can be played in
+// strict mode
+func TestGetLegalMoves(t *testing.T) {
+
+	var movesTable = []struct {
+		fen  string
+		want string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			"Na3 Nc3 Nf3 Nh3 a3 a4 b3 b4 c3 c4 d3 d4 e3 e4 f3 f4 g3 g4 h3 h4"},
+		{"4k3/8/8/8/8/8/8/1N1K1N2 w - - 0 1",
+			"Kc1 Kc2 Kd2 Ke1 Ke2 Na3 Nbd2 Nc3 Ne3 Nfd2 Ng3 Nh2"},
+		{"k7/8/1K6/8/8/8/8/2R5 w - - 0 1",
+			"Ka5 Ka6 Kb5 Kc5 Kc6 Kc7 Ra1+ Rb1 Rc2 Rc3 Rc4 Rc5 Rc6 Rc7 Rc8# Rd1 Re1 Rf1 Rg1 Rh1"},
+		{"4k3/8/8/8/8/8/p6p/4K3 b - - 0 1",
+			"Kd7 Kd8 Ke7 Kf7 Kf8 a1=B a1=N a1=Q+ a1=R+ h1=B h1=N h1=Q+ h1=R+"},
+		{"4k3/1P6/8/3pP3/8/8/8/R3K2R w KQ d6 0 1",
+			"Kd1 Kd2 Ke2 Kf1 Kf2 O-O O-O-O Ra2 Ra3 Ra4 Ra5 Ra6 Ra7 Ra8+ Rb1 Rc1 Rd1 Rf1 Rg1 " +
+				"Rh2 Rh3 Rh4 Rh5 Rh6 Rh7 Rh8+ b8=B b8=N b8=Q+ b8=R+ e6 exd6"},
+		{"4k3/8/8/8/8/8/p7/4K3 b - - 0 1",
+			"Kd7 Kd8 Ke7 Kf7 Kf8 a1=B a1=N a1=Q+ a1=R+"},
+	}
+
+	for _, tt := range movesTable {
+		t.Run(tt.fen, func(t *testing.T) {
+			board, err := NewPgnBoardFromFen(tt.fen)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			moves := board.GetLegalMoves()
+			sort.Strings(moves)
+			assert(t, strings.Join(moves, " "), tt.want)
+
+			for _, move := range moves {
+				next := board
+				next.SetStrict(true)
+				if err := next.Play(PgnMove{number: 1, color: board.turn, moveValue: move, emt: -1}, false); err != nil {
+					t.Errorf("unexpected error '%v'", err)
+				}
+			}
+		})
+	}
+}
+
+// Test the detection of checks, checkmates and stalemates
+func TestMates(t *testing.T) {
+
+	var matesTable = []struct {
+		fen                         string
+		check, checkmate, stalemate bool
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", false, false, false},
+		{"rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", true, true, false},
+		{"4k3/8/8/8/8/8/4q3/4K3 w - - 0 1", true, false, false},
+		{"k7/8/1Q6/8/8/8/8/4K3 b - - 0 1", false, false, true},
+	}
+
+	for _, tt := range matesTable {
+		t.Run(tt.fen, func(t *testing.T) {
+			board, err := NewPgnBoardFromFen(tt.fen)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			if board.IsCheck() != tt.check || board.IsCheckmate() != tt.checkmate ||
+				board.IsStalemate() != tt.stalemate {
+				t.Fatalf("got check %v, checkmate %v and stalemate %v", board.IsCheck(),
+					board.IsCheckmate(), board.IsStalemate())
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+  pgnmoves.go
+  Description: Sequences of moves that can be matched in queries
+*/
+
+package pgntools
+
+import (
+	"log"     // logging services
+	"regexp"  // move numbers are removed with a regexp
+	"strings" // string manipulation
+
+	// import the parser of propositional formulae
+	"github.com/clinaresl/pgnparser/pfparser"
+)
+
+// globals
+// ----------------------------------------------------------------------------
+
+// move numbers, either followed by one dot (white) or three dots (black)
+var reMoveNumber = regexp.MustCompile(`^[0-9]+\.+`)
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// The mainline of a game is matched in queries as a sequence of moves in SAN,
+// i.e., without move numbers, comments or annotations
+type moveSequence []string
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// normalizeMove is a helper function that returns the given move in SAN
+// without its move number and annotations. Castling is always written with
+// capital letters separated by dashes. Results and move numbers on their own
+// are returned as the empty string
+func normalizeMove(move string) string {
+
+	switch move {
+	case "1-0", "0-1", "1/2-1/2", "*":
+		return ""
+	}
+	move = strings.TrimRight(reMoveNumber.ReplaceAllString(move, ""), "!?")
+
+	// castling can be written also with zeros and/or without dashes
+	if strings.HasPrefix(move, "O") || strings.HasPrefix(move, "0") {
+		suffix := strings.TrimLeft(move, "O0-")
+		switch strings.Count(move, "O") + strings.Count(move, "0") {
+		case 2:
+			move = "O-O" + suffix
+		case 3:
+			move = "O-O-O" + suffix
+		}
+	}
+	return move
+}
+
+// getMoveSequence is a helper function that returns the sequence of moves in
+// SAN given in the specified text, where move numbers, annotations and results
+// are ignored
+func getMoveSequence(text string) (sequence moveSequence) {
+
+	for _, move := range strings.Fields(text) {
+		if move = normalizeMove(move); move != "" {
+			sequence = append(sequence, move)
+		}
+	}
+	return
+}
+
+// sameMove is a helper function that returns true if the given move matches the
+// move in the given pattern. Checks and checkmates are ignored unless the
+// pattern gives them explicitly
+func sameMove(move, pattern string) bool {
+
+	if strings.HasSuffix(pattern, "+") || strings.HasSuffix(pattern, "#") {
+		return move == pattern
+	}
+	return strings.TrimRight(move, "+#") == pattern
+}
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// getMoveSequence returns the sequence of moves in the mainline of this game
+func (game *PgnGame) getMoveSequence() (sequence moveSequence) {
+
+	sequence = make(moveSequence, 0, len(game.moves))
+	for _, move := range game.moves {
+		sequence = append(sequence, normalizeMove(move.moveValue))
+	}
+	return
+}
+
+// matchAt is a helper function that returns true if the given pattern matches
+// this sequence starting at the given index
+func (sequence moveSequence) matchAt(pattern moveSequence, index int) bool {
+
+	if index+len(pattern) > len(sequence) {
+		return false
+	}
+	for idx, move := range pattern {
+		if !sameMove(sequence[index+idx], move) {
+			return false
+		}
+	}
+	return true
+}
+
+// getPattern is a helper function that returns the sequence of moves given in
+// the operand of a relational operator which has to be a string constant
+func getPattern(right pfparser.RelationalInterface, operator string) moveSequence {
+
+	value, ok := right.(pfparser.ConstString)
+	if !ok {
+		log.Fatalf(" The relational operator %v can only be used with moves and string constants", operator)
+	}
+	return getMoveSequence(string(value))
+}
+
+// Sequences of moves can not be compared. Less, Equal and In are included here
+// just to satisfy the relational interface
+func (sequence moveSequence) Less(right pfparser.RelationalInterface) pfparser.TypeBool {
+
+	log.Fatal(" Moves can only be used with the relational operators starts_with and contains")
+	return false
+}
+
+// Sequences of moves can not be compared, see Less
+func (sequence moveSequence) Equal(right pfparser.RelationalInterface) pfparser.TypeBool {
+
+	log.Fatal(" Moves can only be used with the relational operators starts_with and contains")
+	return false
+}
+
+// Sequences of moves can not be compared, see Less
+func (sequence moveSequence) In(right pfparser.RelationalInterface) pfparser.TypeBool {
+
+	log.Fatal(" Moves can only be used with the relational operators starts_with and contains")
+	return false
+}
+
+// Return whether this sequence of moves starts with the moves given in right
+func (sequence moveSequence) StartsWith(right pfparser.RelationalInterface) pfparser.TypeBool {
+	return pfparser.TypeBool(sequence.matchAt(getPattern(right, "starts_with"), 0))
+}
+
+// Return whether the moves given in right are played consecutively anywhere in
+// this sequence of moves
+func (sequence moveSequence) Contains(right pfparser.RelationalInterface) pfparser.TypeBool {
+
+	pattern := getPattern(right, "contains")
+	for index := 0; index+len(pattern) <= len(sequence); index++ {
+		if sequence.matchAt(pattern, index) {
+			return true
+		}
+	}
+	return false
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
@@ -0,0 +1,94 @@
+package pgntools
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// a short collection of games with different openings and tactical patterns
+var movesGames = `[Event "First"]
+
+1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4 Nf6 5. Nc3 a6 *
+
+[Event "Second"]
+
+1. e4 c5 2. Nc3 Nc6 3. f4 g6 4. Nf3 Bg7 *
+
+[Event "Third"]
+
+1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6?? 4. Qxf7# 1-0
+
+[Event "Fourth"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5 4. O-O Nf6 5. d3 O-O *
+`
+
+// Test the normalization of moves given in SAN
+func TestNormalizeMove(t *testing.T) {
+
+	var moveTable = []struct {
+		move string
+		want string
+	}{
+		{"e4", "e4"},
+		{"1.", ""},
+		{"12...", ""},
+		{"1.e4", "e4"},
+		{"3...Nf6??", "Nf6"},
+		{"Qxf7#", "Qxf7#"},
+		{"0-0", "O-O"},
+		{"OOO+", "O-O-O+"},
+		{"1/2-1/2", ""},
+		{"0-1", ""},
+	}
+
+	for _, tt := range moveTable {
+		assert(t, normalizeMove(tt.move), tt.want)
+	}
+}
+
+// Test that the moves of the mainline can be matched in queries
+func TestMovesQuery(t *testing.T) {
+
+	var queryTable = []struct {
+		query  string
+		events string
+	}{
+		{"moves starts_with '1. e4 c5 2. Nf3 d6'", "First"},
+		{"moves starts_with '1.e4 c5'", "First Second"},
+		{"moves starts_with '1. e4'", "First Second Third Fourth"},
+		{"moves starts_with 'd4'", ""},
+		{"moves contains 'Qxf7'", "Third"},
+		{"moves contains 'Qxf7+'", ""},
+		{"moves contains '3... Nf6 4. Qxf7#'", "Third"},
+		{"moves contains 'O-O'", "Fourth"},
+		{"moves contains '4. O-O Nf6 5. d3 0-0'", "Fourth"},
+		{"moves contains 'Bc4 Nf6'", ""},
+		{"moves starts_with '1. e4 e5' and %Event != 'Third'", "Fourth"},
+		{"(moves contains 'Nxd4' or moves contains 'f4') and moves starts_with 'e4'", "First Second"},
+		{"%Event starts_with 'Fi' or %Event contains 'hir'", "First Third"},
+	}
+
+	for _, tt := range queryTable {
+		t.Run(tt.query, func(t *testing.T) {
+			reader := NewReader(strings.NewReader(movesGames))
+			if err := reader.SetQuery(tt.query); err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			var events []string
+			for {
+				game, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error '%v'", err)
+				}
+				event, _ := game.getField("Event")
+				events = append(events, event)
+			}
+			assert(t, strings.Join(events, " "), tt.events)
+		})
+	}
+}
@@ -0,0 +1,257 @@
+/*
+  pgnnag.go
+  Description: Numeric Annotation Glyphs (NAG) and their meaning
+*/
+
+package pgntools
+
+import (
+	"fmt" // printing msgs
+)
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// A Numeric Annotation Glyph (NAG) is given in PGN files as a dollar sign
+// followed by a non-negative integer, e.g., $1 or $14. The traditional suffix
+// annotations (!, ?, !!, ??, !? and ?!) are stored as NAGs as well
+type PgnNag int
+
+// Every NAG has a meaning, and it might be shown either as a Unicode glyph in
+// text output or as a command of the LaTeX packages skak/xskak
+type pgnNagInfo struct {
+	meaning string
+	glyph   string
+	latex   string
+}
+
+// globals
+// ----------------------------------------------------------------------------
+
+// the following map stores the meaning of all NAGs defined in the PGN standard
+// (0-139) and a few others commonly used by chess databases. Glyphs and LaTeX
+// commands are given only for those that have a standard symbol, and NAGs
+// which are not stored here are shown in PGN format, e.g., $255
+var nags = map[PgnNag]pgnNagInfo{
+	0:   {"null annotation", "", ""},
+	1:   {"good move", "!", "!"},
+	2:   {"poor move", "?", "?"},
+	3:   {"very good move", "‼", "!!"},
+	4:   {"very poor move", "⁇", "??"},
+	5:   {"speculative move", "⁉", "!?"},
+	6:   {"questionable move", "⁈", "?!"},
+	7:   {"forced move", "□", `\onlymove`},
+	8:   {"singular move", "□", `\onlymove`},
+	9:   {"worst move", "", ""},
+	10:  {"drawish position", "=", `\equal`},
+	11:  {"equal chances, quiet position", "=", `\equal`},
+	12:  {"equal chances, active position", "=", `\equal`},
+	13:  {"unclear position", "∞", `\unclear`},
+	14:  {"White has a slight advantage", "⩲", `\wbetter`},
+	15:  {"Black has a slight advantage", "⩱", `\bbetter`},
+	16:  {"White has a moderate advantage", "±", `\wupperhand`},
+	17:  {"Black has a moderate advantage", "∓", `\bupperhand`},
+	18:  {"White has a decisive advantage", "+−", `\wdecisive`},
+	19:  {"Black has a decisive advantage", "−+", `\bdecisive`},
+	20:  {"White has a crushing advantage", "+−", `\wdecisive`},
+	21:  {"Black has a crushing advantage", "−+", `\bdecisive`},
+	22:  {"White is in zugzwang", "⨀", `\zugzwang`},
+	23:  {"Black is in zugzwang", "⨀", `\zugzwang`},
+	24:  {"White has a slight space advantage", "", ""},
+	25:  {"Black has a slight space advantage", "", ""},
+	26:  {"White has a moderate space advantage", "○", `\moreroom`},
+	27:  {"Black has a moderate space advantage", "○", `\moreroom`},
+	28:  {"White has a decisive space advantage", "", ""},
+	29:  {"Black has a decisive space advantage", "", ""},
+	30:  {"White has a slight time (development) advantage", "", ""},
+	31:  {"Black has a slight time (development) advantage", "", ""},
+	32:  {"White has a moderate time (development) advantage", "⟳", `\devadvantage`},
+	33:  {"Black has a moderate time (development) advantage", "⟳", `\devadvantage`},
+	34:  {"White has a decisive time (development) advantage", "", ""},
+	35:  {"Black has a decisive time (development) advantage", "", ""},
+	36:  {"White has the initiative", "↑", `\withinit`},
+	37:  {"Black has the initiative", "↑", `\withinit`},
+	38:  {"White has a lasting initiative", "", ""},
+	39:  {"Black has a lasting initiative", "", ""},
+	40:  {"White has the attack", "→", `\withattack`},
+	41:  {"Black has the attack", "→", `\withattack`},
+	42:  {"White has insufficient compensation for material deficit", "", ""},
+	43:  {"Black has insufficient compensation for material deficit", "", ""},
+	44:  {"White has sufficient compensation for material deficit", "=/∞", `\compensation`},
+	45:  {"Black has sufficient compensation for material deficit", "=/∞", `\compensation`},
+	46:  {"White has more than adequate compensation for material deficit", "", ""},
+	47:  {"Black has more than adequate compensation for material deficit", "", ""},
+	48:  {"White has a slight center control advantage", "", ""},
+	49:  {"Black has a slight center control advantage", "", ""},
+	50:  {"White has a moderate center control advantage", "", ""},
+	51:  {"Black has a moderate center control advantage", "", ""},
+	52:  {"White has a decisive center control advantage", "", ""},
+	53:  {"Black has a decisive center control advantage", "", ""},
+	54:  {"White has a slight kingside control advantage", "", ""},
+	55:  {"Black has a slight kingside control advantage", "", ""},
+	56:  {"White has a moderate kingside control advantage", "", ""},
+	57:  {"Black has a moderate kingside control advantage", "", ""},
+	58:  {"White has a decisive kingside control advantage", "", ""},
+	59:  {"Black has a decisive kingside control advantage", "", ""},
+	60:  {"White has a slight queenside control advantage", "", ""},
+	61:  {"Black has a slight queenside control advantage", "", ""},
+	62:  {"White has a moderate queenside control advantage", "", ""},
+	63:  {"Black has a moderate queenside control advantage", "", ""},
+	64:  {"White has a decisive queenside control advantage", "", ""},
+	65:  {"Black has a decisive queenside control advantage", "", ""},
+	66:  {"White has a vulnerable first rank", "", ""},
+	67:  {"Black has a vulnerable first rank", "", ""},
+	68:  {"White has a well protected first rank", "", ""},
+	69:  {"Black has a well protected first rank", "", ""},
+	70:  {"White has a poorly protected king", "", ""},
+	71:  {"Black has a poorly protected king", "", ""},
+	72:  {"White has a well protected king", "", ""},
+	73:  {"Black has a well protected king", "", ""},
+	74:  {"White has a poorly placed king", "", ""},
+	75:  {"Black has a poorly placed king", "", ""},
+	76:  {"White has a well placed king", "", ""},
+	77:  {"Black has a well placed king", "", ""},
+	78:  {"White has a very weak pawn structure", "", ""},
+	79:  {"Black has a very weak pawn structure", "", ""},
+	80:  {"White has a moderately weak pawn structure", "", ""},
+	81:  {"Black has a moderately weak pawn structure", "", ""},
+	82:  {"White has a moderately strong pawn structure", "", ""},
+	83:  {"Black has a moderately strong pawn structure", "", ""},
+	84:  {"White has a very strong pawn structure", "", ""},
+	85:  {"Black has a very strong pawn structure", "", ""},
+	86:  {"White has poor knight placement", "", ""},
+	87:  {"Black has poor knight placement", "", ""},
+	88:  {"White has good knight placement", "", ""},
+	89:  {"Black has good knight placement", "", ""},
+	90:  {"White has poor bishop placement", "", ""},
+	91:  {"Black has poor bishop placement", "", ""},
+	92:  {"White has good bishop placement", "", ""},
+	93:  {"Black has good bishop placement", "", ""},
+	94:  {"White has poor rook placement", "", ""},
+	95:  {"Black has poor rook placement", "", ""},
+	96:  {"White has good rook placement", "", ""},
+	97:  {"Black has good rook placement", "", ""},
+	98:  {"White has poor queen placement", "", ""},
+	99:  {"Black has poor queen placement", "", ""},
+	100: {"White has good queen placement", "", ""},
+	101: {"Black has good queen placement", "", ""},
+	102: {"White has poor piece coordination", "", ""},
+	103: {"Black has poor piece coordination", "", ""},
+	104: {"White has good piece coordination", "", ""},
+	105: {"Black has good piece coordination", "", ""},
+	106: {"White has played the opening very poorly", "", ""},
+	107: {"Black has played the opening very poorly", "", ""},
+	108: {"White has played the opening poorly", "", ""},
+	109: {"Black has played the opening poorly", "", ""},
+	110: {"White has played the opening well", "", ""},
+	111: {"Black has played the opening well", "", ""},
+	112: {"White has played the opening very well", "", ""},
+	113: {"Black has played the opening very well", "", ""},
+	114: {"White has played the middlegame very poorly", "", ""},
+	115: {"Black has played the middlegame very poorly", "", ""},
+	116: {"White has played the middlegame poorly", "", ""},
+	117: {"Black has played the middlegame poorly", "", ""},
+	118: {"White has played the middlegame well", "", ""},
+	119: {"Black has played the middlegame well", "", ""},
+	120: {"White has played the middlegame very well", "", ""},
+	121: {"Black has played the middlegame very well", "", ""},
+	122: {"White has played the ending very poorly", "", ""},
+	123: {"Black has played the ending very poorly", "", ""},
+	124: {"White has played the ending poorly", "", ""},
+	125: {"Black has played the ending poorly", "", ""},
+	126: {"White has played the ending well", "", ""},
+	127: {"Black has played the ending well", "", ""},
+	128: {"White has played the ending very well", "", ""},
+	129: {"Black has played the ending very well", "", ""},
+	130: {"White has slight counterplay", "", ""},
+	131: {"Black has slight counterplay", "", ""},
+	132: {"White has moderate counterplay", "⇆", `\counterplay`},
+	133: {"Black has moderate counterplay", "⇆", `\counterplay`},
+	134: {"White has decisive counterplay", "", ""},
+	135: {"Black has decisive counterplay", "", ""},
+	136: {"White has moderate time control pressure", "", ""},
+	137: {"Black has moderate time control pressure", "", ""},
+	138: {"White has severe time control pressure", "⊕", `\timelimit`},
+	139: {"Black has severe time control pressure", "⊕", `\timelimit`},
+
+	// -- non-standard NAGs commonly used by chess databases
+	140: {"with the idea", "∆", `\with`},
+	142: {"better is", "⌓", `\betteris`},
+	146: {"novelty", "N", `\novelty`},
+	201: {"diagram", "D", ""},
+}
+
+// the following map stores the translation of traditional suffix annotations
+// into NAGs
+var suffixes = map[string]PgnNag{
+	"!":  1,
+	"?":  2,
+	"!!": 3,
+	"??": 4,
+	"!?": 5,
+	"?!": 6,
+}
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// getSuffixNAGs is a helper function that returns the NAGs of the given
+// sequence of suffix annotations. Sequences which are not traditional suffix
+// annotations (such as '!!!') are split into the longest ones from left to
+// right, e.g., '!!!' is taken as '!!' followed by '!'
+func getSuffixNAGs(suffix string) (result []PgnNag) {
+
+	for len(suffix) > 0 {
+		length := 1
+		if len(suffix) > 1 {
+			if _, ok := suffixes[suffix[:2]]; ok {
+				length = 2
+			}
+		}
+		result = append(result, suffixes[suffix[:length]])
+		suffix = suffix[length:]
+	}
+	return
+}
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// Return true if this NAG is one of the traditional suffix annotations (!, ?,
+// !!, ??, !? and ?!) which are written immediately after the move
+func (nag PgnNag) IsSuffix() bool {
+	return nag >= 1 && nag <= 6
+}
+
+// Return the meaning of this NAG. If it is unknown, a generic description is
+// returned
+func (nag PgnNag) Meaning() string {
+	if info, ok := nags[nag]; ok {
+		return info.meaning
+	}
+	return fmt.Sprintf("unknown annotation $%d", int(nag))
+}
+
+// Return a Unicode glyph representing this NAG. In case none is defined, the
+// NAG is shown in PGN format, i.e., $<number>
+func (nag PgnNag) String() string {
+	if info, ok := nags[nag]; ok && info.glyph != "" {
+		return info.glyph
+	}
+	return fmt.Sprintf("$%d", int(nag))
+}
+
+// Return the LaTeX command of the packages skak/xskak that represents this
+// NAG. In case none is defined, the NAG is shown in PGN format with the dollar
+// sign properly escaped
+func (nag PgnNag) LaTeX() string {
+	if info, ok := nags[nag]; ok && info.latex != "" {
+		return info.latex
+	}
+	return fmt.Sprintf(`\$%d`, int(nag))
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
@@ -0,0 +1,162 @@
+/*
+  pgnposition.go
+  Description: Search of positions in collections of chess games
+*/
+
+package pgntools
+
+import (
+	"strings" // string manipulation
+)
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// Positions are searched in any of the modes given by the constants
+// FullPosition, PiecePlacement and PiecePattern
+type PositionMode int
+
+// constants
+// ----------------------------------------------------------------------------
+
+// The following modes are acknowledged to decide whether a position of a game
+// matches the position searched for
+const (
+	FullPosition   PositionMode = 1 << iota // same pieces, side to move, castling and en passant
+	PiecePlacement                          // same pieces on the same squares
+	PiecePattern                            // the pieces given are on the same squares
+)
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// Return a new collection with all games of this one (in the same order) that
+// reached the position given in the specified FEN string, whatever the move
+// order. With FullPosition, the side to move, the castling ability and the en
+// passant captures have to be the same, whereas only the piece placement (the
+// first field of the FEN string) is compared with PiecePlacement. With
+// PiecePattern, the piece placement is a pattern and a position matches it if
+// all the pieces given in the pattern are on the same squares, e.g.,
+// "8/8/8/8/3PP3/8/8/8" matches all positions with white pawns on d4 and e4.
+//
+// With FullPosition, positions are compared with the Zobrist hashes computed
+// when games were replayed, whereas games are replayed again in the other modes.
+// The plies where the position was reached in every game are available with
+// GetPositionPlies, and the first one is available as the computed value
+// PositionPly. It returns a *PgnError of kind ErrQuery if the FEN string is not
+// correct
+func (games *PgnCollection) FindPosition(fen string, mode PositionMode) (result PgnCollection, err error) {
+
+	// get a function that decides whether a board matches the position
+	// searched for
+	var match func(board *PgnBoard) bool
+	var hash uint64
+	switch mode {
+	case FullPosition:
+		position, err := NewPgnBoardFromFen(fen)
+		if err != nil {
+			return result, newError(ErrQuery, fen, "%v", err.(*PgnError).Msg)
+		}
+		hash = position.hash
+		match = func(board *PgnBoard) bool {
+			return board.hash == hash
+		}
+
+	case PiecePlacement, PiecePattern:
+		squares, err := getPiecePlacement(strings.Fields(fen + " -")[0])
+		if err != nil {
+			return result, newError(ErrQuery, fen, "%v", err.(*PgnError).Msg)
+		}
+		match = func(board *PgnBoard) bool {
+			for square, piece := range squares {
+				if (piece != BLANK || mode == PiecePlacement) && board.squares[square] != piece {
+					return false
+				}
+			}
+			return true
+		}
+
+	default:
+		return result, newError(ErrQuery, fen, "unknown mode %v to search for positions", int(mode))
+	}
+
+	// and now process all games in this collection
+	result = PgnCollection{sortDescriptor: games.sortDescriptor, diagnostics: games.diagnostics}
+	for _, game := range games.slice {
+
+		// full positions are looked up among the hashes of the game,
+		// unless it has not been replayed yet
+		var plies []int
+		if mode == FullPosition && len(game.hashes) > 0 {
+			plies = game.findHash(hash)
+		} else if plies, err = game.findPosition(match); err != nil {
+			return result, err
+		}
+		if len(plies) == 0 {
+			continue
+		}
+
+		// games are copied, so that the values computed for this
+		// search are not recorded in the original collection
+		game.positions = plies
+		computed := map[string]dataInterface{"PositionPly": constInteger(plies[0])}
+		for key, value := range game.computed {
+			if key != "PositionPly" {
+				computed[key] = value
+			}
+		}
+		game.computed = computed
+
+		result.slice = append(result.slice, game)
+		result.nbGames += 1
+	}
+
+	return result, nil
+}
+
+// Return the plies of the mainline of this game where the position searched
+// for with FindPosition was reached, so that 0 stands for the initial position
+func (game *PgnGame) GetPositionPlies() []int {
+	return game.positions
+}
+
+// findHash is a helper function that returns all plies of the mainline of this
+// game where the position with the given Zobrist hash was reached, according
+// to the hashes computed when replaying it
+func (game *PgnGame) findHash(hash uint64) (plies []int) {
+
+	for ply, value := range game.hashes {
+		if value == hash {
+			plies = append(plies, ply)
+		}
+	}
+	return
+}
+
+// findPosition is a helper function that returns all plies of the mainline of
+// this game where the board satisfies the given function
+func (game *PgnGame) findPosition(match func(board *PgnBoard) bool) (plies []int, err error) {
+
+	board, _, _, err := game.getInitialPosition()
+	if err != nil {
+		return nil, err
+	}
+	for ply := 0; ; ply++ {
+		if match(&board) {
+			plies = append(plies, ply)
+		}
+		if ply == len(game.moves) {
+			break
+		}
+		if err = board.Play(game.moves[ply], false); err != nil {
+			err.(*PgnError).Ply = 1 + ply
+			return nil, game.location.locate(err.(*PgnError).at(game.moves[ply].offset))
+		}
+	}
+	return plies, nil
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
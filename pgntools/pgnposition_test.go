@@ -0,0 +1,123 @@
+package pgntools
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// a short collection of games where the same positions are reached with
+// different move orders
+var positionGames = `[Event "First"]
+
+1. e4 e5 2. Nf3 Nc6 *
+
+[Event "Second"]
+
+1. Nf3 Nc6 2. e4 e5 *
+
+[Event "Third"]
+
+1. d4 d5 2. e4 *
+
+[Event "Fourth"]
+
+1. Nf3 Nf6 2. Ng1 Ng8 *
+`
+
+// Test that games are found along with the plies where the position was reached
+func TestFindPosition(t *testing.T) {
+
+	var positionTable = []struct {
+		fen   string
+		mode  PositionMode
+		found string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", FullPosition,
+			"First: [0] Second: [0] Third: [0] Fourth: [0 4]"},
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3", FullPosition,
+			"First: [4] Second: [4]"},
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 2 3", FullPosition, ""},
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 2 3", PiecePlacement,
+			"First: [4] Second: [4]"},
+		{"8/8/8/8/4P3/8/8/8", PiecePattern, "First: [1 2 3 4] Second: [3 4] Third: [3]"},
+		{"8/8/8/3p4/3PP3/8/8/8", PiecePattern, "Third: [3]"},
+		{"8/8/8/8/8/8/8/6N1", PiecePattern,
+			"First: [0 1 2] Second: [0] Third: [0 1 2 3] Fourth: [0 3 4]"},
+	}
+
+	games, err := ReadGamesFromString(positionGames, 0, "", "", ReadOptions{Replay: true})
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	for _, tt := range positionTable {
+		t.Run(tt.fen, func(t *testing.T) {
+			found, err := games.FindPosition(tt.fen, tt.mode)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			var result []string
+			for _, game := range found.GetGames() {
+				event, _ := game.getField("Event")
+				result = append(result, fmt.Sprintf("%v: %v", event, game.GetPositionPlies()))
+			}
+			assert(t, strings.Join(result, " "), tt.found)
+		})
+	}
+
+	// the original collection is not modified
+	if len(games.GetGames()[0].GetPositionPlies()) != 0 {
+		t.Errorf("the original collection was modified")
+	}
+
+	// full positions are looked up among the hashes computed when games
+	// were read, so that games are not replayed again
+	games.slice[0].moves = nil
+	found, err := games.FindPosition(positionTable[1].fen, FullPosition)
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	if found.Len() != 2 || fmt.Sprint(found.GetGames()[0].GetPositionPlies()) != "[4]" {
+		t.Errorf("the position was not found with the hashes of the games")
+	}
+}
+
+// Test that the first ply where the position was reached can be used as any
+// other variable and that wrong positions are rejected
+func TestFindPositionErrors(t *testing.T) {
+
+	games, err := ReadGamesFromString(positionGames, 0, "", "", ReadOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	found, err := games.FindPosition("8/8/8/8/4P3/8/8/8", PiecePattern)
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	if err = found.Sort(">%PositionPly <%Event"); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	var events []string
+	for _, game := range found.GetGames() {
+		event, _ := game.getField("Event")
+		ply, _ := game.getField("PositionPly")
+		events = append(events, event+" "+ply)
+	}
+	assert(t, strings.Join(events, ", "), "Second 3, Third 3, First 1")
+
+	for _, fen := range []string{"8/8/8/8/4P3/8/8/8", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1"} {
+		if _, err := games.FindPosition(fen, FullPosition); !isQueryError(err) {
+			t.Errorf("got '%v' want a %v for '%v'", err, ErrQuery, fen)
+		}
+	}
+	if _, err := games.FindPosition("8/8/8/8/4P3/8/8", PiecePattern); !isQueryError(err) {
+		t.Errorf("got '%v' want a %v", err, ErrQuery)
+	}
+}
+
+// isQueryError is a helper function that returns true if the given error is a
+// *PgnError of kind ErrQuery
+func isQueryError(err error) bool {
+	pgnerr, ok := err.(*PgnError)
+	return ok && pgnerr.Kind == ErrQuery
+}
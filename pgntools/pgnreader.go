@@ -0,0 +1,469 @@
+/*
+  pgnreader.go
+  Description: Streaming reader of chess games in PGN format
+*/
+
+package pgntools
+
+import (
+	"bufio"   // buffered input
+	"fmt"     // printing boards
+	"io"      // io streams
+	"strings" // string manipulation
+
+	// import the parser of propositional formulae
+	"github.com/clinaresl/pgnparser/pfparser"
+)
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// A Reader retrieves chess games in PGN format from an io.Reader one at a
+// time, so that only the transcription of one game is kept in memory. Games
+// can be optionally filtered with a query so that only those satisfying it
+// are returned.
+//
+// The reader also keeps track of the number of lines and bytes read so far and
+// the location where the last game started, which is used to report errors.
+//
+// Games are replayed (see Replay) only if requested with SetReplay, if the
+// query depends on values computed when replaying them or in strict and lenient
+// modes. In strict mode, all moves are verified to be legal according to the
+// rules of chess. In lenient mode, games that can not be parsed are skipped and
+// games with moves that can not be reproduced (or which are illegal in strict
+// mode) are truncated at the last legal move. Every problem is then recorded as
+// a diagnostic instead of being returned as an error
+type Reader struct {
+	reader    *bufio.Reader     // input stream
+	pending   string            // text read but not processed yet
+	offset    int64             // number of bytes read so far
+	line      int               // number of lines read so far
+	column    int               // column where the pending text starts
+	start     pgnLocation       // location of the last game
+	index     int               // number of games read so far
+	showboard int               // number of plies between boards
+	verbose   bool              // whether verbose output is given
+	query     string            // query used for filtering games
+	evaluator *pfparser.Formula // compiled query, if any
+	replay    bool              // whether games returned are replayed
+	replayed  bool              // whether the query needs replayed games
+
+	// variables defined in the games read so far
+	defined map[string]pfparser.RelationalInterface
+
+	strict      bool            // whether moves are validated
+	lenient     bool            // whether malformed games are skipped
+	diagnostics []PgnDiagnostic // problems and warnings found
+}
+
+// The options used to read collections of games, see ReadGamesFromReader. Note
+// that strict and lenient modes can not be used together
+type ReadOptions struct {
+	Verbose bool // whether verbose output is given
+	Strict  bool // whether moves are validated
+	Lenient bool // whether malformed games are skipped
+	Replay  bool // whether games returned are replayed
+}
+
+// the transcription of moves is scanned character by character to find the
+// termination marker of every game. The following struct stores the state of
+// the scanner
+type pgnScanner struct {
+	movetext bool // whether the tags have been already processed
+	comment  bool // whether a comment is currently open
+	depth    int  // number of variations currently open
+}
+
+// globals
+// ----------------------------------------------------------------------------
+
+// the following are the game termination markers acknowledged in the PGN
+// standard
+var terminations = []string{"1-0", "0-1", "1/2-1/2", "*"}
+
+// the following map stores the names of the variables and functions which are
+// computed when replaying games, see replay and addFunctions. Queries that use
+// any of them require games to be replayed before evaluating them
+var replayedVariables = map[string]bool{
+	"Status":               true,
+	"ThreefoldRepetition":  true,
+	"FivefoldRepetition":   true,
+	"FiftyMoveRule":        true,
+	"SeventyFiveMoveRule":  true,
+	"InsufficientMaterial": true,
+	"OppositeBishops":      true,
+	"QueensTraded":         true,
+	"Promotion":            true,
+	"WhiteCastling":        true,
+	"BlackCastling":        true,
+	"WhiteMaterial":        true,
+	"BlackMaterial":        true,
+	"Material":             true,
+}
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// Return a new reader of PGN games from the given io.Reader. By default, all
+// games are accepted and no board is shown
+func NewReader(r io.Reader) *Reader {
+	return &Reader{reader: bufio.NewReader(r)}
+}
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// Set the number of plies between consecutive boards shown on the standard
+// output for every game returned. If it is zero, no board is shown
+func (reader *Reader) SetShowBoard(plies int) {
+	reader.showboard = plies
+}
+
+// Set whether verbose output should be given
+func (reader *Reader) SetVerbose(verbose bool) {
+	reader.verbose = verbose
+}
+
+// Set whether this reader works in strict mode or not, i.e., whether all moves
+// are verified to be legal according to the rules of chess
+func (reader *Reader) SetStrict(strict bool) {
+	reader.strict = strict
+}
+
+// Set whether this reader works in lenient mode or not
+func (reader *Reader) SetLenient(lenient bool) {
+	reader.lenient = lenient
+}
+
+// Set whether the games returned by this reader are replayed or not, so that
+// their final status, warnings and all values computed when replaying them
+// are available. Note that games are replayed anyway in strict and lenient
+// modes and if the query depends on values computed when replaying them
+func (reader *Reader) SetReplay(replay bool) {
+	reader.replay = replay
+}
+
+// Set the query used to filter games. Only games satisfying it are returned
+// and, if it is empty, all games are accepted. It returns a *PgnError in case
+// the query could not be compiled or if any computed field is used with a
+// wrong number of arguments, which shows the column where the error was found.
+//
+// Variables which are not defined in a game are null, so that games are not
+// accepted if the query depends on them. However, variables which are not
+// defined in any game are reported with an error once all games have been read
+func (reader *Reader) SetQuery(query string) (err error) {
+
+	reader.query, reader.evaluator, reader.replayed = query, nil, false
+	reader.defined = make(map[string]pfparser.RelationalInterface)
+	if query != "" {
+		if reader.evaluator, err = pfparser.Compile(query); err != nil {
+			return newError(ErrQuery, "", "%v", err)
+		}
+
+		// computed fields have to be used with the number of
+		// arguments they expect
+		if err = reader.evaluator.CheckArity(getFieldArities()); err != nil {
+			return newError(ErrQuery, "", "%v", err)
+		}
+		for _, name := range reader.evaluator.Variables() {
+			reader.replayed = reader.replayed || replayedVariables[name]
+		}
+	}
+	return
+}
+
+// Return the line where the last game returned started. Lines are numbered
+// starting from 1
+func (reader *Reader) GetLine() int {
+	return reader.start.line
+}
+
+// Return the number of games read so far, including those that did not satisfy
+// the query
+func (reader *Reader) GetIndex() int {
+	return reader.index
+}
+
+// Return the diagnostics recorded so far in lenient mode and the warnings
+// raised by the games returned, in the same order they were found
+func (reader *Reader) GetDiagnostics() []PgnDiagnostic {
+	return reader.diagnostics
+}
+
+// Return the next game that satisfies the query of this reader, if any was
+// given. All moves of the game are parsed before returning it, and it is
+// replayed if required, see SetReplay. When no more games are available, it
+// returns nil and io.EOF. Any other error is returned as a *PgnError which is
+// located in the input stream
+func (reader *Reader) Next() (*PgnGame, error) {
+
+	for {
+
+		// get the transcription of the next game. Games which are not
+		// terminated are skipped in lenient mode
+		pgn, err := reader.nextGame()
+		if err != nil {
+			if err != io.EOF && reader.skip(err) {
+				continue
+			}
+
+			// once all games have been read, verify that all
+			// variables of the query were defined in some game
+			if err == io.EOF && reader.evaluator != nil && len(reader.defined) > 0 {
+				if queryErr := reader.evaluator.Check(reader.defined); queryErr != nil {
+					return nil, newError(ErrQuery, "", "%v", queryErr)
+				}
+			}
+			return nil, err
+		}
+
+		// and parse it
+		location := newLocation(pgn, reader.index, reader.start.offset, reader.start.line, reader.start.column)
+		game, err := getGameFromString(pgn, reader.verbose)
+		if err != nil {
+			if err = location.locate(err.(*PgnError)); reader.skip(err) {
+				continue
+			}
+			return nil, err
+		}
+		game.location = location
+
+		// games are replayed before evaluating the query if it depends
+		// on the values computed when replaying them, and also in
+		// strict and lenient modes so that all games are validated or
+		// truncated whether they satisfy the query or not. Boards are
+		// shown only once the game satisfies the query, so that they
+		// are kept until then
+		var boards strings.Builder
+		replayed := reader.replayed || reader.strict || reader.lenient
+		if replayed {
+			if err := reader.replayGame(&game, &boards); err != nil {
+				return nil, err
+			}
+		}
+
+		// if a query was given, record the variables defined in this
+		// game, including the computed fields used in the query, and
+		// skip it unless it satisfies the query
+		if reader.evaluator != nil {
+			symtable := game.getSymtable(reader.evaluator.Variables()...)
+			for name, value := range symtable {
+				reader.defined[name] = value
+			}
+			if reader.evaluator.Evaluate(symtable) != pfparser.TypeBool(true) {
+				continue
+			}
+		}
+
+		// replay the game if requested and it was not replayed yet,
+		// and show its boards if necessary
+		if !replayed && (reader.replay || reader.showboard > 0) {
+			if err := reader.replayGame(&game, &boards); err != nil {
+				return nil, err
+			}
+		}
+		fmt.Print(boards.String())
+		reader.diagnostics = append(reader.diagnostics, game.GetWarnings()...)
+		return &game, nil
+	}
+}
+
+// replayGame is a helper function that replays the given game writing the
+// boards to show, if any, to the given builder. In lenient mode, games with
+// moves that can not be reproduced (or which are illegal in strict mode) are
+// truncated at the last legal move and a diagnostic is recorded. Otherwise,
+// the error is returned
+func (reader *Reader) replayGame(game *PgnGame, boards *strings.Builder) error {
+
+	err := game.replay(reader.showboard, reader.strict, boards)
+	if err == nil {
+		return nil
+	}
+	if !reader.lenient {
+		return err
+	}
+	game.truncate(err.(*PgnError).Ply - 1)
+	boards.Reset()
+	game.replay(reader.showboard, reader.strict, boards)
+	reader.diagnostics = append(reader.diagnostics, newDiagnostic(err.(*PgnError), Truncated))
+	return nil
+}
+
+// skip is a helper function that returns true if the game that raised the
+// given error has to be skipped, i.e., if this reader is in lenient mode and
+// the error is related to the game. In this case a diagnostic is recorded
+func (reader *Reader) skip(err error) bool {
+
+	pgnerr, ok := err.(*PgnError)
+	if !reader.lenient || !ok || pgnerr.Kind == ErrIO {
+		return false
+	}
+	reader.diagnostics = append(reader.diagnostics, newDiagnostic(pgnerr, Skipped))
+	return true
+}
+
+// nextLine is a helper function that returns the next line of the input
+// stream, including the newline character, if any, along with its offset and
+// the column where it starts. Text pending to be processed is returned
+// first. It returns io.EOF only if no more text is available
+func (reader *Reader) nextLine() (line string, offset int64, column int, err error) {
+
+	if reader.pending != "" {
+		line, reader.pending = reader.pending, ""
+		return line, reader.offset - int64(len(line)), reader.column, nil
+	}
+
+	line, err = reader.reader.ReadString('\n')
+	if len(line) > 0 {
+		reader.line += 1
+		reader.offset += int64(len(line))
+		err = nil
+	}
+	return line, reader.offset - int64(len(line)), 1, err
+}
+
+// setPending is a helper function that stores the given text, which is at the
+// end of the last line read and starts at the given column, to be processed
+// later
+func (reader *Reader) setPending(text string, column int) {
+	reader.pending, reader.column = text, column
+}
+
+// nextGame is a helper function that returns the full transcription of the
+// next game in the input stream, i.e., from its first tag to its termination
+// marker. It returns io.EOF in case no more games are found
+func (reader *Reader) nextGame() (string, error) {
+
+	var pgn strings.Builder
+	var scanner pgnScanner
+
+	for {
+
+		// get the next line. In case the stream is exhausted, check
+		// whether a game was being processed
+		line, offset, column, err := reader.nextLine()
+		if err == io.EOF {
+			if strings.TrimSpace(pgn.String()) != "" {
+				return "", reader.unterminated()
+			}
+			return "", io.EOF
+		}
+		if err != nil {
+			return "", newError(ErrIO, "", "%v", err)
+		}
+
+		// the section of tags consists of lines starting with '['. Empty
+		// lines and lines escaped with '%' are skipped before it. Within
+		// the game, escaped lines are blanked so that offsets are
+		// preserved
+		trimmed := strings.TrimSpace(line)
+		if !scanner.movetext {
+			if trimmed == "" || trimmed[0] == '%' {
+				if pgn.Len() > 0 {
+					pgn.WriteString(blank(line))
+				}
+				continue
+			}
+			if pgn.Len() == 0 {
+				reader.index += 1
+				reader.start = pgnLocation{index: reader.index, offset: offset, line: reader.line, column: column}
+			}
+			if trimmed[0] == '[' {
+				pgn.WriteString(line)
+				continue
+			}
+			scanner.movetext = true
+		} else if !scanner.comment && scanner.depth == 0 && len(trimmed) > 0 && trimmed[0] == '[' {
+
+			// if a tag is found within the transcription of moves,
+			// then the previous game was not terminated
+			reader.setPending(line, column)
+			return "", reader.unterminated()
+		}
+
+		// scan the transcription of moves in this line looking for the
+		// termination marker
+		line, end := scanner.scan(line)
+		if end >= 0 {
+
+			// the rest of the line is processed in the next game
+			pgn.WriteString(line[:end])
+			if strings.TrimSpace(line[end:]) != "" {
+				reader.setPending(line[end:], column+end)
+			}
+			return pgn.String(), nil
+		}
+		pgn.WriteString(line)
+	}
+}
+
+// blank is a helper function that returns a string with the same length than
+// the given line where all characters but the newline are replaced by spaces
+func blank(line string) string {
+	text := strings.TrimRight(line, "\n")
+	return strings.Repeat(" ", len(text)) + line[len(text):]
+}
+
+// unterminated is a helper function that returns an error located at the
+// beginning of the last game which states that it was not terminated
+func (reader *Reader) unterminated() error {
+	return reader.start.locate(newError(ErrSyntax, "", "the game is not terminated").at(0))
+}
+
+// scan the given line of the transcription of moves and return it along with
+// the position immediately after the termination marker of the game, or -1 if
+// it was not found. Rest of line comments (starting with ';') are skipped
+func (scanner *pgnScanner) scan(line string) (string, int) {
+
+	for idx := 0; idx < len(line); idx++ {
+
+		// comments are skipped until they are closed
+		if scanner.comment {
+			if line[idx] == '}' {
+				scanner.comment = false
+			}
+			continue
+		}
+
+		switch line[idx] {
+
+		case '{':
+			scanner.comment = true
+
+		case ';':
+			// comments to the end of the line can not contain the
+			// termination marker
+			return line, -1
+
+		case '(':
+			scanner.depth += 1
+
+		case ')':
+			scanner.depth -= 1
+
+		default:
+
+			// termination markers are recognized only in the
+			// mainline and when they are separated from other
+			// tokens
+			if scanner.depth > 0 ||
+				(idx > 0 && !strings.ContainsRune(" \t\r\n)}", rune(line[idx-1]))) {
+				continue
+			}
+			for _, termination := range terminations {
+				end := idx + len(termination)
+				if strings.HasPrefix(line[idx:], termination) &&
+					(end == len(line) || strings.ContainsRune(" \t\r\n", rune(line[end]))) {
+					return line, end
+				}
+			}
+		}
+	}
+
+	return line, -1
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
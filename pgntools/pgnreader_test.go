@@ -0,0 +1,498 @@
+package pgntools
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// a short collection of games with different peculiarities: games without
+// moves, variations, comments spanning several lines, rest-of-line comments
+// and escaped lines
+var readerGames = `% this line is escaped
+[Event "First"]
+[White "alice"]
+[PlyCount "3"]
+
+1. e4 e5 (1... c5 {Sicilian
+1-0 is not a termination here}) 2. Nf3 1-0
+
+[Event "Second"]
+[White "bob"]
+[PlyCount "0"]
+
+ *
+[Event "Third"]
+[White "carol"]
+[PlyCount "2"]
+
+1. d4 ; closed game 0-1
+d5 1/2-1/2 [Event "Fourth"]
+[White "alice"]
+[PlyCount "1"]
+
+1. c4 0-1
+`
+
+// Test that all games are returned one at a time along with the line where
+// they start
+func TestReader(t *testing.T) {
+
+	var expected = []struct {
+		event string
+		line  int
+		plies int
+	}{
+		{"First", 2, 3},
+		{"Second", 9, 0},
+		{"Third", 14, 2},
+		{"Fourth", 19, 1},
+	}
+
+	reader := NewReader(strings.NewReader(readerGames))
+	for _, tt := range expected {
+		game, err := reader.Next()
+		if err != nil {
+			t.Fatalf("unexpected error '%v'", err)
+		}
+		event, _ := game.getField("Event")
+		assert(t, event, tt.event)
+		if reader.GetLine() != tt.line {
+			t.Errorf("got line %v want %v", reader.GetLine(), tt.line)
+		}
+		if len(game.GetMoves()) != tt.plies {
+			t.Errorf("got %v plies want %v", len(game.GetMoves()), tt.plies)
+		}
+	}
+
+	if _, err := reader.Next(); err != io.EOF {
+		t.Fatalf("got '%v' want io.EOF", err)
+	}
+}
+
+// Test that games are filtered while they are read
+func TestReaderQuery(t *testing.T) {
+
+	reader := NewReader(strings.NewReader(readerGames))
+	if err := reader.SetQuery("%White = 'alice'"); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	var events []string
+	for {
+		game, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error '%v'", err)
+		}
+		event, _ := game.getField("Event")
+		events = append(events, event)
+	}
+	assert(t, strings.Join(events, " "), "First Fourth")
+	if reader.GetIndex() != 4 {
+		t.Errorf("got %v games read want 4", reader.GetIndex())
+	}
+}
+
+// Test that dates, times and time controls are typed values in queries
+func TestReaderTypedQuery(t *testing.T) {
+
+	var typedGames = `[Event "First"]
+[Date "2016.05.07"]
+[UTCTime "21:07:42"]
+[TimeControl "180+2"]
+
+1. e4 *
+
+[Event "Second"]
+[Date "2016.??.??"]
+[UTCTime "09:30:00"]
+[TimeControl "-"]
+
+1. d4 *
+
+[Event "Third"]
+[Date "2015.12.31"]
+[UTCTime "23:59:59"]
+[TimeControl "5400+30"]
+
+1. c4 *
+
+[Event "Fourth"]
+[Date "sometime"]
+[UTCTime "22:00:00"]
+[TimeControl "?"]
+
+1. Nf3 *
+`
+
+	var queryTable = []struct {
+		query  string
+		events string
+	}{
+		{"%Date >= '2016.01.01'", "First Fourth"},
+		{"%Date < '2016.01.01'", "Third"},
+		{"%Date > '2015.06.01' and %Date != 'sometime'", "First Second Third"},
+		{"'2016' in %Date", "First Second"},
+		{"%Date = 'sometime'", "Fourth"},
+		{"%Weekday(%Date) = 'Saturday' or %Hour(%UTCTime) < 12", "First Second"},
+		{"%TimeControl < 480", "First"},
+		{"%TimeControl >= '600+0' or %TimeControl = '-'", "Second Third"},
+	}
+
+	for _, tt := range queryTable {
+		t.Run(tt.query, func(t *testing.T) {
+			reader := NewReader(strings.NewReader(typedGames))
+			if err := reader.SetQuery(tt.query); err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			var events []string
+			for {
+				game, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error '%v'", err)
+				}
+				event, _ := game.getField("Event")
+				events = append(events, event)
+			}
+			assert(t, strings.Join(events, " "), tt.events)
+		})
+	}
+}
+
+// Test that errors in queries are reported with their location
+func TestReaderQueryErrors(t *testing.T) {
+
+	// syntax errors are reported when the query is set
+	reader := NewReader(strings.NewReader(readerGames))
+	err := reader.SetQuery("%White = 'alice' %Black = 'bob'")
+	if pgnerr, ok := err.(*PgnError); !ok || pgnerr.Kind != ErrQuery {
+		t.Fatalf("a query error was expected but '%v' was found", err)
+	}
+	if !strings.Contains(err.Error(), "column 18") {
+		t.Errorf("the column of the error is not shown in '%v'", err)
+	}
+
+	// and variables which are not defined in any game are reported once
+	// all games have been read
+	if err = reader.SetQuery("%White = 'alice' or %Opening = 'Sicilian'"); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	var events []string
+	for {
+		game, err := reader.Next()
+		if err != nil {
+			if pgnerr, ok := err.(*PgnError); !ok || pgnerr.Kind != ErrQuery {
+				t.Fatalf("a query error was expected but '%v' was found", err)
+			}
+			if !strings.Contains(err.Error(), "Unknown variable 'Opening' at column 21") {
+				t.Errorf("the unknown variable is not shown in '%v'", err)
+			}
+			break
+		}
+		event, _ := game.getField("Event")
+		events = append(events, event)
+	}
+	assert(t, strings.Join(events, " "), "First Fourth")
+}
+
+// Test that variables which are not defined in some games are null, and so
+// are arithmetic expressions over strings or with a division by zero. Tags with
+// different types in different games can not be compared and are unknown
+func TestReaderMissingTags(t *testing.T) {
+
+	var mixedGames = `[Event "First"]
+[Site "https://lichess.org/abcdefgh"]
+[UTCTime "21:07:42"]
+[WhiteElo "?"]
+[BlackElo "2000"]
+
+1. e4 e5 1-0
+
+[Event "Second"]
+[Site "FICS freechess.org"]
+[FICSGamesDBGameNo "388217416"]
+[Time "09:30:00"]
+[WhiteElo "2200"]
+[BlackElo "2000"]
+
+1. d4 d5 0-1
+
+[Event "Third"]
+[Site "https://lichess.org/ijklmnop"]
+[UTCTime "09:59:59"]
+
+1. c4 e5 1/2-1/2
+`
+
+	var queryTable = []struct {
+		query  string
+		events string
+	}{
+		{"%FICSGamesDBGameNo > 0", "Second"},
+		{"not %FICSGamesDBGameNo > 0", ""},
+		{"%FICSGamesDBGameNo > 0 or %Site ~ 'lichess'", "First Second Third"},
+		{"%FICSGamesDBGameNo > 0 and %Site ~ 'lichess'", ""},
+		{"missing(%FICSGamesDBGameNo)", "First Third"},
+		{"exists(%UTCTime) and %Hour(%UTCTime) >= 12", "First"},
+		{"%Hour(%UTCTime) < 12 or %Hour(%Time) < 12", "Second Third"},
+		{"missing(%Opening)", "First Second Third"},
+		{"%WhiteElo - %BlackElo > 100", "Second"},
+		{"not %WhiteElo - %BlackElo > 100", ""},
+		{"%BlackElo / 0 > 1 or %Site ~ 'lichess'", "First Third"},
+		{"%WhiteElo > 2000", "Second"},
+		{"not %WhiteElo > 2000", ""},
+		{"%WhiteElo = '?'", "First"},
+		{"%WhiteElo != '?' or missing(%WhiteElo)", "Third"},
+	}
+
+	for _, tt := range queryTable {
+		t.Run(tt.query, func(t *testing.T) {
+			reader := NewReader(strings.NewReader(mixedGames))
+			if err := reader.SetQuery(tt.query); err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			var events []string
+			for {
+				game, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error '%v'", err)
+				}
+				event, _ := game.getField("Event")
+				events = append(events, event)
+			}
+			assert(t, strings.Join(events, " "), tt.events)
+		})
+	}
+}
+
+// Test that games without a termination marker are reported
+func TestReaderUnterminated(t *testing.T) {
+
+	reader := NewReader(strings.NewReader("[Event \"First\"]\n\n1. e4 e5\n\n[Event \"Second\"]\n\n1. d4 *\n"))
+	if _, err := reader.Next(); err == nil {
+		t.Fatalf("an error was expected")
+	}
+}
+
+// Test that errors are located in the input stream
+func TestReaderErrors(t *testing.T) {
+
+	var errorTable = []struct {
+		pgn    string
+		kind   ErrorKind
+		game   int
+		line   int
+		column int
+		ply    int
+		text   string
+	}{
+		{"[Event \"A\"]\n\n1. e4 e5 2. Nf3 1-0\n\n[Event \"B\"]\n\n1. e4 e5 2. Ke3 1-0\n",
+			ErrMove, 2, 7, 13, 3, "Ke3"},
+		{"[Event \"A\"]\n\n1. e4 e5\n2. Nf3 Nc6 3. Bb5 a6 (3... Nf6 ) 4. Ba4 Zz6 1-0\n",
+			ErrSyntax, 1, 4, 41, 0, "Zz6 1-0"},
+		{"[Event \"A\"]\n\n1. e4 e5 (1... c5 2. Nf3 1-0\n",
+			ErrSyntax, 1, 1, 1, 0, ""},
+		{"[Event \"A\"]\n1. e4 *\n[Event \"B\"]\n[Site \"C\"]\n\n1. d4\n[Event \"C\"]\n1. c4 *\n",
+			ErrSyntax, 2, 3, 1, 0, ""},
+		{"[Event \"A\"]\n1. e4 * [Event \"B\"\n1. e4 *\n",
+			ErrTag, 2, 2, 9, 0, "[Event \"B\""},
+		{"[Event \"A\"]\n1. e4 * [Event \"B\"]\n1. e4 e5 2. Ke3 *\n",
+			ErrMove, 2, 3, 13, 3, "Ke3"},
+	}
+
+	for _, tt := range errorTable {
+		t.Run(tt.pgn, func(t *testing.T) {
+			var err error
+			reader := NewReader(strings.NewReader(tt.pgn))
+			reader.SetReplay(true)
+			for err == nil {
+				_, err = reader.Next()
+			}
+			pgnerr, ok := err.(*PgnError)
+			if !ok {
+				t.Fatalf("got '%v' want a *PgnError", err)
+			}
+			if pgnerr.Kind != tt.kind || pgnerr.Game != tt.game ||
+				pgnerr.Line != tt.line || pgnerr.Column != tt.column ||
+				pgnerr.Ply != tt.ply || pgnerr.Text != tt.text {
+				t.Fatalf("got '%v' (%v, game %v, line %v, column %v, ply %v)",
+					pgnerr, pgnerr.Kind, pgnerr.Game, pgnerr.Line, pgnerr.Column, pgnerr.Ply)
+			}
+
+			// the offset has to point to the same location
+			lines := strings.Split(tt.pgn, "\n")
+			offset := int64(tt.column - 1)
+			for _, line := range lines[:tt.line-1] {
+				offset += int64(len(line) + 1)
+			}
+			if pgnerr.Offset != offset {
+				t.Fatalf("got offset %v want %v", pgnerr.Offset, offset)
+			}
+		})
+	}
+}
+
+// Test that malformed games are skipped or truncated in lenient mode
+func TestReaderLenient(t *testing.T) {
+
+	var pgn = `[Event "First"]
+
+1. e4 e5 2. Ke3 Nc6 1-0
+
+[Event "Second"]
+
+1. e4 e5 2. Zz9 1-0
+
+[Event "Third"]
+
+1. d4 d5
+
+[Event "Fourth"]
+
+1. c4 *
+`
+
+	var expected = []struct {
+		event string
+		plies int
+	}{
+		{"First", 2},
+		{"Fourth", 1},
+	}
+
+	var diagnostics = []PgnDiagnostic{
+		{Game: 1, Line: 3, Column: 13, Ply: 3, Action: Truncated},
+		{Game: 2, Line: 7, Column: 13, Action: Skipped},
+		{Game: 3, Line: 9, Column: 1, Action: Skipped},
+	}
+
+	reader := NewReader(strings.NewReader(pgn))
+	reader.SetLenient(true)
+	for _, tt := range expected {
+		game, err := reader.Next()
+		if err != nil {
+			t.Fatalf("unexpected error '%v'", err)
+		}
+		event, _ := game.getField("Event")
+		assert(t, event, tt.event)
+		if len(game.GetMoves()) != tt.plies {
+			t.Errorf("got %v plies want %v", len(game.GetMoves()), tt.plies)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Fatalf("got '%v' want io.EOF", err)
+	}
+
+	got := reader.GetDiagnostics()
+	if len(got) != len(diagnostics) {
+		t.Fatalf("got diagnostics '%v'", got)
+	}
+	for idx, diagnostic := range diagnostics {
+		if got[idx].Game != diagnostic.Game || got[idx].Line != diagnostic.Line ||
+			got[idx].Column != diagnostic.Column || got[idx].Ply != diagnostic.Ply ||
+			got[idx].Action != diagnostic.Action || got[idx].Reason == "" {
+			t.Errorf("got diagnostic '%v' want '%v'", got[idx], diagnostic)
+		}
+	}
+}
+
+// Test that games are replayed only when needed and that replay errors are
+// reported whether games satisfy the query or not
+func TestReaderReplay(t *testing.T) {
+
+	var pgn = `[Event "First"]
+
+1. e4 e5 2. Ke3 Nc6 1-0
+
+[Event "Second"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+`
+
+	var replayTable = []struct {
+		query  string
+		replay bool
+		strict bool
+		events string
+		status string
+	}{
+		{"", false, false, "First Second", "0 0"},
+		{"", true, false, "", ""},
+		{"%Event = 'Second'", false, false, "Second", "0"},
+		{"%Event = 'Second'", true, false, "Second", "2"},
+		{"%Event = 'Second'", false, true, "", ""},
+		{"%Status = 'Checkmate'", false, false, "", ""},
+	}
+
+	for _, tt := range replayTable {
+		t.Run(fmt.Sprintf("%v/%v/%v", tt.query, tt.replay, tt.strict), func(t *testing.T) {
+			reader := NewReader(strings.NewReader(pgn))
+			reader.SetReplay(tt.replay)
+			reader.SetStrict(tt.strict)
+			if err := reader.SetQuery(tt.query); err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			var events, status []string
+			for {
+				game, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+
+				// games that can not be replayed are always reported
+				// as errors when they are replayed
+				if err != nil {
+					if pgnerr, ok := err.(*PgnError); !ok || pgnerr.Game != 1 || pgnerr.Kind != ErrMove {
+						t.Fatalf("unexpected error '%v'", err)
+					}
+					break
+				}
+				event, _ := game.getField("Event")
+				events = append(events, event)
+				status = append(status, fmt.Sprintf("%v", int(game.GetStatus())))
+			}
+			assert(t, strings.Join(events, " "), tt.events)
+			assert(t, strings.Join(status, " "), tt.status)
+		})
+	}
+}
+
+// Test that the boards of games are shown only once, even if they are
+// truncated
+func TestReaderBoards(t *testing.T) {
+
+	game, err := getGameFromString("[Event \"First\"]\n\n1. e4 e5 2. Ke3 Nc6 1-0\n", false)
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	var boards strings.Builder
+	reader := NewReader(strings.NewReader(""))
+	reader.SetLenient(true)
+	reader.SetShowBoard(1)
+	if err := reader.replayGame(&game, &boards); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	assert(t, fmt.Sprint(strings.Count(boards.String(), "e4 \n")), "1")
+	assert(t, fmt.Sprint(strings.Count(boards.String(), "e5 \n")), "1")
+	assert(t, fmt.Sprint(strings.Count(boards.String(), "Ke3")), "0")
+	assert(t, fmt.Sprint(strings.Count(boards.String(), "a b c d e f g h")), "2")
+
+	// no board is shown unless requested
+	boards.Reset()
+	reader.SetShowBoard(0)
+	if err := reader.replayGame(&game, &boards); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	assert(t, boards.String(), "")
+}
@@ -0,0 +1,161 @@
+/*
+  pgnstatus.go
+  Description: Final status of chess games and verification of their results
+*/
+
+package pgntools
+
+import (
+	"fmt"     // printing msgs
+	"strings" // string manipulation
+)
+
+// typedefs
+// ----------------------------------------------------------------------------
+
+// The final status of a game is represented with an integer that is matched
+// against the constants Unterminated, Checkmate, Stalemate, Resignation,
+// TimeForfeit, Abandoned, Adjudication, RulesInfraction and Draw. Games which
+// have not been replayed have a null status
+type GameStatus int
+
+// constants
+// ----------------------------------------------------------------------------
+
+// A game can finish in any of the following ways
+const (
+	Unterminated    GameStatus = 1 << iota // the game is not over
+	Checkmate                              // the side to move is checkmated
+	Stalemate                              // the side to move is stalemated
+	Resignation                            // one side resigned
+	TimeForfeit                            // one side lost on time
+	Abandoned                              // one side abandoned the game
+	Adjudication                           // the result was adjudicated
+	RulesInfraction                        // one side violated the rules
+	Draw                                   // the game was drawn otherwise
+)
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// Return a string with the name of this status
+func (status GameStatus) String() string {
+	switch status {
+	case Unterminated:
+		return "Unterminated"
+	case Checkmate:
+		return "Checkmate"
+	case Stalemate:
+		return "Stalemate"
+	case Resignation:
+		return "Resignation"
+	case TimeForfeit:
+		return "TimeForfeit"
+	case Abandoned:
+		return "Abandoned"
+	case Adjudication:
+		return "Adjudication"
+	case RulesInfraction:
+		return "RulesInfraction"
+	case Draw:
+		return "Draw"
+	}
+	return "Unknown"
+}
+
+// Return the final status of this game. It is known only once the game has
+// been replayed, see Replay
+func (game *PgnGame) GetStatus() GameStatus {
+	return game.status
+}
+
+// Return the warnings raised while replaying this game, i.e., moves annotated
+// with a wrong check or checkmate suffix and results that contradict each
+// other or the final position
+func (game *PgnGame) GetWarnings() []PgnDiagnostic {
+	return game.warnings
+}
+
+// getStatus is a helper function that returns the final status of this game
+// given the board with its final position. Checkmates and stalemates are
+// detected on the board. Otherwise, the status is taken from the tag
+// Termination or, in its absence, from the last comment as written by
+// ficsgames.org and, finally, from the outcome
+func (game *PgnGame) getStatus(board PgnBoard) GameStatus {
+
+	if board.IsCheckmate() {
+		return Checkmate
+	}
+	if board.IsStalemate() {
+		return Stalemate
+	}
+
+	// the termination is taken from the tag Termination if given and, if
+	// not, from the last comment
+	var termination string
+	if value, ok := game.tags["Termination"]; ok {
+		termination = strings.ToLower(fmt.Sprintf("%v", value))
+	} else if len(game.moves) > 0 {
+		termination = strings.ToLower(game.moves[len(game.moves)-1].comments)
+	}
+
+	switch {
+	case game.outcome.getResult() == "*":
+		return Unterminated
+	case strings.Contains(termination, "time forfeit"),
+		strings.Contains(termination, "forfeits on time"):
+		return TimeForfeit
+	case strings.Contains(termination, "abandon"):
+		return Abandoned
+	case strings.Contains(termination, "adjudicat"):
+		return Adjudication
+	case strings.Contains(termination, "rules infraction"):
+		return RulesInfraction
+	case game.outcome.getResult() == "1/2-1/2":
+		return Draw
+	}
+	return Resignation
+}
+
+// checkSuffix is a helper function that returns a warning if the given move,
+// which was played on the given board, is annotated as check or checkmate and
+// it is not, or if it checkmates but it is annotated as check. Otherwise, it
+// returns nil
+func checkSuffix(board *PgnBoard, move PgnMove) *PgnError {
+
+	switch {
+	case strings.HasSuffix(move.moveValue, "#") && !board.IsCheckmate():
+		return newError(ErrMove, move.moveValue, "the move is annotated as checkmate but it is not")
+	case strings.HasSuffix(move.moveValue, "+") && !board.IsCheck():
+		return newError(ErrMove, move.moveValue, "the move is annotated as check but it does not check the king")
+	case strings.HasSuffix(move.moveValue, "+") && board.IsCheckmate():
+		return newError(ErrMove, move.moveValue, "the move checkmates but it is annotated as check")
+	}
+	return nil
+}
+
+// checkResult is a helper function that returns warnings if the tag Result,
+// the outcome given after the moves and the final status of this game
+// contradict each other
+func (game *PgnGame) checkResult(board PgnBoard) (warnings []*PgnError) {
+
+	result := game.outcome.getResult()
+	if tag, ok := game.tags["Result"]; ok && fmt.Sprintf("%v", tag) != result {
+		warnings = append(warnings, newError(ErrTag, "", "the tag Result %q contradicts the outcome %q", fmt.Sprintf("%v", tag), result))
+	}
+
+	// the side checkmated is the side to move
+	switch {
+	case game.status == Checkmate && board.turn > 0 && result != "0-1",
+		game.status == Checkmate && board.turn < 0 && result != "1-0":
+		warnings = append(warnings, newError(ErrTag, "", "the game ends in checkmate but the outcome is %q", result))
+	case game.status == Stalemate && result != "1/2-1/2":
+		warnings = append(warnings, newError(ErrTag, "", "the game ends in stalemate but the outcome is %q", result))
+	}
+	return
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
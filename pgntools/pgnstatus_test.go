@@ -0,0 +1,61 @@
+package pgntools
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that the final status of games is computed and that contradictions
+// between the result, the outcome and the board are warned
+func TestStatus(t *testing.T) {
+
+	var statusTable = []struct {
+		pgn      string
+		status   GameStatus
+		warnings []string
+	}{
+		{"[Result \"0-1\"]\n\n1. f3 e5 2. g4 Qh4# 0-1", Checkmate, nil},
+		{"[Result \"1-0\"]\n\n1. f3 e5 2. g4 Qh4# 1-0",
+			Checkmate, []string{"ends in checkmate"}},
+		{"[Result \"1-0\"]\n\n1. f3 e5 2. g4 Qh4# 0-1",
+			Checkmate, []string{"contradicts the outcome"}},
+		{"[Result \"0-1\"]\n\n1. f3 e5 2. g4 Qh4+ 0-1",
+			Checkmate, []string{"checkmates but it is annotated as check"}},
+		{"[Result \"1-0\"]\n\n1. e4+ e5# 1-0",
+			Resignation, []string{"annotated as check", "annotated as checkmate"}},
+		{"[SetUp \"1\"]\n[FEN \"k7/8/2Q5/8/8/8/8/4K3 w - - 0 1\"]\n[Result \"1/2-1/2\"]\n\n1. Qb6 1/2-1/2",
+			Stalemate, nil},
+		{"[SetUp \"1\"]\n[FEN \"k7/8/2Q5/8/8/8/8/4K3 w - - 0 1\"]\n[Result \"1-0\"]\n\n1. Qb6 1-0",
+			Stalemate, []string{"ends in stalemate"}},
+		{"[Termination \"Time forfeit\"]\n\n1. e4 e5 0-1", TimeForfeit, nil},
+		{"[Termination \"Abandoned\"]\n\n1. e4 e5 1-0", Abandoned, nil},
+		{"\n\n1. e4 e5 {White forfeits on time} 0-1", TimeForfeit, nil},
+		{"[Termination \"Normal\"]\n\n1. e4 e5 1-0", Resignation, nil},
+		{"[Termination \"Normal\"]\n\n1. e4 e5 1/2-1/2", Draw, nil},
+		{"[Event \"A\"]\n\n1. e4 e5 *", Unterminated, nil},
+	}
+
+	for _, tt := range statusTable {
+		t.Run(tt.pgn, func(t *testing.T) {
+			game, err := getGameFromString("[Event \"A\"]\n"+tt.pgn, false)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			if err = game.Replay(0); err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			if game.GetStatus() != tt.status {
+				t.Errorf("got status %v want %v", game.GetStatus(), tt.status)
+			}
+			warnings := game.GetWarnings()
+			if len(warnings) != len(tt.warnings) {
+				t.Fatalf("got warnings %v", warnings)
+			}
+			for idx, warning := range warnings {
+				if warning.Action != Warning || !strings.Contains(warning.Reason, tt.warnings[idx]) {
+					t.Errorf("got warning '%v' want '%v'", warning, tt.warnings[idx])
+				}
+			}
+		})
+	}
+}
@@ -21,16 +21,12 @@
 package pgntools
 
 import (
+	"io"      // io streams
 	"log"     // logging services
+	"os"      // access to file mgmt functions
 	"regexp"  // pgn files are parsed with a regexp
-	"sort"    // for sorting games
 	"strconv" // to convert from strings to other types
-
-	// import a user package to manage paths
-	"github.com/clinaresl/pgnparser/fstools"
-
-	// import the parser of propositional formulae
-	"github.com/clinaresl/pgnparser/pfparser"
+	"strings" // to trim strings
 )
 
 // global variables
@@ -46,18 +42,16 @@ var reTags = regexp.MustCompile(`(\[\s*\w+\s*"[^"]*"\s*\]\s*)+`)
 // the following regexp matches an arbitrary sequence of moves which are
 // identified by a number, a color (symbolized by either one dot for white or
 // three dots for black) and the move in algebraic format. Moves can be followed
-// by an arbitrary number of comments
-var reMoves = regexp.MustCompile(`(?:(\d+)(\.|\.{3})\s*((?:[PNBRQK]?[a-h]?[1-8]?x?(?:[a-h][1-8]|[NBRQK])(?:\=[PNBRQK])?|O(?:-?O){1,2})[\+#]?(?:\s*[\!\?]+)?)\s*({[^{}]*}\s*)*\s*((?:[PNBRQK]?[a-h]?[1-8]?x?(?:[a-h][1-8]|[NBRQK])(?:\=[PNBRQK])?|O(?:-?O){1,2})[\+#]?(?:\s*[\!\?]+)?)\s*({[^{}]*}\s*)*\s*)+`)
+// by an arbitrary number of comments, Numeric Annotation Glyphs (NAG) and
+// recursive annotation variations (RAV),
+// i.e., alternative lines given between parenthesis. Note that regular
+// expressions can not verify that parenthesis are properly balanced, and this
+// is verified later when processing the moves
+var reMoves = regexp.MustCompile(`(?:(?:\d+(?:\.{3}|\.)|(?:[PNBRQK]?[a-h]?[1-8]?x?(?:[a-h][1-8]|[NBRQK])(?:\=[PNBRQK])?|O(?:-?O){1,2})[\+#]?(?:\s*[\!\?]+)?|\$\d+|{[^{}]*}|;[^\n]*|\(|\))\s*)+`)
 
 // the outcome is one of the following strings "1-0", "0-1" or "1/2-1/2"
 var reOutcome = regexp.MustCompile(`(1\-0|0\-1|1/2\-1/2|\*)`)
 
-// the following regexp is used to parse the description of an entire game,
-// including the tags, list of moves and final outcome. It consists of a
-// concatenation of the previous expressions where an arbitrary number of spaces
-// is allowed between them
-var reGame = regexp.MustCompile(`\s*(\[\s*(?P<tagname>\w+)\s*"(?P<tagvalue>[^"]*)"\s*\]\s*)+\s*(?:(\d+)(\.|\.{3})\s*((?:[PNBRQK]?[a-h]?[1-8]?x?(?:[a-h][1-8]|[NBRQK])(?:\=[PNBRQK])?|O(?:-?O){1,2})[\+#]?(?:\s*[\!\?]+)?)\s*({[^{}]*}\s*)*\s*((?:[PNBRQK]?[a-h]?[1-8]?x?(?:[a-h][1-8]|[NBRQK])(?:\=[PNBRQK])?|O(?:-?O){1,2})[\+#]?(?:\s*[\!\?]+)?)\s*({[^{}]*}\s*)*\s*)+\s*(1\-0|0\-1|1/2\-1/2|\*)\s*`)
-
 // grouped regexps -- they are used to extract relevant information from a
 // string
 // ----------------------------------------------------------------------------
@@ -67,14 +61,27 @@ var reGame = regexp.MustCompile(`\s*(\[\s*(?P<tagname>\w+)\s*"(?P<tagvalue>[^"]*
 var reGroupTags = regexp.MustCompile(`\[\s*(?P<tagname>\w+)\s*"(?P<tagvalue>[^"]*)"\s*\]\s*`)
 
 // this regexp is used just to extract the textual description of a single move
-// which might be preceded by a move number and color identification
-var reGroupMoves = regexp.MustCompile(`(?:(?P<moveNumber>\d+)?(?P<color>\.|\.{3})?\s*(?P<moveValue>(?:[PNBRQK]?[a-h]?[1-8]?x?(?:[a-h][1-8]|[NBRQK])(?:\=[PNBRQK])?|O(?:-?O){1,2})[\+#]?(?:\s*[\!\?]+)?)\s*)`)
+// which might be preceded by a move number and color identification and
+// followed by a traditional suffix annotation (such as '!' or '?!'). Note that
+// moves are expected to be matched at the beginning of the string (^)
+var reGroupMoves = regexp.MustCompile(`^\s*(?:(?P<moveNumber>\d+)?(?P<color>\.{3}|\.)?\s*(?P<moveValue>(?:[PNBRQK]?[a-h]?[1-8]?x?(?:[a-h][1-8]|[NBRQK])(?:\=[PNBRQK])?|O(?:-?O){1,2})[\+#]?)\s*(?P<suffix>[\!\?]+)?\s*)`)
 
 // comments following any move are matched with the following regexp. Note that
 // comments are expected to be matched at the beginning of the string (^) and
 // its occurrence is required to happen precisely once. This makes sense since
-// the whole string is parsed in chunks
-var reGroupComment = regexp.MustCompile(`^(?P<comment>{[^{}]*})\s*`)
+// the whole string is parsed in chunks. Comments are given either between
+// braces or after a semicolon until the end of the line
+var reGroupComment = regexp.MustCompile(`^(?:{(?P<comment>[^{}]*)}|;(?P<line>[^\r\n]*))\s*`)
+
+// Numeric Annotation Glyphs consist of a dollar sign followed by a number. They
+// are expected to be matched at the beginning of the string
+var reGroupNAG = regexp.MustCompile(`^\$(?P<nag>\d+)\s*`)
+
+// Recursive annotation variations are started with an opening parenthesis and
+// finished with a closing parenthesis. Again, they are expected to be matched at
+// the beginning of the string
+var reGroupOpenVariation = regexp.MustCompile(`^\s*\(\s*`)
+var reGroupCloseVariation = regexp.MustCompile(`^\s*\)\s*`)
 
 // A specific type of comments provided by ficsgames.org is the time elapsed to
 // make the current move. This is parsed in the following expression. Again,
@@ -121,74 +128,207 @@ func getTags(pgn string) (tags map[string]dataInterface) {
 
 // Return a slice of PgnMove with the information in the string 'pgn' which
 // shall consist of a legal transcription of legal PGN moves that might be
-// annotated (an arbitrary number of times) or not. 'emt' annotations are also
-// acknowledged and their information is added to the slice of PgnMove
-func getMoves(pgn string) (moves []PgnMove) {
+// annotated (an arbitrary number of times) or not. 'emt' annotations and
+// Numeric Annotation Glyphs are also acknowledged and their information is
+// added to the slice of PgnMove.
+//
+// Recursive annotation variations are stored in the move they are an
+// alternative to, so that the slice returned contains only the mainline.
+//
+// In case of error, the offset of the offending text relative to the beginning
+// of the given string is returned along with it. The same offset is stored in
+// every move
+func getMoves(pgn string) (moves []PgnMove, err error) {
+
+	// unless explicitly given, moves are numbered from the initial
+	// position, i.e., as if black had played the move number zero
+	return getMovesFrom(pgn, 0, -1)
+}
+
+// Return a slice of PgnMove with the information in the string 'pgn' as
+// getMoves does. Moves which are not explicitly numbered follow the move number
+// and color given, which are those of the last move played before the first
+// one in the string
+func getMovesFrom(pgn string, moveNumber, color int) (moves []PgnMove, err error) {
+
+	// process the mainline which is the only line at depth zero. Offsets
+	// are computed as the difference between the length of the whole
+	// string and the length of the remaining text, so that only leading
+	// spaces can be removed once the length has been computed
+	pgn = strings.TrimRight(pgn, " \t\r\n")
+	total := len(pgn)
+	pgn = strings.TrimLeft(pgn, " \t\r\n")
+	if moves, err = getVariation(&pgn, total, moveNumber, color, 0); err != nil {
+		return
+	}
+
+	// at this point the whole string should have been processed. Otherwise,
+	// a closing parenthesis was found without an opening one
+	if len(pgn) > 0 {
+		return nil, newSyntaxError(total-len(pgn), pgn, "unbalanced parenthesis in the variations")
+	}
+
+	return
+}
+
+// Return a slice of PgnMove with all the moves of the line found at the
+// beginning of the string pointed by 'pgn' which is consumed as moves are
+// processed. The line is finished either when the string is exhausted or when a
+// closing parenthesis is found. 'total' is the length of the whole string being
+// parsed and it is used to compute offsets. Moves in the line start with the
+// given move number and color, which are used only in case the first move does
+// not explicitly specify them. 'depth' is the number of variations currently
+// open, and it is zero only for the mainline
+func getVariation(pgn *string, total, moveNumber, color, depth int) (moves []PgnMove, err error) {
 
-	moveNumber := -1     // initialize the move counter to unknown
-	color := 0           // initialize the color to unknown
 	var moveValue string // move actually parsed in PGN format
 	var emt float64      // elapsed move time
 	var comments string  // comments of each move
-	var err error
+	var prefix string    // comments preceding the first move of the line
+	var nags []PgnNag    // numeric annotation glyphs of each move
+	var offset int       // offset of each move
 
 	// process plies in sequence until the whole string is exhausted
-	for len(pgn) > 0 {
+	for len(*pgn) > 0 {
+
+		// is this the start of a new variation? If so, it is an
+		// alternative to the last move processed in this line
+		if reGroupOpenVariation.MatchString(*pgn) {
+
+			if len(moves) == 0 {
+				return nil, newSyntaxError(total-len(*pgn), *pgn, "a variation was found before any move")
+			}
+			tag := reGroupOpenVariation.FindStringIndex(*pgn)
+			*pgn = (*pgn)[tag[1]:]
+
+			// the first move of the variation (unless its number
+			// and color are given) has the same number and color
+			// of the last move, hence the previous ply is given
+			// since colors are swapped (and white moves numbered)
+			// before every move
+			last := &moves[len(moves)-1]
+			number := last.number
+			if last.color == 1 {
+				number--
+			}
+			variation, err := getVariation(pgn, total, number, -last.color, 1+depth)
+			if err != nil {
+				return nil, err
+			}
+			last.variations = append(last.variations, variation)
+			continue
+		}
+
+		// or is it the end of the current variation?
+		if reGroupCloseVariation.MatchString(*pgn) {
+
+			if depth == 0 {
+				return
+			}
+			tag := reGroupCloseVariation.FindStringIndex(*pgn)
+			*pgn = (*pgn)[tag[1]:]
+			return
+		}
+
+		// comments which do not follow immediately a move (e.g., after
+		// a variation or at the beginning of a line) are added to the
+		// last move or, if none has been processed yet, to the first
+		// one
+		if reGroupComment.MatchString(*pgn) {
+
+			tag := reGroupComment.FindStringSubmatchIndex(*pgn)
+			if len(moves) > 0 {
+				if len(moves[len(moves)-1].comments) > 0 {
+					moves[len(moves)-1].comments += "\r\n"
+				}
+				moves[len(moves)-1].comments += getComment(*pgn, tag)
+			} else {
+				if len(prefix) > 0 {
+					prefix += "\r\n"
+				}
+				prefix += getComment(*pgn, tag)
+			}
+			*pgn = (*pgn)[tag[1]:]
+			continue
+		}
 
 		// get the next move
-		tag := reGroupMoves.FindStringSubmatchIndex(pgn)
+		tag := reGroupMoves.FindStringSubmatchIndex(*pgn)
 
 		// reGroupMoves contains three groups and therefore legal
 		// matches contain 8 characters
-		if len(tag) >= 8 {
+		if len(tag) < 8 {
+			return nil, newSyntaxError(total-len(*pgn), *pgn, "no legal move could be parsed")
+		}
+		offset = total - len(*pgn) + tag[6]
 
-			// if a move number and color (. or ...) specifier has
-			// been found, then process all groups in this matching
-			if tag[2] >= 0 && tag[4] >= 0 {
+		// if a move number and color (. or ...) specifier has been
+		// found, then process all groups in this matching
+		if tag[2] >= 0 && tag[4] >= 0 {
 
-				// update the move counter
-				moveNumber, err = strconv.Atoi(pgn[tag[2]:tag[3]])
-				if err != nil {
-					log.Fatalf(" Fatal error while converting the move number")
-				}
+			// update the move counter
+			moveNumber, err = strconv.Atoi((*pgn)[tag[2]:tag[3]])
+			if err != nil {
+				return nil, newSyntaxError(total-len(*pgn)+tag[2], (*pgn)[tag[2]:tag[3]], "wrong move number")
+			}
 
-				// and the color, in case only one character
-				// ('.') is found, this is white's move,
-				// otherwise, it is black's move
-				if tag[5]-tag[4] == 1 {
-					color = 1
-				} else {
-					color = -1
-				}
+			// and the color, in case only one character ('.') is
+			// found, this is white's move, otherwise, it is black's
+			// move
+			if tag[5]-tag[4] == 1 {
+				color = 1
 			} else {
+				color = -1
+			}
+		} else {
 
-				// otherwise, assume that this is the opponent's
-				// move
-				color *= -1
+			// otherwise, assume that this is the opponent's move
+			// which starts a new move in case it is white's turn
+			color *= -1
+			if color == 1 {
+				moveNumber += 1
 			}
+		}
+
+		// and in any case extract the move value
+		moveValue = (*pgn)[tag[6]:tag[7]]
 
-			// and in any case extract the move value
-			moveValue = pgn[tag[6]:tag[7]]
+		// traditional suffix annotations are stored as NAGs
+		nags = nil
+		if tag[8] >= 0 {
+			nags = getSuffixNAGs((*pgn)[tag[8]:tag[9]])
 		}
 
 		// and move forward
-		pgn = pgn[tag[1]:]
+		*pgn = (*pgn)[tag[1]:]
 
-		// are there any comments immediately after? The following loop
-		// aims at processing an arbitrary number of comments
+		// are there any comments or NAGs immediately after? The
+		// following loop aims at processing an arbitrary number of them
 		emt = -1.0    // initialize the elapsed move time to unknown
 		comments = "" // initialize the comments to the empty string
-		for reGroupComment.MatchString(pgn) {
+		for reGroupComment.MatchString(*pgn) || reGroupNAG.MatchString(*pgn) {
+
+			// in case a NAG is found, just add it to this move
+			if reGroupNAG.MatchString(*pgn) {
+				tag = reGroupNAG.FindStringSubmatchIndex(*pgn)
+				value, err := strconv.Atoi((*pgn)[tag[2]:tag[3]])
+				if err != nil {
+					return nil, newSyntaxError(total-len(*pgn), (*pgn)[:tag[3]], "wrong Numeric Annotation Glyph")
+				}
+				nags = append(nags, PgnNag(value))
+				*pgn = (*pgn)[tag[1]:]
+				continue
+			}
 
 			// Yeah, a comment has been found! extract it
-			tag = reGroupComment.FindStringSubmatchIndex(pgn)
+			tag = reGroupComment.FindStringSubmatchIndex(*pgn)
 
 			// is this an emt field?
-			if reGroupEMT.MatchString(pgn) {
-				tagEMT := reGroupEMT.FindStringSubmatchIndex(pgn)
-				emt, err = strconv.ParseFloat(pgn[tagEMT[2]:tagEMT[3]], 32)
+			if reGroupEMT.MatchString(*pgn) {
+				tagEMT := reGroupEMT.FindStringSubmatchIndex(*pgn)
+				emt, err = strconv.ParseFloat((*pgn)[tagEMT[2]:tagEMT[3]], 32)
 				if err != nil {
-					log.Fatalf(" Fatal error while converting emt")
+					return nil, newSyntaxError(total-len(*pgn), (*pgn)[:tagEMT[1]], "wrong elapsed move time")
 				}
 			} else {
 				// if not, then just add these comments. In case
@@ -197,25 +337,50 @@ func getMoves(pgn string) (moves []PgnMove) {
 				if len(comments) > 0 {
 					comments += "\r\n"
 				}
-				comments += pgn[1+tag[2] : tag[3]-1]
+				comments += getComment(*pgn, tag)
 			}
-			pgn = pgn[tag[1]:]
+			*pgn = (*pgn)[tag[1]:]
+		}
+
+		// in case some comments preceded the first move of this line,
+		// then add them now
+		if len(prefix) > 0 {
+			if len(comments) > 0 {
+				prefix += "\r\n"
+			}
+			comments, prefix = prefix+comments, ""
 		}
 
 		// and add this move to the list of moves to return unless there
 		// are unknown fields
 		if moveNumber == -1 || color == 0 {
-			log.Fatalf(" Either the move number or the color were incorrect")
+			return nil, newSyntaxError(offset, moveValue, "either the move number or the color are unknown")
 		}
-		moves = append(moves, PgnMove{moveNumber, color, moveValue, float32(emt), comments})
+		moves = append(moves, PgnMove{moveNumber, color, moveValue, float32(emt), comments, nags, nil, offset})
+	}
+
+	// if the string was exhausted within a variation then a closing
+	// parenthesis is missing
+	if depth > 0 {
+		return nil, newSyntaxError(total, "", "unbalanced parenthesis: a variation was not closed")
 	}
 
 	return
 }
 
+// getComment is a helper function that returns the text of the comment matched
+// by reGroupComment at the given indices, either between braces or until the
+// end of the line
+func getComment(pgn string, tag []int) string {
+	if tag[2] >= 0 {
+		return pgn[tag[2]:tag[3]]
+	}
+	return pgn[tag[4]:tag[5]]
+}
+
 // Return an instance of PgnOutcome with the score of each player as specified
 // in the given string
-func getOutcome(pgn string) (outcome PgnOutcome) {
+func getOutcome(pgn string) (outcome PgnOutcome, err error) {
 
 	// get information about the outcome as given in pgn
 	tag := reGroupOutcome.FindStringSubmatchIndex(pgn)
@@ -233,7 +398,7 @@ func getOutcome(pgn string) (outcome PgnOutcome) {
 			// otherwise, one side won the match
 			scoreWhite, err := strconv.Atoi(pgn[tag[2]:tag[3]])
 			if err != nil {
-				log.Fatalf(" Ilegal outcome found in string '%s'", pgn)
+				return outcome, newSyntaxError(0, pgn, "illegal outcome")
 			}
 			outcome = PgnOutcome{float32(scoreWhite), 1.0 - float32(scoreWhite)}
 		}
@@ -243,178 +408,219 @@ func getOutcome(pgn string) (outcome PgnOutcome) {
 }
 
 // Return the contents of a chess game from the full transcription of a chess
-// game given in a string in PGN format. In case verbose is given, it shows
-// additional information
-func getGameFromString(pgn string, verbose bool) PgnGame {
+// game given in a string in PGN format. The string should contain only one
+// game. In case verbose is given, it shows additional information.
+//
+// In case of error, the offset of the offending text relative to the beginning
+// of the given string is returned along with it. The same offset is stored in
+// every move
+func getGameFromString(pgn string, verbose bool) (game PgnGame, err error) {
 
 	// create variables to store different sections of a single PGN game
 	var strTags, strMoves, strOutcome string
+	var offsetMoves int
+
+	// offsets are computed as the difference between the length of the
+	// whole string and the length of the remaining text
+	pgn = strings.TrimRight(pgn, " \t\r\n")
+	total := len(pgn)
+	pgn = strings.TrimLeft(pgn, " \t\r\n")
 
-	// find the tags of the first game in pgn
+	// find the tags of the game at the beginning of pgn
+	offsetTags := total - len(pgn)
 	endpoints := reTags.FindStringIndex(pgn)
-	if endpoints == nil {
-		log.Fatalf(" the PGN tags have not been found")
-	} else {
+	if endpoints == nil || endpoints[0] != 0 {
+		return game, newError(ErrTag, excerpt(pgn), "the PGN tags have not been found").at(offsetTags)
+	}
+
+	// copy the section of the tags and move forward in the pgn string
+	strTags = pgn[endpoints[0]:endpoints[1]]
+	pgn = pgn[endpoints[1]:]
 
-		// copy the section of the tags and move forward in the pgn string
-		strTags = pgn[endpoints[0]:endpoints[1]]
+	if verbose {
+		log.Printf(" Legal tags of a PGN game have been found:\n%v", strTags)
+	}
+
+	// now, check whether this is followed by a legal transcription of chess
+	// moves in PGN format. Note that games might have no moves at all
+	// (e.g., because they were abandoned)
+	offsetMoves = total - len(pgn)
+	endpoints = reMoves.FindStringIndex(pgn)
+	if endpoints != nil && endpoints[0] == 0 {
+
+		// copy the section with the chess moves and move forward in the
+		// pgn string
+		strMoves = pgn[endpoints[0]:endpoints[1]]
 		pgn = pgn[endpoints[1]:]
 
 		if verbose {
-			log.Printf(" Legal tags of a PGN game have been found:\n%v", strTags)
+			log.Printf(" A legal transcription of chess moves in PGN format has been found:\n%v\n\n", strMoves)
 		}
+	}
 
-		// now, check that this is followed by a legal transcription of
-		// chess moves in PGN format
-		endpoints = reMoves.FindStringIndex(pgn)
-		if endpoints == nil {
-			log.Fatalf(" no transcription of legal moves has been found")
-		} else {
-
-			// copy the section with the chess moves and move
-			// forward in the pgn string
-			strMoves = pgn[endpoints[0]:endpoints[1]]
-			pgn = pgn[endpoints[1]:]
+	// now, check that the final result is properly written and that
+	// nothing else is found after it
+	endpoints = reOutcome.FindStringIndex(pgn)
+	if endpoints == nil || endpoints[0] != 0 || endpoints[1] != len(pgn) {
+		return game, newSyntaxError(total-len(pgn), pgn, "there is no legal transcription of the final result")
+	}
 
-			if verbose {
-				log.Printf(" A legal transcription of chess moves in PGN format has been found:\n%v\n\n", strMoves)
-			}
+	// again, copy the section with the final outcome
+	strOutcome = pgn[endpoints[0]:endpoints[1]]
 
-			// now, check that the final result is properly written
-			endpoints = reOutcome.FindStringIndex(pgn)
-			if endpoints == nil {
-				log.Fatalf(" there is no legal transcription of the final result")
-			} else {
+	if verbose {
+		log.Printf(" The outcome has been properly identified:\n%v\n\n", strOutcome)
+	}
 
-				// again, copy the section with the final
-				// outcome and move forward in the pgn file
-				strOutcome = pgn[endpoints[0]:endpoints[1]]
-				pgn = pgn[endpoints[1]:]
+	// now, just process the different chunks extracted previously and store
+	// them in the game to return. Moves are numbered from the initial
+	// position of the game, which might be given in the tags. Offsets of
+	// moves are relative to the beginning of their section and hence they
+	// are shifted
+	game.tags = getTags(strTags)
+	_, moveNumber, color, err := game.getInitialPosition()
+	if err != nil {
+		return game, err.(*PgnError).at(offsetTags)
+	}
+	if game.moves, err = getMovesFrom(strMoves, moveNumber, color); err != nil {
+		return game, err.(*PgnError).at(offsetMoves + int(err.(*PgnError).Offset))
+	}
+	shiftMoves(game.moves, offsetMoves)
+	if game.outcome, err = getOutcome(strOutcome); err != nil {
+		return game, err.(*PgnError).at(total - len(pgn))
+	}
+	return
+}
 
-				if verbose {
-					log.Printf(" The outcome has been properly identified:\n%v\n\n", strOutcome)
-				}
-			}
+// shiftMoves is a helper function that adds the given offset to all the given
+// moves and their variations
+func shiftMoves(moves []PgnMove, offset int) {
+	for idx := range moves {
+		moves[idx].offset += offset
+		for _, variation := range moves[idx].variations {
+			shiftMoves(variation, offset)
 		}
 	}
-
-	// now, just process the different chunks extracted previously and store
-	// them in the game to return
-	tags := getTags(strTags)          // -- PGN tags
-	moves := getMoves(strMoves)       // -- PGN moves
-	outcome := getOutcome(strOutcome) // -- PGN outcome
-	return PgnGame{tags, moves, outcome}
 }
 
 // Return the contents of all chess games that satisfiy the given query from the
-// specified string which shall be formattted in PGN format. Games are sorted
-// according to the criteria given in sort if any is given; if not, they are
-// listed in the same order they were found in the file. For each game, the
-// board is shown every showboard plies
+// specified reader which shall provide games formattted in PGN format. Games
+// are sorted according to the criteria given in sort if any is given; if not,
+// they are listed in the same order they were found. For each game, the board
+// is shown every showboard plies
 //
-// In case verbose is given, it shows additional information
-func GetGamesFromString(pgn string, showboard int, query string, sortString string, verbose bool) (games PgnCollection) {
-
-	var err error
-	var logEvaluator pfparser.LogicalEvaluator
-
-	// since parsing queries affect its contents, make a backup copy
-	queryString := query
-
-	// in case a string has been given ...
-	if query != "" {
-
-		// ... parse it (with null depth, of course!)
-		logEvaluator, err = pfparser.Parse(&queryString, 0)
-		if err != nil {
-			log.Fatal(err)
-		}
+// The options given modify how games are read. In case verbose is given, it
+// shows additional information. If strict is given, all moves are verified to
+// be legal according to the rules of chess. If any error is found, processing
+// is stopped and it is returned as a *PgnError unless lenient is given. In this
+// case, malformed games are either skipped or truncated and the problems found
+// are recorded as diagnostics in the collection. Strict and lenient modes can
+// not be given together. Games are replayed only if replay is given or if
+// necessary, see Reader.SetReplay
+func ReadGamesFromReader(r io.Reader, showboard int, query string, sortString string, options ReadOptions) (games PgnCollection, err error) {
+
+	if options.Strict && options.Lenient {
+		return games, newError(ErrQuery, "", "strict and lenient modes can not be used together")
 	}
 
-	// just iterate over the string extracting the information of every game
-	for reGame.MatchString(pgn) {
-
-		// In case a match has been found, extract the next game
-		tag := reGame.FindStringSubmatchIndex(pgn)
-
-		// Parse this game and add it to the slice of games to return
-		game := getGameFromString(pgn[tag[0]:tag[1]], verbose)
-
-		symtable := make(map[string]pfparser.RelationalInterface)
-
-		// in case a query has been given, then process it
-		if query != "" {
-
-			// first, start by creating a symbol table with all the
-			// information appearing in the headers of this game
-			for key, content := range game.tags {
-
-				// first, verify whether this is an integer
-				value, ok := content.(constInteger)
-				if ok {
-
-					symtable[key] = pfparser.ConstInteger(value)
-				} else {
+	// create a reader of pgn games which filters games with the given query
+	reader := NewReader(r)
+	reader.SetShowBoard(showboard)
+	reader.SetVerbose(options.Verbose)
+	reader.SetStrict(options.Strict)
+	reader.SetLenient(options.Lenient)
+	reader.SetReplay(options.Replay)
+	if err = reader.SetQuery(query); err != nil {
+		return
+	}
 
-					// if not, check if it is a string
-					value, ok := content.(constString)
-					if ok {
-						symtable[key] = pfparser.ConstString(value)
-					} else {
-						log.Fatal(" Unknown type")
-					}
-				}
-			}
+	// just iterate over all games accepted by the reader
+	for {
+		game, err := reader.Next()
+		if err == io.EOF {
+			break
 		}
-
-		// if no query was given, or if one was given and this game
-		// satisfies it
-		if query == "" ||
-			(query != "" &&
-				logEvaluator.Evaluate(symtable) == pfparser.TypeBool(true)) {
-
-			// parse all moves of this game
-			game.ParseMoves(showboard)
-
-			games.slice = append(games.slice, game)
-			games.nbGames += 1
+		if err != nil {
+			return games, err
 		}
 
-		// and move forward
-		pgn = pgn[tag[1]:]
-	}
-
-	// at this point the resulting string should be empty, otherwise, an
-	// error should be raised
-	if pgn != "" {
-		log.Fatalf(" Some games were not processed: %q\n\n", pgn)
+		games.slice = append(games.slice, *game)
+		games.nbGames += 1
 	}
+	games.diagnostics = reader.GetDiagnostics()
 
 	// and finally sort the games in case a sorting string was given
 	if sortString != "" {
-		games.GetSortDescriptor(sortString)
-		sort.Sort(games)
+		err = games.Sort(sortString)
 	}
 
 	// and return the slice computed so far
 	return
 }
 
+// Return the contents of all chess games that satisfiy the given query from the
+// specified reader which shall provide games formattted in PGN format. It
+// behaves like ReadGamesFromReader but any error is fatal
+func GetGamesFromReader(r io.Reader, showboard int, query string, sortString string, verbose bool) PgnCollection {
+
+	games, err := ReadGamesFromReader(r, showboard, query, sortString, ReadOptions{Verbose: verbose, Replay: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return games
+}
+
+// Return the contents of all chess games that satisfiy the given query from the
+// specified string which shall be formattted in PGN format. Games are sorted
+// according to the criteria given in sort if any is given; if not, they are
+// listed in the same order they were found in the file. For each game, the
+// board is shown every showboard plies
+//
+// If any error is found, processing is stopped and it is returned as a
+// *PgnError unless lenient is given in the options, see ReadGamesFromReader
+func ReadGamesFromString(pgn string, showboard int, query string, sortString string, options ReadOptions) (PgnCollection, error) {
+	return ReadGamesFromReader(strings.NewReader(pgn), showboard, query, sortString, options)
+}
+
+// Return the contents of all chess games that satisfiy the given query from the
+// specified string which shall be formattted in PGN format. It behaves like
+// ReadGamesFromString but any error is fatal
+func GetGamesFromString(pgn string, showboard int, query string, sortString string, verbose bool) PgnCollection {
+	return GetGamesFromReader(strings.NewReader(pgn), showboard, query, sortString, verbose)
+}
+
 // Return the contents of all chess games that satisfiy the given query from the
 // specified file which shall be formattted in PGN format. Games are sorted
 // according to the criteria given in sort if any is given; if not, they are
 // listed in the same order they were found in the file. For each game, the
 // board is shown every showboard plies
 //
-// In case verbose is given, it shows additional information
-func GetGamesFromFile(pgnfile string, showboard int, query string, sortString string, verbose bool) (games PgnCollection) {
+// The file is processed as a stream of games so that it is never fully loaded
+// in memory. If any error is found, processing is stopped and it is returned as
+// a *PgnError unless lenient is given in the options, see ReadGamesFromReader
+func ReadGamesFromFile(pgnfile string, showboard int, query string, sortString string, options ReadOptions) (games PgnCollection, err error) {
+
+	// Open the given file and make sure it is closed before leaving
+	file, err := os.Open(pgnfile)
+	if err != nil {
+		return games, newError(ErrIO, "", "%v", err)
+	}
+	defer file.Close()
 
-	// Open and read the given file and retrieve its contents
-	contents := fstools.Read(pgnfile, -1)
-	strContents := string(contents[:len(contents)])
+	// and now, just return the results of parsing its contents
+	return ReadGamesFromReader(file, showboard, query, sortString, options)
+}
+
+// Return the contents of all chess games that satisfiy the given query from the
+// specified file which shall be formattted in PGN format. It behaves like
+// ReadGamesFromFile but any error is fatal
+func GetGamesFromFile(pgnfile string, showboard int, query string, sortString string, verbose bool) PgnCollection {
 
-	// and now, just return the results of parsing these contents
-	return GetGamesFromString(strContents, showboard, query, sortString, verbose)
+	games, err := ReadGamesFromFile(pgnfile, showboard, query, sortString, ReadOptions{Verbose: verbose, Replay: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return games
 }
 
 /* Local Variables: */
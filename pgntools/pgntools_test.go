@@ -0,0 +1,359 @@
+package pgntools
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that variations are stored in the move they are an alternative to
+func TestVariations(t *testing.T) {
+
+	var moveTable = []struct {
+		pgn  string
+		text string
+	}{
+		{"1. e4 e5 2. Nf3", "1. e4 e5 2. Nf3"},
+		{"1. e4 (1. d4 d5) 1... e5", "1. e4 (1. d4 d5) 1... e5"},
+		{"1. e4 e5 (1... c5 2. Nf3 (2. Nc3) 2... d6) 2. Nf3",
+			"1. e4 e5 (1... c5 2. Nf3 (2. Nc3) 2... d6) 2. Nf3"},
+		{"1. e4 e5 ( c5 Nf3 ) 2. Nf3", "1. e4 e5 (1... c5 2. Nf3) 2. Nf3"},
+		{"1. e4 {best by test} ({or} 1. d4) e5", "1. e4 (1. d4) 1... e5"},
+		{"1. e4 ( d4 d5 ) 1... e5", "1. e4 (1. d4 d5) 1... e5"},
+		{"1. e4 e5 2. Nf3 ( Nc3 ) Nc6", "1. e4 e5 2. Nf3 (2. Nc3) 2... Nc6"},
+	}
+
+	for _, tt := range moveTable {
+		t.Run(tt.pgn, func(t *testing.T) {
+			moves, err := getMoves(tt.pgn)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			game := PgnGame{moves: moves}
+			assert(t, game.GetTextMoves(), tt.text)
+		})
+	}
+}
+
+// Test that comments are preserved both in the mainline and the variations
+func TestVariationComments(t *testing.T) {
+
+	moves, err := getMoves("1. e4 {main} (1. d4 {side} d5) 1... e5")
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	if len(moves) != 2 {
+		t.Fatalf("got %v moves in the mainline, want 2", len(moves))
+	}
+	assert(t, moves[0].comments, "main")
+
+	variations := moves[0].GetVariations()
+	if len(variations) != 1 || len(variations[0]) != 2 {
+		t.Fatalf("got variations '%v'", variations)
+	}
+	assert(t, variations[0][0].comments, "side")
+	assert(t, variations[0][1].moveValue, "d5")
+}
+
+// Test that both suffix annotations and NAGs are parsed into a list of NAGs
+func TestNAGs(t *testing.T) {
+
+	var moveTable = []struct {
+		pgn   string
+		nags  []PgnNag
+		text  string
+		latex string
+	}{
+		{"1. e4", nil, "1. e4", `\mainline{ 1. e4 }`},
+		{"1. e4!", []PgnNag{1}, "1. e4!", `\mainline{ 1. e4! }`},
+		{"1. e4 !?", []PgnNag{5}, "1. e4⁉", `\mainline{ 1. e4!? }`},
+		{"1. e4 $1", []PgnNag{1}, "1. e4!", `\mainline{ 1. e4! }`},
+		{"1. e4 $14", []PgnNag{14}, "1. e4 ⩲", `\mainline{ 1. e4 } \wbetter `},
+		{"1. e4?! $14 {comment} $201", []PgnNag{6, 14, 201}, "1. e4⁈ ⩲ D",
+			`\mainline{ 1. e4?! } \wbetter \$201 comment `},
+		{"1. e4 $255", []PgnNag{255}, "1. e4 $255", `\mainline{ 1. e4 } \$255 `},
+		{"1. e4!!!", []PgnNag{3, 1}, "1. e4‼!", `\mainline{ 1. e4!!! }`},
+		{"1. e4?!? $5", []PgnNag{6, 2, 5}, "1. e4⁈?⁉", `\mainline{ 1. e4?!?!? }`},
+	}
+
+	for _, tt := range moveTable {
+		t.Run(tt.pgn, func(t *testing.T) {
+			moves, err := getMoves(tt.pgn)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			game := PgnGame{moves: moves}
+			got := game.GetMoves()[0].GetNAGs()
+			if len(got) != len(tt.nags) {
+				t.Fatalf("got '%v' want '%v'", got, tt.nags)
+			}
+			for idx := range got {
+				if got[idx] != tt.nags[idx] {
+					t.Fatalf("got '%v' want '%v'", got, tt.nags)
+				}
+			}
+			assert(t, game.GetTextMoves(), tt.text)
+			assert(t, game.GetLaTeXMovesWithComments(), tt.latex)
+		})
+	}
+
+	// all NAGs of the PGN standard have a meaning, whereas the rest are
+	// shown in PGN format
+	for nag := PgnNag(0); nag <= 139; nag++ {
+		if strings.HasPrefix(nag.Meaning(), "unknown") {
+			t.Errorf("the standard NAG $%d has no meaning", int(nag))
+		}
+	}
+	nag := PgnNag(255)
+	assert(t, nag.Meaning(), "unknown annotation $255")
+	assert(t, nag.String(), "$255")
+	assert(t, nag.LaTeX(), `\$255`)
+}
+
+// Test that errors are returned by the error-returning API
+func TestReadGamesErrors(t *testing.T) {
+
+	var pgn = "[Event \"A\"]\n[Round \"1\"]\n\n1. e4 *\n\n[Event \"B\"]\n\n1. d4 *\n"
+
+	var errorTable = []struct {
+		sort string
+		kind ErrorKind
+		game int
+	}{
+		{"< %Event", 0, 0},
+		{"< %Round", ErrTag, 2},
+		{"< Event", ErrQuery, 0},
+		{"< %Round missing_last", 0, 0},
+		{"> %Round missing_first < %Event", 0, 0},
+		{"< %Round missing", ErrQuery, 0},
+	}
+
+	for _, tt := range errorTable {
+		t.Run(tt.sort, func(t *testing.T) {
+			_, err := ReadGamesFromString(pgn, 0, "", tt.sort, ReadOptions{})
+			if tt.kind == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error '%v'", err)
+				}
+				return
+			}
+			pgnerr, ok := err.(*PgnError)
+			if !ok || pgnerr.Kind != tt.kind || pgnerr.Game != tt.game {
+				t.Fatalf("got '%v' want a %v in game %v", err, tt.kind, tt.game)
+			}
+		})
+	}
+
+	// strict and lenient modes can not be used together
+	_, err := ReadGamesFromString(pgn, 0, "", "", ReadOptions{Strict: true, Lenient: true})
+	if pgnerr, ok := err.(*PgnError); !ok || pgnerr.Kind != ErrQuery {
+		t.Fatalf("got '%v' want a %v", err, ErrQuery)
+	}
+}
+
+// Test that games read are replayed only if requested or if necessary
+func TestReadGamesReplay(t *testing.T) {
+
+	var pgn = "[Event \"A\"]\n\n1. f3 e5 2. g4 Qh4# 0-1\n"
+
+	var replayTable = []struct {
+		options ReadOptions
+		query   string
+		status  GameStatus
+	}{
+		{ReadOptions{}, "", 0},
+		{ReadOptions{Replay: true}, "", Checkmate},
+		{ReadOptions{Strict: true}, "", Checkmate},
+		{ReadOptions{}, "%Status = 'Checkmate'", Checkmate},
+	}
+
+	for _, tt := range replayTable {
+		games, err := ReadGamesFromString(pgn, 0, tt.query, "", tt.options)
+		if err != nil {
+			t.Fatalf("unexpected error '%v'", err)
+		}
+		if games.Len() != 1 || games.GetGames()[0].GetStatus() != tt.status {
+			t.Errorf("got %v games with options %+v and query %q", games.Len(), tt.options, tt.query)
+		}
+	}
+}
+
+// Test that games are sorted with typed values, natural order and missing
+// values, and that sorting is stable
+func TestSortGames(t *testing.T) {
+
+	var pgn = `[Event "A"]
+[Date "2016.05.07"]
+[TimeControl "180+2"]
+[Round "1.10"]
+[WhiteElo "1500"]
+
+1. e4 *
+
+[Event "B"]
+[Date "2016.??.??"]
+[TimeControl "60+0"]
+[Round "1.9"]
+
+1. d4 *
+
+[Event "C"]
+[Date "2015.12.31"]
+[TimeControl "-"]
+[Round "1.9"]
+[WhiteElo "1800"]
+
+1. c4 *
+
+[Event "D"]
+[Date "2016.05.07"]
+[TimeControl "300+0"]
+[Round "2"]
+[WhiteElo "1500"]
+
+1. Nf3 *
+`
+
+	var sortTable = []struct {
+		sort   string
+		events string
+	}{
+		{"< %Date", "C B A D"},
+		{"> %Date", "A D B C"},
+		{"< %Date > %Event", "C B D A"},
+		{"< %TimeControl", "C B A D"},
+		{"< %Round", "B C A D"},
+		{"> %Round", "D A B C"},
+		{"> %WhiteElo missing_last", "C A D B"},
+		{"< %WhiteElo missing_first", "B A D C"},
+		{"> %WhiteElo missing_first", "B C A D"},
+	}
+
+	for _, tt := range sortTable {
+		t.Run(tt.sort, func(t *testing.T) {
+			games, err := ReadGamesFromString(pgn, 0, "", tt.sort, ReadOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			var events []string
+			for _, game := range games.GetGames() {
+				event, _ := game.getField("Event")
+				events = append(events, event)
+			}
+			assert(t, strings.Join(events, " "), tt.events)
+		})
+	}
+}
+
+// Test that strings are compared in natural order
+func TestCompareNatural(t *testing.T) {
+
+	var naturalTable = []struct {
+		left, right string
+		order       int
+	}{
+		{"60+0", "180+2", -1},
+		{"180+2", "180+10", -1},
+		{"Round 10", "Round 9", +1},
+		{"1.9", "1.10", -1},
+		{"alice", "alice", 0},
+		{"alice", "alice2", -1},
+		{"007", "7", -1},
+		{"1647", "alice", -1},
+	}
+
+	for _, tt := range naturalTable {
+		if order := compareNatural(tt.left, tt.right); order != tt.order {
+			t.Errorf("got %v comparing '%v' and '%v' want %v", order, tt.left, tt.right, tt.order)
+		}
+		if order := compareNatural(tt.right, tt.left); order != -tt.order {
+			t.Errorf("got %v comparing '%v' and '%v' want %v", order, tt.right, tt.left, -tt.order)
+		}
+	}
+}
+
+// Test that games starting from a custom position are numbered and replayed
+// from it
+func TestSetUp(t *testing.T) {
+
+	var setupTable = []struct {
+		pgn  string
+		text string
+		fen  string
+	}{
+		{"[SetUp \"1\"]\n[FEN \"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3\"]\n\nBb5 a6 Ba4 *",
+			"3. Bb5 3... a6 4. Ba4",
+			"r1bqkbnr/1ppp1ppp/p1n5/4p3/B3P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 1 4"},
+		{"[SetUp \"1\"]\n[FEN \"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/2N2N2/PPPP1PPP/R1BQKB1R b KQkq - 3 12\"]\n\n12... Nf6 13. Bb5 *",
+			"12... Nf6 13. Bb5",
+			"r1bqkb1r/pppp1ppp/2n2n2/1B2p3/4P3/2N2N2/PPPP1PPP/R1BQK2R b KQkq - 5 13"},
+		{"[SetUp \"1\"]\n[FEN \"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/2N2N2/PPPP1PPP/R1BQKB1R b KQkq - 3 12\"]\n\nNf6 Bb5 *",
+			"12... Nf6 13. Bb5",
+			"r1bqkb1r/pppp1ppp/2n2n2/1B2p3/4P3/2N2N2/PPPP1PPP/R1BQK2R b KQkq - 5 13"},
+		{"[SetUp \"0\"]\n[FEN \"8/8/4k3/8/8/4K3/8/8 b - - 0 1\"]\n\ne4 e5 *",
+			"1. e4 1... e5",
+			"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2"},
+	}
+
+	for _, tt := range setupTable {
+		t.Run(tt.pgn, func(t *testing.T) {
+			game, err := getGameFromString(tt.pgn, false)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			if err = game.Replay(0); err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			var words []string
+			for _, move := range game.GetMoves() {
+				words = append(words, getTextLine([]PgnMove{move}))
+			}
+			assert(t, strings.Join(words, " "), tt.text)
+
+			board, _, _, _ := game.getInitialPosition()
+			for _, move := range game.GetMoves() {
+				board.UpdateBoard(move, false)
+			}
+			assert(t, board.GetFen(), tt.fen)
+		})
+	}
+
+	// a white move can not be played when black is to move
+	game, err := getGameFromString("[SetUp \"1\"]\n[FEN \"8/8/4k3/8/8/4K3/8/8 b - - 0 40\"]\n\n40. Kd3 *", false)
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	if err = game.Replay(0); err == nil {
+		t.Fatalf("an error was expected")
+	}
+}
+
+// Test that the position after every ply is given in FEN notation
+func TestGetFenAt(t *testing.T) {
+
+	game, err := getGameFromString("[Event \"A\"]\n\n1. e4 c5 2. Nf3 d6 3. d4 cxd4 *", false)
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	var fenTable = []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"rnbqkbnr/pp1ppppp/8/2p5/4P3/8/PPPP1PPP/RNBQKBNR w KQkq c6 0 2",
+		"rnbqkbnr/pp1ppppp/8/2p5/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2",
+		"rnbqkbnr/pp2pppp/3p4/2p5/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 0 3",
+		"rnbqkbnr/pp2pppp/3p4/2p5/3PP3/5N2/PPP2PPP/RNBQKB1R b KQkq d3 0 3",
+		"rnbqkbnr/pp2pppp/3p4/8/3pP3/5N2/PPP2PPP/RNBQKB1R w KQkq - 0 4",
+	}
+	for ply, fen := range fenTable {
+		got, err := game.GetFenAt(ply)
+		if err != nil {
+			t.Fatalf("unexpected error '%v'", err)
+		}
+		assert(t, got, fen)
+	}
+
+	// plies out of range are rejected
+	if _, err := game.GetFenAt(len(fenTable)); err == nil {
+		t.Fatalf("an error was expected")
+	}
+}
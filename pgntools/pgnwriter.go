@@ -0,0 +1,248 @@
+/*
+  pgnwriter.go
+  Description: Serialization of chess games to PGN export format
+*/
+
+package pgntools
+
+import (
+	"fmt"          // printing msgs
+	"io"           // io streams
+	"os"           // access to file mgmt functions
+	"sort"         // for sorting tags
+	"strings"      // string manipulation
+	"unicode/utf8" // to count columns
+)
+
+// globals
+// ----------------------------------------------------------------------------
+
+// the Seven Tag Roster consists of the following tags which are always written
+// first and in this order. In case any is missing, the following default
+// values are used instead
+var sevenTagRoster = []struct {
+	name, value string
+}{
+	{"Event", "?"},
+	{"Site", "?"},
+	{"Date", "????.??.??"},
+	{"Round", "?"},
+	{"White", "?"},
+	{"Black", "?"},
+	{"Result", "*"},
+}
+
+// constants
+// ----------------------------------------------------------------------------
+
+// maximum number of columns of every line of the movetext in export format
+const pgnColumns = 80
+
+// Methods
+// ----------------------------------------------------------------------------
+
+// Return the transcription of this game in PGN export format: first the tags of
+// the Seven Tag Roster in order, then all other tags sorted by name, an empty
+// line and the movetext wrapped at 80 columns followed by the result. Comments,
+// emt annotations, NAGs and variations are preserved. It is intended to be used
+// in templates as well
+func (game *PgnGame) GetPGN() string {
+
+	var output strings.Builder
+
+	// first, the tags of the Seven Tag Roster. The result is taken from
+	// the outcome of the game if it is not given as a tag
+	for _, tag := range sevenTagRoster {
+		value := tag.value
+		if content, ok := game.tags[tag.name]; ok {
+			value = fmt.Sprintf("%v", content)
+		} else if tag.name == "Result" {
+			value = game.outcome.getResult()
+		}
+		output.WriteString(getPGNTag(tag.name, value))
+	}
+
+	// next, all other tags sorted by name
+	var names []string
+	for name := range game.tags {
+		if !isSevenTagRoster(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		output.WriteString(getPGNTag(name, fmt.Sprintf("%v", game.tags[name])))
+	}
+
+	// and finally the movetext followed by the result
+	output.WriteString("\n")
+	words := append(getPGNLine(game.moves), game.outcome.getResult())
+	output.WriteString(wrapPGN(words, pgnColumns))
+
+	return output.String()
+}
+
+// Writes into the specified writer the transcription of all games in this
+// collection in PGN export format, separated by empty lines. It returns a
+// *PgnError in case of failure
+func (games *PgnCollection) WritePGN(dst io.Writer) error {
+
+	for idx := range games.slice {
+		if idx > 0 {
+			if _, err := io.WriteString(dst, "\n"); err != nil {
+				return newError(ErrIO, "", "%v", err)
+			}
+		}
+		if _, err := io.WriteString(dst, games.slice[idx].GetPGN()); err != nil {
+			return newError(ErrIO, "", "%v", err)
+		}
+	}
+	return nil
+}
+
+// Writes into the specified dst file the transcription of all games in this
+// collection in PGN export format. It returns a *PgnError if the file already
+// exists or it can not be created
+func (games *PgnCollection) WritePGNToFile(dst string) error {
+
+	// check if the file exists
+	if _, err := os.Stat(dst); err == nil {
+		return newError(ErrIO, dst, "the file already exists")
+	}
+
+	// now, open the file in read/write mode
+	file, err := os.Create(dst)
+	if err != nil {
+		return newError(ErrIO, dst, "%v", err)
+	}
+
+	// make sure the file is closed before leaving
+	defer file.Close()
+
+	return games.WritePGN(file)
+}
+
+// Return the result of this outcome as a game termination marker: "1-0",
+// "0-1", "1/2-1/2" or "*" if the game is unfinished
+func (outcome PgnOutcome) getResult() string {
+	switch {
+	case outcome.scoreWhite == 1:
+		return "1-0"
+	case outcome.scoreBlack == 1:
+		return "0-1"
+	case outcome.scoreWhite == 0.5:
+		return "1/2-1/2"
+	}
+	return "*"
+}
+
+// Functions
+// ----------------------------------------------------------------------------
+
+// isSevenTagRoster is a helper function that returns true if the given tag is
+// part of the Seven Tag Roster
+func isSevenTagRoster(name string) bool {
+	for _, tag := range sevenTagRoster {
+		if tag.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getPGNTag is a helper function that returns a line with a tag pair in export
+// format. Quotes and backslashes in the value are escaped
+func getPGNTag(name, value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return fmt.Sprintf("[%v \"%v\"]\n", name, value)
+}
+
+// getPGNLine is a helper function that returns the words of the given line of
+// moves in PGN export format. Move numbers are given for all white moves and
+// for black moves that either start the line or follow a comment or a
+// variation. NAGs are written in numeric form, and the elapsed move time is
+// written as an %emt comment
+func getPGNLine(moves []PgnMove) (words []string) {
+
+	showPrefix := true
+	for _, move := range moves {
+
+		if move.color == 1 {
+			words = append(words, fmt.Sprintf("%v.", move.number))
+		} else if showPrefix {
+			words = append(words, fmt.Sprintf("%v...", move.number))
+		}
+		words = append(words, move.moveValue)
+
+		for _, nag := range move.nags {
+			words = append(words, fmt.Sprintf("$%d", int(nag)))
+		}
+
+		// comments are split in words so that they can be wrapped
+		showPrefix = false
+		if move.emt != -1 {
+			words = append(words, fmt.Sprintf("{[%%emt %.3f]}", move.emt))
+			showPrefix = true
+		}
+		if move.comments != "" {
+			for _, comment := range strings.Split(move.comments, "\r\n") {
+				words = append(words, getPGNComment(comment)...)
+			}
+			showPrefix = true
+		}
+
+		// and variations are given between parenthesis
+		for _, variation := range move.variations {
+			line := getPGNLine(variation)
+			line[0] = "(" + line[0]
+			line[len(line)-1] += ")"
+			words = append(words, line...)
+			showPrefix = true
+		}
+	}
+
+	return
+}
+
+// getPGNComment is a helper function that returns the words of the given
+// comment between braces
+func getPGNComment(comment string) []string {
+
+	words := strings.Fields(comment)
+	if len(words) == 0 {
+		return []string{"{}"}
+	}
+	words[0] = "{" + words[0]
+	words[len(words)-1] += "}"
+	return words
+}
+
+// wrapPGN is a helper function that returns the given words separated by
+// spaces in lines of at most the given number of columns. Words longer than
+// the number of columns are written in a line of their own
+func wrapPGN(words []string, columns int) string {
+
+	var output strings.Builder
+	length := 0
+	for _, word := range words {
+		if length > 0 && length+1+utf8.RuneCountInString(word) > columns {
+			output.WriteString("\n")
+			length = 0
+		}
+		if length > 0 {
+			output.WriteString(" ")
+			length += 1
+		}
+		output.WriteString(word)
+		length += utf8.RuneCountInString(word)
+	}
+	output.WriteString("\n")
+
+	return output.String()
+}
+
+/* Local Variables: */
+/* mode:go */
+/* fill-column:80 */
+/* End: */
@@ -0,0 +1,75 @@
+package pgntools
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that games are written in export format with the Seven Tag Roster first
+func TestGetPGN(t *testing.T) {
+
+	var pgn = `[WhiteElo "1500"]
+[Black "bob"]
+[White "alice"]
+[ECO "C20"]
+[Annotator "a \"quoted\" name"]
+
+1. e4 {[%emt 1.500]} e5! ; a rest of line comment
+2. Nf3 (2. f4 exf4 {[%clk 0:03:00]} $14) 2... Nc6 $1 $14 1-0
+`
+
+	var want = `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "alice"]
+[Black "bob"]
+[Result "1-0"]
+[Annotator "a \"quoted\" name"]
+[ECO "C20"]
+[WhiteElo "1500"]
+
+1. e4 {[%emt 1.500]} 1... e5 $1 {a rest of line comment} 2. Nf3 (2. f4 exf4 $14
+{[%clk 0:03:00]}) 2... Nc6 $1 $14 1-0
+`
+
+	game, err := getGameFromString(strings.Replace(pgn, `\"`, `'`, -1), false)
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	game.tags["Annotator"] = constString(`a "quoted" name`)
+	assert(t, game.GetPGN(), want)
+}
+
+// Test that games written in export format are read back unmodified and that
+// no line exceeds 80 columns
+func TestWritePGN(t *testing.T) {
+
+	games, err := ReadGamesFromString(readerGames, 0, "", "", ReadOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+	var first strings.Builder
+	if err := games.WritePGN(&first); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	again, err := ReadGamesFromString(first.String(), 0, "", "", ReadOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error '%v' reading\n%v", err, first.String())
+	}
+	var second strings.Builder
+	if err := again.WritePGN(&second); err != nil {
+		t.Fatalf("unexpected error '%v'", err)
+	}
+
+	assert(t, second.String(), first.String())
+	if again.Len() != games.Len() {
+		t.Errorf("got %v games want %v", again.Len(), games.Len())
+	}
+	for _, line := range strings.Split(first.String(), "\n") {
+		if len(line) > 80 {
+			t.Errorf("line '%v' exceeds 80 columns", line)
+		}
+	}
+}
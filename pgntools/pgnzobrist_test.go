@@ -0,0 +1,85 @@
+package pgntools
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Test that Zobrist hashes are computed as in Polyglot. These are the keys
+// given in the specification of the Polyglot book format
+func TestZobrist(t *testing.T) {
+
+	var zobristTable = []struct {
+		moves string
+		hash  uint64
+	}{
+		{"", 0x463b96181691fc9c},
+		{"1. e4", 0x823c9b50fd114196},
+		{"1. e4 d5", 0x0756b94461c50fb0},
+		{"1. e4 d5 2. e5", 0x662fafb965db29d4},
+		{"1. e4 d5 2. e5 f5", 0x22a48b5a8e47ff78},
+		{"1. e4 d5 2. e5 f5 3. Ke2", 0x652a607ca3f242c1},
+		{"1. e4 d5 2. e5 f5 3. Ke2 Kf7", 0x00fdd303c946bdd9},
+		{"1. a4 b5 2. h4 b4 3. c4", 0x3c8123ea7b067637},
+		{"1. a4 b5 2. h4 b4 3. c4 bxc3 4. Ra3", 0x5c3f9b829b279560},
+	}
+
+	for _, tt := range zobristTable {
+		t.Run(tt.moves, func(t *testing.T) {
+			game, err := getGameFromString("[Event \"A\"]\n\n"+tt.moves+" *", false)
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			if err = game.Replay(0); err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			hash, err := game.GetHashAt(len(game.GetMoves()))
+			if err != nil {
+				t.Fatalf("unexpected error '%v'", err)
+			}
+			assert(t, fmt.Sprintf("%016x", hash), fmt.Sprintf("%016x", tt.hash))
+
+			// the same hash has to be computed from the FEN string
+			fen, _ := game.GetFenAt(len(game.GetMoves()))
+			board, _ := NewPgnBoardFromFen(fen)
+			assert(t, fmt.Sprintf("%016x", board.GetHash()), fmt.Sprintf("%016x", tt.hash))
+		})
+	}
+}
+
+// Test that hashes updated incrementally are the same than those computed from
+// scratch, including captures, castling, en passant captures and promotions
+func TestZobristIncremental(t *testing.T) {
+
+	var games = []string{
+		"1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 4. Bxc6 dxc6 5. O-O f6 6. d4 exd4 7. Nxd4 c5 8. Nb3 Qxd1 9. Rxd1 Bg4 10. f3 Be6 11. Nc3 Bd6 12. Be3 Ne7 13. Kf2 O-O *",
+		"1. e4 Nf6 2. e5 d5 3. exd6 exd6 4. d4 b5 5. d5 c5 6. dxc6 b4 7. c7 b3 8. cxd8=Q+ Kxd8 9. axb3 *",
+	}
+
+	for _, pgn := range games {
+		game, err := getGameFromString("[Event \"A\"]\n\n"+pgn, false)
+		if err != nil {
+			t.Fatalf("unexpected error '%v'", err)
+		}
+		if err = game.Validate(); err != nil {
+			t.Fatalf("unexpected error '%v'", err)
+		}
+		hashes := game.GetHashes()
+		if len(hashes) != 1+len(game.GetMoves()) {
+			t.Fatalf("got %v hashes want %v", len(hashes), 1+len(game.GetMoves()))
+		}
+		for ply, hash := range hashes {
+			board, _ := game.GetBoardAt(ply)
+			if hash != board.getZobrist() {
+				t.Errorf("got %016x want %016x at ply %v", hash, board.getZobrist(), ply)
+			}
+		}
+	}
+
+	// and positions out of range are not accepted
+	game, _ := getGameFromString("[Event \"A\"]\n\n1. e4 *", false)
+	game.Replay(0)
+	if _, err := game.GetHashAt(2); err == nil {
+		t.Errorf("an error was expected")
+	}
+}